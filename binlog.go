@@ -0,0 +1,122 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// BinlogPosition 开始读取表之前源库的 binlog 位置
+type BinlogPosition struct {
+	File     string
+	Position uint64
+	// 已执行的 GTID 集合, 未开启 GTID 时为空
+	ExecutedGTIDSet string
+}
+
+// flushTablesWithReadLock 在专用连接 conn 上加全局读锁, 阻止所有写入, 持有锁的会话仍可读取; 返回的 unlock 可重复调用, 不关闭 conn
+func flushTablesWithReadLock(ctx context.Context, conn *sql.Conn) (unlock func(), err error) {
+	_, err = conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
+	if err != nil {
+		return nil, err
+	}
+	unlocked := false
+	return func() {
+		if unlocked {
+			return
+		}
+		unlocked = true
+		// ctx 可能已取消, 解锁不使用 ctx
+		_, _ = conn.ExecContext(context.Background(), "UNLOCK TABLES")
+	}, nil
+}
+
+// beginConsistentSnapshot 在专用连接 conn 上开启 REPEATABLE READ 只读事务并立即建立一致性快照.
+// sql.DB.BeginTx 的快照在第一次读取表时才建立, 不能与全局读锁下记录的 binlog 位置对应
+func beginConsistentSnapshot(ctx context.Context, conn *sql.Conn) (end func(), err error) {
+	// 不带 SESSION 只对下一个事务生效, 连接归还连接池后不影响其它会话
+	for _, query := range []string{
+		"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+	} {
+		_, err = conn.ExecContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func() {
+		// 只读事务, 结束时回滚即可
+		_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+	}, nil
+}
+
+// getBinlogPosition 读取当前 binlog 位置; MySQL 8.4 移除了 SHOW MASTER STATUS, 语法错误时改用 SHOW BINARY LOG STATUS
+func getBinlogPosition(ctx context.Context, db queryer) (*BinlogPosition, error) {
+	pos, err := queryBinlogPosition(ctx, db, "SHOW MASTER STATUS")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 {
+		pos, err = queryBinlogPosition(ctx, db, "SHOW BINARY LOG STATUS")
+	}
+	return pos, err
+}
+
+func queryBinlogPosition(ctx context.Context, db queryer, query string) (*BinlogPosition, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 不同版本的列数不同, 按列名读取
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("binary logging is not enabled on the server")
+	}
+	values := make([]sql.NullString, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	pos := &BinlogPosition{}
+	for i, column := range columns {
+		switch column {
+		case "File":
+			pos.File = values[i].String
+		case "Position":
+			pos.Position, err = strconv.ParseUint(values[i].String, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid binlog position %q: %w", values[i].String, err)
+			}
+		case "Executed_Gtid_Set":
+			// 多个 UUID 的集合中带有换行
+			pos.ExecutedGTIDSet = strings.ReplaceAll(values[i].String, "\n", "")
+		}
+	}
+	return pos, rows.Err()
+}
+
+// writeBinlogPosition 以注释写入 binlog 位置, 搭建从库时取消注释执行; WithNoComments 时也写入
+func writeBinlogPosition(buf *bufio.Writer, pos *BinlogPosition) {
+	_, _ = buf.WriteString("-- Position to start replication or point-in-time recovery from\n")
+	_, _ = buf.WriteString("-- CHANGE MASTER TO MASTER_LOG_FILE='" + string(appendEscaped(nil, []byte(pos.File))) +
+		"', MASTER_LOG_POS=" + strconv.FormatUint(pos.Position, 10) + ";\n")
+	if pos.ExecutedGTIDSet != "" {
+		_, _ = buf.WriteString("-- SET @@GLOBAL.GTID_PURGED='" + string(appendEscaped(nil, []byte(pos.ExecutedGTIDSet))) + "';\n")
+	}
+	_, _ = buf.WriteString("\n")
+}
@@ -0,0 +1,40 @@
+package mysqldump
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func Test_writeBinlogPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		pos  BinlogPosition
+		want string
+	}{
+		{
+			name: "file and position",
+			pos:  BinlogPosition{File: "binlog.000003", Position: 157},
+			want: "-- Position to start replication or point-in-time recovery from\n" +
+				"-- CHANGE MASTER TO MASTER_LOG_FILE='binlog.000003', MASTER_LOG_POS=157;\n\n",
+		},
+		{
+			name: "with gtid set",
+			pos:  BinlogPosition{File: "mysql-bin.000001", Position: 4, ExecutedGTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4f22ab58-71ca-11e1-9e33-c80aa9429562:1-2"},
+			want: "-- Position to start replication or point-in-time recovery from\n" +
+				"-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000001', MASTER_LOG_POS=4;\n" +
+				"-- SET @@GLOBAL.GTID_PURGED='3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,4f22ab58-71ca-11e1-9e33-c80aa9429562:1-2';\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			writeBinlogPosition(buf, &tt.pos)
+			_ = buf.Flush()
+			if got := sb.String(); got != tt.want {
+				t.Errorf("writeBinlogPosition() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
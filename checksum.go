@@ -0,0 +1,62 @@
+package mysqldump
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// checksumWriter 计算写入 w 的最终字节 (压缩后) 的 SHA-256 和字节数
+type checksumWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	_, _ = c.h.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+// checksumEntry 一个输出的校验和
+type checksumEntry struct {
+	name  string
+	sum   string
+	bytes int64
+}
+
+// checksumManifest 收集一次 dump 中全部输出的校验和, 并发导出时由多个 goroutine 添加
+type checksumManifest struct {
+	mu      sync.Mutex
+	entries []checksumEntry
+}
+
+func (m *checksumManifest) add(name string, c *checksumWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, checksumEntry{name: name, sum: hex.EncodeToString(c.h.Sum(nil)), bytes: c.n})
+}
+
+// writeTo 按名称顺序每个输出写一行 "<sha256> <字节数> <名称>", WithWriter 的输出名称为 "-"
+func (m *checksumManifest) writeTo(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := slices.Clone(m.entries)
+	slices.SortFunc(entries, func(a, b checksumEntry) int {
+		return strings.Compare(a.name, b.name)
+	})
+	for _, e := range entries {
+		_, err := fmt.Fprintf(w, "%s %s %s\n", e.sum, strconv.FormatInt(e.bytes, 10), e.name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package mysqldump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_checksumManifest(t *testing.T) {
+	tests := []struct {
+		name   string
+		isGzip bool
+	}{
+		{name: "plain"},
+		{name: "gzip", isGzip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := dumpOption{isGzip: tt.isGzip, gzipLevel: gzip.DefaultCompression, lineEnding: "\n", manifest: &checksumManifest{}}
+			var dst bytes.Buffer
+			out, err := newDumpOutput(&dst, &o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = out.buf.WriteString("INSERT INTO `t` VALUES (1);\n")
+			if err := out.close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var manifest strings.Builder
+			if err := o.manifest.writeTo(&manifest); err != nil {
+				t.Fatal(err)
+			}
+			sum := sha256.Sum256(dst.Bytes())
+			want := fmt.Sprintf("%s %d -\n", hex.EncodeToString(sum[:]), dst.Len())
+			if got := manifest.String(); got != want {
+				t.Errorf("manifest = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func Test_checksumManifestOrder(t *testing.T) {
+	m := &checksumManifest{}
+	for _, name := range []string{"users.sql", "_schema.sql", "orders.sql"} {
+		c := &checksumWriter{w: &bytes.Buffer{}, h: sha256.New()}
+		m.add(name, c)
+	}
+	var sb strings.Builder
+	if err := m.writeTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n") {
+		fields := strings.Fields(line)
+		names = append(names, fields[len(fields)-1])
+	}
+	if got := strings.Join(names, ","); got != "_schema.sql,orders.sql,users.sql" {
+		t.Errorf("manifest order = %s", got)
+	}
+}
@@ -0,0 +1,212 @@
+package mysqldump
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// tableColumn information_schema.COLUMNS 中的一列
+type tableColumn struct {
+	name  string
+	extra string
+	// COLUMN_TYPE, 如 tinyint(1), varchar(20)
+	columnType string
+	comment    string
+	// CHARACTER_SET_NAME, 非字符串列为空
+	charset string
+}
+
+// isGenerated 是否为生成列 (VIRTUAL/STORED), 生成列不能被 INSERT;
+// MySQL 8 中带表达式默认值的列 EXTRA 为 DEFAULT_GENERATED, 不是生成列
+func (c tableColumn) isGenerated() bool {
+	extra := strings.ToUpper(c.extra)
+	return strings.Contains(extra, "VIRTUAL GENERATED") ||
+		strings.Contains(extra, "STORED GENERATED") ||
+		strings.Contains(extra, "PERSISTENT GENERATED")
+}
+
+// isInvisible 是否为 MySQL 8.0.23 起的 INVISIBLE 列, SELECT * 不返回不可见列
+func (c tableColumn) isInvisible() bool {
+	return strings.Contains(strings.ToUpper(c.extra), "INVISIBLE")
+}
+
+// isBoolean 是否为 TINYINT(1), 即 BOOL / BOOLEAN 列; MySQL 8.0.19 起整数类型不再显示宽度, 但 tinyint(1) 保留
+func (c tableColumn) isBoolean() bool {
+	return strings.HasPrefix(strings.ToLower(c.columnType), "tinyint(1)")
+}
+
+// dataType 返回 COLUMN_TYPE 中的类型名, 如 varbinary(16) 返回 VARBINARY, int unsigned 返回 INT
+func (c tableColumn) dataType() string {
+	name, _, _ := strings.Cut(strings.ToUpper(c.columnType), " ")
+	name, _, _ = strings.Cut(name, "(")
+	return name
+}
+
+// isInteger 是否为整数类型列
+func (c tableColumn) isInteger() bool {
+	switch c.dataType() {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT":
+		return true
+	}
+	return false
+}
+
+// isSpatial 是否为 GEOMETRY, POINT, POLYGON 等空间类型列
+func (c tableColumn) isSpatial() bool {
+	switch strings.ToLower(c.columnType) {
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon",
+		"geometrycollection", "geomcollection":
+		return true
+	}
+	return false
+}
+
+// getTableColumns 按定义顺序返回表的列
+func getTableColumns(ctx context.Context, db queryer, dbName, table string) ([]tableColumn, error) {
+	var columns []tableColumn
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME, EXTRA, COLUMN_TYPE, COLUMN_COMMENT, CHARACTER_SET_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column tableColumn
+		var charset sql.NullString
+		err = rows.Scan(&column.name, &column.extra, &column.columnType, &column.comment, &charset)
+		if err != nil {
+			return nil, err
+		}
+		column.charset = charset.String
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// needsIntroducer 列的字符集与 dump 使用的字符集 dumpCharset 不同时返回列的字符集, 否则返回空字符串;
+// utf8 是 utf8mb3 的别名
+func (c tableColumn) needsIntroducer(dumpCharset string) string {
+	charset := strings.ToLower(c.charset)
+	if charset == "" || charset == "binary" || c.isGenerated() || strings.EqualFold(c.columnType, "json") {
+		return ""
+	}
+	normalize := func(s string) string {
+		if s == "utf8" {
+			return "utf8mb3"
+		}
+		return s
+	}
+	if normalize(charset) == normalize(strings.ToLower(dumpCharset)) {
+		return ""
+	}
+	return charset
+}
+
+// introducerColumnList 返回读取时把 charsets 中非空的列转为原始字节的 SELECT 列表, 跳过生成列
+func introducerColumnList(columns []tableColumn, charsets []string) string {
+	list := make([]string, 0, len(columns))
+	for i, column := range columns {
+		if column.isGenerated() {
+			continue
+		}
+		name := quoteIdentifier(column.name)
+		if charsets[i] != "" {
+			name = "CAST(" + name + " AS BINARY) AS " + name
+		}
+		list = append(list, name)
+	}
+	return strings.Join(list, ",")
+}
+
+// selectColumnList 返回导出数据时 SELECT 的列; 没有生成列和不可见列时为 *,
+// 否则为除生成列之外全部列 (包含不可见列) 的列表, explicit 为 true, INSERT 也必须写列名
+func selectColumnList(columns []tableColumn) (list string, explicit bool) {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if column.isGenerated() {
+			explicit = true
+			continue
+		}
+		explicit = explicit || column.isInvisible()
+		quoted = append(quoted, quoteIdentifier(column.name))
+	}
+	if !explicit {
+		return "*", false
+	}
+	return strings.Join(quoted, ","), true
+}
+
+// getTableComment 返回 information_schema.TABLES 中的表注释
+func getTableComment(ctx context.Context, db queryer, dbName, table string) (string, error) {
+	var comment string
+	err := db.QueryRowContext(ctx, "SELECT TABLE_COMMENT FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", dbName, table).Scan(&comment)
+	return comment, err
+}
+
+// addMissingComments 把 SHOW CREATE TABLE 中缺少的表注释和列注释按 information_schema 补上.
+// 支持的版本中 SHOW CREATE TABLE 会完整输出注释 (单引号, 反斜杠和换行已转义), 这里只用于防止个别版本或代理丢失注释,
+// 已有的 COMMENT 不修改
+func addMissingComments(createTableSQL, tableComment string, columns []tableColumn) string {
+	comments := make(map[string]string, len(columns))
+	for _, column := range columns {
+		if column.comment != "" {
+			comments[column.name] = column.comment
+		}
+	}
+	lines := strings.Split(createTableSQL, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "  `"):
+			end := quotedEnd(line, 2)
+			if end == 0 {
+				continue
+			}
+			comment, ok := comments[strings.ReplaceAll(line[3:end-1], "``", "`")]
+			if !ok || hasCommentClause(line[end:]) {
+				continue
+			}
+			definition, comma := strings.CutSuffix(line, ",")
+			line = definition + " COMMENT '" + string(appendEscaped(nil, []byte(comment))) + "'"
+			if comma {
+				line += ","
+			}
+			lines[i] = line
+		case strings.HasPrefix(line, ")"):
+			// 表选项所在的行, 其后是分区定义
+			if tableComment != "" && !hasCommentClause(line) {
+				lines[i] = line + " COMMENT='" + string(appendEscaped(nil, []byte(tableComment))) + "'"
+			}
+			return strings.Join(lines, "\n")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hasTableComment 判断 CREATE TABLE 的表选项中是否有 COMMENT
+func hasTableComment(createTableSQL string) bool {
+	for _, line := range strings.Split(createTableSQL, "\n") {
+		if strings.HasPrefix(line, ")") {
+			return hasCommentClause(line)
+		}
+	}
+	return false
+}
+
+// hasCommentClause 判断 s 中引号之外是否有 COMMENT 子句
+func hasCommentClause(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(s, i) - 1
+			if i < 0 {
+				return false
+			}
+		case c == 'C' && strings.HasPrefix(s[i:], "COMMENT") && (i == 0 || !isIdentifierByte(s[i-1])):
+			end := i + len("COMMENT")
+			if end < len(s) && (s[end] == ' ' || s[end] == '=') {
+				return true
+			}
+		}
+	}
+	return false
+}
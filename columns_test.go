@@ -0,0 +1,207 @@
+package mysqldump
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_selectColumnList(t *testing.T) {
+	tests := []struct {
+		name         string
+		columns      []tableColumn
+		want         string
+		wantFiltered bool
+	}{
+		{
+			name: "no generated columns",
+			columns: []tableColumn{
+				{name: "id", extra: "auto_increment"},
+				{name: "created_at", extra: "DEFAULT_GENERATED on update CURRENT_TIMESTAMP"},
+			},
+			want: "*",
+		},
+		{
+			name: "virtual and stored generated columns",
+			columns: []tableColumn{
+				{name: "id", extra: "auto_increment"},
+				{name: "price"},
+				{name: "price_with_tax", extra: "VIRTUAL GENERATED"},
+				{name: "qty"},
+				{name: "total", extra: "STORED GENERATED"},
+			},
+			want:         "`id`,`price`,`qty`",
+			wantFiltered: true,
+		},
+		{
+			name: "invisible columns",
+			columns: []tableColumn{
+				{name: "id", extra: "auto_increment"},
+				{name: "secret", extra: "INVISIBLE"},
+				{name: "hidden_total", extra: "VIRTUAL GENERATED INVISIBLE"},
+			},
+			want:         "`id`,`secret`",
+			wantFiltered: true,
+		},
+		{
+			name:         "mariadb persistent column",
+			columns:      []tableColumn{{name: "a"}, {name: "b", extra: "PERSISTENT GENERATED"}},
+			want:         "`a`",
+			wantFiltered: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, filtered := selectColumnList(tt.columns)
+			if got != tt.want || filtered != tt.wantFiltered {
+				t.Errorf("selectColumnList() = %q, %v, want %q, %v", got, filtered, tt.want, tt.wantFiltered)
+			}
+		})
+	}
+}
+
+func Test_tableColumnIsBoolean(t *testing.T) {
+	tests := []struct {
+		columnType string
+		want       bool
+	}{
+		{columnType: "tinyint(1)", want: true},
+		{columnType: "tinyint(1) unsigned", want: true},
+		{columnType: "TINYINT(1)", want: true},
+		{columnType: "tinyint(4)"},
+		{columnType: "tinyint"},
+		{columnType: "tinyint(10)"},
+		{columnType: "int(1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.columnType, func(t *testing.T) {
+			if got := (tableColumn{name: "flag", columnType: tt.columnType}).isBoolean(); got != tt.want {
+				t.Errorf("isBoolean() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_addMissingComments(t *testing.T) {
+	columns := []tableColumn{
+		{name: "id"},
+		{name: "name", comment: "user's \"display\" name; 50% \\ 名称"},
+		{name: "note`s", comment: "back`tick"},
+	}
+	tableComment := "Users table\nsecond line"
+	tests := []struct {
+		name   string
+		create string
+		want   string
+	}{
+		{
+			name: "comments kept verbatim",
+			create: "CREATE TABLE `users` (\n" +
+				"  `id` int NOT NULL,\n" +
+				"  `name` varchar(20) DEFAULT 'a COMMENT b' COMMENT 'user\\'s \"display\" name; 50% \\\\ 名称',\n" +
+				"  `note``s` text COMMENT 'back`tick',\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Users table\\nsecond line'",
+			want: "CREATE TABLE `users` (\n" +
+				"  `id` int NOT NULL,\n" +
+				"  `name` varchar(20) DEFAULT 'a COMMENT b' COMMENT 'user\\'s \"display\" name; 50% \\\\ 名称',\n" +
+				"  `note``s` text COMMENT 'back`tick',\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Users table\\nsecond line'",
+		},
+		{
+			name: "missing comments added",
+			create: "CREATE TABLE `users` (\n" +
+				"  `id` int NOT NULL,\n" +
+				"  `name` varchar(20) DEFAULT 'a COMMENT b',\n" +
+				"  `note``s` text\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4\n" +
+				"/*!50100 PARTITION BY HASH (`id`) PARTITIONS 2 */",
+			want: "CREATE TABLE `users` (\n" +
+				"  `id` int NOT NULL,\n" +
+				"  `name` varchar(20) DEFAULT 'a COMMENT b' COMMENT 'user\\'s \\\"display\\\" name; 50% \\\\ 名称',\n" +
+				"  `note``s` text COMMENT 'back`tick'\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Users table\\nsecond line'\n" +
+				"/*!50100 PARTITION BY HASH (`id`) PARTITIONS 2 */",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addMissingComments(tt.create, tableComment, columns); got != tt.want {
+				t.Errorf("addMissingComments() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_tableColumnIsSpatial(t *testing.T) {
+	tests := []struct {
+		columnType string
+		want       bool
+	}{
+		{columnType: "point", want: true},
+		{columnType: "POLYGON", want: true},
+		{columnType: "geometry", want: true},
+		{columnType: "geomcollection", want: true},
+		{columnType: "varbinary(16)"},
+		{columnType: "varchar(10)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.columnType, func(t *testing.T) {
+			if got := (tableColumn{name: "shape", columnType: tt.columnType}).isSpatial(); got != tt.want {
+				t.Errorf("isSpatial() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeTableMetadataQueries(t *testing.T) {
+	tests := []struct {
+		name             string
+		createTable      string
+		wantCommentQuery int
+	}{
+		{
+			name:             "table comment in SHOW CREATE TABLE",
+			createTable:      "CREATE TABLE `t` (\n  `id` int\n) ENGINE=InnoDB COMMENT='users'",
+			wantCommentQuery: 0,
+		},
+		{
+			name:             "table comment missing",
+			createTable:      defaultCreateTable,
+			wantCommentQuery: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var columnQueries, commentQueries int
+			fixture := &dumpFixture{
+				tables:      []string{"t"},
+				createTable: tt.createTable,
+				query: func(query string) ([]string, [][]driver.Value, bool) {
+					switch {
+					case strings.Contains(query, "information_schema.COLUMNS"):
+						columnQueries++
+					case strings.Contains(query, "TABLE_COMMENT"):
+						commentQueries++
+					}
+					return nil, nil, false
+				},
+			}
+			db := sql.OpenDB(fixture.connector())
+			defer db.Close()
+			if err := Dump(db, "test", WithData(), WithWriter(io.Discard)); err != nil {
+				t.Fatal(err)
+			}
+			// 表结构和数据共用一次列查询
+			if columnQueries != 1 {
+				t.Errorf("information_schema.COLUMNS queried %d times, want 1", columnQueries)
+			}
+			if commentQueries != tt.wantCommentQuery {
+				t.Errorf("TABLE_COMMENT queried %d times, want %d", commentQueries, tt.wantCommentQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package mysqldump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Compressor 创建写入 w 的压缩流, Dump 返回前调用 Close 结束压缩流, 不关闭 w.
+// 可用于接入第三方实现, 如 github.com/klauspost/pgzip 或 zstd
+type Compressor func(w io.Writer) (io.WriteCloser, error)
+
+// gzipCompressor 使用 compress/gzip 单线程压缩
+func gzipCompressor(level int) Compressor {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	}
+}
+
+// parallelGzipBlockSize 并发压缩时每个块的大小
+const parallelGzipBlockSize = 1 << 20
+
+// parallelGzipCompressor 返回把输出分成 1MB 的块, 用 blocks 个 goroutine 并发压缩的 Compressor
+func parallelGzipCompressor(level, blocks int) Compressor {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		// 提前检查压缩级别
+		if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, err
+		}
+		return newParallelGzipWriter(w, level, parallelGzipBlockSize, blocks), nil
+	}
+}
+
+// parallelGzipWriter 把每个块压缩为一个独立的 gzip member, 按顺序写入 w.
+// 多个 member 连接起来仍是合法的 gzip 文件 (RFC 1952), gzip -d, compress/gzip 和 Source 都能解压;
+// 每个块单独压缩, 压缩率比单线程稍低
+type parallelGzipWriter struct {
+	w         io.Writer
+	level     int
+	blockSize int
+	// 当前未满的块
+	block []byte
+	// 按写入顺序排队等待输出的块, 容量限制并发压缩的块数
+	queue chan *gzipBlock
+	// 输出 goroutine 结束时关闭
+	done chan struct{}
+	// 是否已提交过块, 没有数据时 Close 也要写出一个空的 member
+	submitted bool
+
+	mu  sync.Mutex
+	err error
+}
+
+type gzipBlock struct {
+	compressed bytes.Buffer
+	err        error
+	// 压缩完成时关闭
+	done chan struct{}
+}
+
+func newParallelGzipWriter(w io.Writer, level, blockSize, blocks int) *parallelGzipWriter {
+	if blocks < 1 {
+		blocks = 1
+	}
+	p := &parallelGzipWriter{
+		w:         w,
+		level:     level,
+		blockSize: blockSize,
+		block:     make([]byte, 0, blockSize),
+		queue:     make(chan *gzipBlock, blocks),
+		done:      make(chan struct{}),
+	}
+	go p.writeBlocks()
+	return p
+}
+
+// writeBlocks 按顺序等待每个块压缩完成并写入 w, 出错后丢弃其余的块
+func (p *parallelGzipWriter) writeBlocks() {
+	defer close(p.done)
+	for b := range p.queue {
+		<-b.done
+		if p.failed() != nil {
+			continue
+		}
+		err := b.err
+		if err == nil {
+			_, err = p.w.Write(b.compressed.Bytes())
+		}
+		if err != nil {
+			p.mu.Lock()
+			p.err = err
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *parallelGzipWriter) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// submit 在新的 goroutine 中压缩 data, 队列已满时等待
+func (p *parallelGzipWriter) submit(data []byte) {
+	p.submitted = true
+	b := &gzipBlock{done: make(chan struct{})}
+	go func() {
+		defer close(b.done)
+		gz, err := gzip.NewWriterLevel(&b.compressed, p.level)
+		if err == nil {
+			_, err = gz.Write(data)
+		}
+		if err == nil {
+			err = gz.Close()
+		}
+		b.err = err
+	}()
+	p.queue <- b
+}
+
+func (p *parallelGzipWriter) Write(data []byte) (int, error) {
+	if err := p.failed(); err != nil {
+		return 0, err
+	}
+	n := len(data)
+	for len(data) > 0 {
+		free := p.blockSize - len(p.block)
+		if free > len(data) {
+			free = len(data)
+		}
+		p.block = append(p.block, data[:free]...)
+		data = data[free:]
+		if len(p.block) == p.blockSize {
+			// 块交给压缩 goroutine, 换一个新的缓冲区
+			p.submit(p.block)
+			p.block = make([]byte, 0, p.blockSize)
+		}
+	}
+	return n, nil
+}
+
+// Close 压缩剩余的数据, 等待全部块写出; 不关闭 w
+func (p *parallelGzipWriter) Close() error {
+	if len(p.block) > 0 || !p.submitted {
+		p.submit(p.block)
+		p.block = nil
+	}
+	close(p.queue)
+	<-p.done
+	return p.failed()
+}
@@ -0,0 +1,119 @@
+package mysqldump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func Test_parallelGzipWriter(t *testing.T) {
+	var input bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, "INSERT INTO `t` VALUES (%d,'row %d');\n", i, i)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		// 写入时每次的字节数
+		chunk int
+	}{
+		{name: "empty", input: nil, chunk: 1},
+		{name: "smaller than a block", input: input.Bytes()[:100], chunk: 7},
+		{name: "many blocks", input: input.Bytes(), chunk: 333},
+		{name: "exact blocks", input: input.Bytes()[:4096], chunk: 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			w := newParallelGzipWriter(&compressed, gzip.BestSpeed, 1024, 4)
+			for data := tt.input; len(data) > 0; {
+				n := min(tt.chunk, len(data))
+				if _, err := w.Write(data[:n]); err != nil {
+					t.Fatal(err)
+				}
+				data = data[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := gzip.NewReader(&compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.input) {
+				t.Errorf("decompressed %d bytes, want %d", len(got), len(tt.input))
+			}
+		})
+	}
+
+	t.Run("write error", func(t *testing.T) {
+		w := newParallelGzipWriter(failingWriter{}, gzip.BestSpeed, 16, 2)
+		_, _ = w.Write(input.Bytes()[:1024])
+		if err := w.Close(); !errors.Is(err, errWriteFailed) {
+			t.Errorf("Close() error = %v, want %v", err, errWriteFailed)
+		}
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		if _, err := parallelGzipCompressor(42, 2)(io.Discard); err == nil {
+			t.Error("want error for invalid level")
+		}
+	})
+}
+
+var errWriteFailed = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+// benchmarkDump 模拟 dump 输出的 64MB INSERT 语句, 更大的输出用 -benchtime 多次压缩
+func benchmarkDump() []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < 64<<20; i++ {
+		fmt.Fprintf(&b, "INSERT INTO `orders` VALUES (%d,'customer-%d','2024-01-%02d 10:%02d:00',%d.%02d,'note %x');\n",
+			i, i%9973, i%28+1, i%60, i%1000, i%100, i*2654435761)
+	}
+	return b.Bytes()
+}
+
+func BenchmarkCompressor(b *testing.B) {
+	data := benchmarkDump()
+	compressors := []struct {
+		name       string
+		compressor Compressor
+	}{
+		{name: "gzip", compressor: gzipCompressor(gzip.DefaultCompression)},
+		{name: "parallel gzip", compressor: parallelGzipCompressor(gzip.DefaultCompression, runtime.GOMAXPROCS(0))},
+	}
+	for _, c := range compressors {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				w, err := c.compressor(io.Discard)
+				if err != nil {
+					b.Fatal(err)
+				}
+				// 与 bufio.Writer 的默认写入大小相同
+				for p := data; len(p) > 0; {
+					n := min(4096, len(p))
+					_, _ = w.Write(p[:n])
+					p = p[n:]
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+)
+
+// Format 表数据的输出格式
+type Format int
+
+const (
+	// FormatSQL 输出可导入的 SQL, 默认格式
+	FormatSQL Format = iota
+	// FormatCSV 每个表输出为 CSV, 第一行为列名; 只包含表数据, 不包含表结构, 视图和存储过程等
+	FormatCSV
+	// FormatJSONL 每个表输出为 JSON Lines, 每行一个对象; 只包含表数据
+	FormatJSONL
+)
+
+// extension 返回 WithFilePerTable 时文件的扩展名
+func (f Format) extension() string {
+	switch f {
+	case FormatCSV:
+		return ".csv"
+	case FormatJSONL:
+		return ".jsonl"
+	}
+	return ".sql"
+}
+
+// writeTableCSV 以 CSV 写出表数据, 第一行为列名; NULL 写为 o.csvNull, 二进制列写为 base64
+func writeTableCSV(ctx context.Context, db queryer, dbName, table string, columns []tableColumn, buf *bufio.Writer, o *dumpOption) (uint64, error) {
+	rows, err := queryTableRows(ctx, db, dbName, table, columns, o)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.close()
+
+	binary := make([]bool, len(rows.types))
+	for i, columnType := range rows.types {
+		binary[i] = columnKind(columnType.DatabaseTypeName(), false) == valueKindBinary || rows.spatial[i]
+	}
+
+	w := csv.NewWriter(buf)
+	err = w.Write(rows.columns)
+	if err != nil {
+		return 0, err
+	}
+	record := make([]string, len(rows.columns))
+	for rows.next() {
+		for i := range record {
+			value := rows.value(i)
+			switch {
+			case value == nil:
+				record[i] = o.csvNull
+			case binary[i]:
+				record[i] = base64.StdEncoding.EncodeToString(value)
+			default:
+				record[i] = string(value)
+			}
+		}
+		err = w.Write(record)
+		if err != nil {
+			return 0, err
+		}
+	}
+	w.Flush()
+	if err := rows.done(); err != nil {
+		return rows.count, err
+	}
+	return rows.count, w.Error()
+}
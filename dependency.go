@@ -0,0 +1,106 @@
+package mysqldump
+
+import (
+	"context"
+	"strings"
+)
+
+// getForeignKeyDependencies 返回每个表引用的其它表, 忽略自引用
+func getForeignKeyDependencies(ctx context.Context, db queryer, dbName string) (map[string][]string, error) {
+	deps := make(map[string][]string)
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT TABLE_NAME, REFERENCED_TABLE_NAME FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = ? AND REFERENCED_TABLE_SCHEMA = ? AND REFERENCED_TABLE_NAME IS NOT NULL", dbName, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, referenced string
+		err = rows.Scan(&table, &referenced)
+		if err != nil {
+			return nil, err
+		}
+		if table != referenced {
+			deps[table] = append(deps[table], referenced)
+		}
+	}
+	return deps, rows.Err()
+}
+
+// sortByDependency 拓扑排序, 被依赖的对象排在前面, 无依赖关系的对象保持原顺序;
+// 不在 names 中的依赖被忽略. 存在循环依赖时返回原顺序和 false
+func sortByDependency(names []string, deps map[string][]string) ([]string, bool) {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+
+	// 每个对象尚未输出的依赖数, 以及依赖它的对象
+	pending := make([]int, len(names))
+	dependents := make([][]int, len(names))
+	for i, name := range names {
+		seen := make(map[int]bool)
+		for _, dep := range deps[name] {
+			j, ok := index[dep]
+			if !ok || j == i || seen[j] {
+				continue
+			}
+			seen[j] = true
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	done := make([]bool, len(names))
+	for len(sorted) < len(names) {
+		// 每次选原顺序中第一个没有未输出依赖的对象
+		next := -1
+		for i := range names {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			return names, false
+		}
+		done[next] = true
+		sorted = append(sorted, names[next])
+		for _, i := range dependents[next] {
+			pending[i]--
+		}
+	}
+	return sorted, true
+}
+
+// getViewDefinitions 返回每个视图的 VIEW_DEFINITION
+func getViewDefinitions(ctx context.Context, db queryer, dbName string) (map[string]string, error) {
+	definitions := make(map[string]string)
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_NAME, VIEW_DEFINITION FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ?", dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var view, definition string
+		err = rows.Scan(&view, &definition)
+		if err != nil {
+			return nil, err
+		}
+		definitions[view] = definition
+	}
+	return definitions, rows.Err()
+}
+
+// viewDependencies 返回每个视图引用的其它视图; MySQL 保存的视图定义中表名总是写成 `dbName`.`name`
+func viewDependencies(dbName string, definitions map[string]string) map[string][]string {
+	deps := make(map[string][]string)
+	for view, definition := range definitions {
+		for other := range definitions {
+			if other != view && strings.Contains(definition, qualifiedName(dbName, other)) {
+				deps[view] = append(deps[view], other)
+			}
+		}
+	}
+	return deps
+}
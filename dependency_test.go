@@ -0,0 +1,85 @@
+package mysqldump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_sortByDependency(t *testing.T) {
+	type args struct {
+		names []string
+		deps  map[string][]string
+	}
+	tests := []struct {
+		name   string
+		args   args
+		want   []string
+		wantOk bool
+	}{
+		{
+			name:   "no dependencies keeps order",
+			args:   args{names: []string{"c", "a", "b"}},
+			want:   []string{"c", "a", "b"},
+			wantOk: true,
+		},
+		{
+			name: "referenced tables first",
+			args: args{
+				names: []string{"order_items", "orders", "users", "products"},
+				deps: map[string][]string{
+					"order_items": {"orders", "products"},
+					"orders":      {"users"},
+				},
+			},
+			want:   []string{"users", "orders", "products", "order_items"},
+			wantOk: true,
+		},
+		{
+			name: "self reference and unknown table ignored",
+			args: args{
+				names: []string{"a", "b"},
+				deps:  map[string][]string{"a": {"a", "missing"}, "b": {"a"}},
+			},
+			want:   []string{"a", "b"},
+			wantOk: true,
+		},
+		{
+			name: "cycle falls back to original order",
+			args: args{
+				names: []string{"a", "b", "c"},
+				deps:  map[string][]string{"a": {"b"}, "b": {"a"}},
+			},
+			want:   []string{"a", "b", "c"},
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sortByDependency(tt.args.names, tt.args.deps)
+			if ok != tt.wantOk {
+				t.Errorf("sortByDependency() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortByDependency() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_viewDependencies(t *testing.T) {
+	definitions := map[string]string{
+		"b_view":   "select `test`.`a_view`.`id` AS `id` from `test`.`a_view` where (`test`.`a_view`.`id` > 1)",
+		"a_view":   "select `test`.`users`.`id` AS `id` from `test`.`users`",
+		"c_report": "select `b_view` AS `b_view` from `other`.`a_view`",
+	}
+	deps := viewDependencies("test", definitions)
+	want := map[string][]string{"b_view": {"a_view"}}
+	if !reflect.DeepEqual(deps, want) {
+		t.Fatalf("viewDependencies() = %v, want %v", deps, want)
+	}
+
+	got, ok := sortByDependency([]string{"b_view", "a_view", "c_report"}, deps)
+	if wantOrder := []string{"a_view", "b_view", "c_report"}; !ok || !reflect.DeepEqual(got, wantOrder) {
+		t.Errorf("sortByDependency() = %v, %v, want %v, true", got, ok, wantOrder)
+	}
+}
@@ -0,0 +1,124 @@
+package mysqldump
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// defaultCreateTable dumpFixture 默认的 SHOW CREATE TABLE 语句
+const defaultCreateTable = "CREATE TABLE `t` (\n  `id` int\n) ENGINE=InnoDB"
+
+// columnsHeader information_schema.COLUMNS 查询返回的列
+var columnsHeader = []string{"COLUMN_NAME", "EXTRA", "COLUMN_TYPE", "COLUMN_COMMENT", "CHARACTER_SET_NAME"}
+
+// dumpFixture 模拟完整 Dump 读取的 test 库, 测试只设置与默认不同的部分
+type dumpFixture struct {
+	// SHOW TABLES 返回的表
+	tables []string
+	// SHOW CREATE TABLE 返回的语句, 为空时为 defaultCreateTable
+	createTable string
+	// information_schema.COLUMNS 的行, 为空时只有 id int 一列
+	columns [][]driver.Value
+	// 返回表数据查询的结果, 为 nil 时每个表只有一行 id = 1
+	data func(query string) ([]string, [][]driver.Value)
+	// 在默认结果之前调用, ok 为 true 时使用返回的结果; 也可用于记录查询
+	query func(query string) (columns []string, values [][]driver.Value, ok bool)
+}
+
+func (f *dumpFixture) connector() *fakeConnector {
+	return &fakeConnector{rows: f.rows}
+}
+
+func (f *dumpFixture) rows(query string) ([]string, [][]driver.Value) {
+	if f.query != nil {
+		if columns, values, ok := f.query(query); ok {
+			return columns, values
+		}
+	}
+	switch {
+	case strings.HasPrefix(query, "SHOW TABLES"):
+		values := make([][]driver.Value, len(f.tables))
+		for i, table := range f.tables {
+			values[i] = []driver.Value{table}
+		}
+		return []string{"Tables_in_test"}, values
+	case strings.HasPrefix(query, "SELECT @@character_set_results"):
+		return []string{"@@character_set_results"}, [][]driver.Value{{"utf8mb4"}}
+	case strings.Contains(query, "information_schema.SCHEMATA"):
+		return []string{"DEFAULT_CHARACTER_SET_NAME", "DEFAULT_COLLATION_NAME"}, [][]driver.Value{{"utf8mb4", "utf8mb4_general_ci"}}
+	case strings.HasPrefix(query, "SHOW CREATE TABLE"):
+		createTable := f.createTable
+		if createTable == "" {
+			createTable = defaultCreateTable
+		}
+		return []string{"Table", "Create Table"}, [][]driver.Value{{"t", createTable}}
+	case strings.Contains(query, "information_schema.TABLES"):
+		return []string{"TABLE_COMMENT"}, [][]driver.Value{{""}}
+	case strings.Contains(query, "information_schema.COLUMNS"):
+		if len(f.columns) == 0 {
+			return columnsHeader, [][]driver.Value{{"id", "", "int", "", nil}}
+		}
+		return columnsHeader, f.columns
+	case strings.HasPrefix(query, "SELECT ") && strings.Contains(query, " FROM `"):
+		if f.data == nil {
+			return []string{"id"}, [][]driver.Value{{"1"}}
+		}
+		return f.data(query)
+	}
+	return nil, nil
+}
+
+// primaryKeyQuery 返回 dumpFixture.query, 表的主键为 columns
+func primaryKeyQuery(columns ...string) func(query string) ([]string, [][]driver.Value, bool) {
+	return func(query string) ([]string, [][]driver.Value, bool) {
+		if !strings.Contains(query, "KEY_COLUMN_USAGE") {
+			return nil, nil, false
+		}
+		values := make([][]driver.Value, len(columns))
+		for i, column := range columns {
+			values[i] = []driver.Value{column}
+		}
+		return []string{"COLUMN_NAME"}, values, true
+	}
+}
+
+// tableDumpConnector 返回有三个表 t1, t2, t3 的 fakeConnector, 每个表都有 rows; onQuery 不为 nil 时收到每个查询
+func tableDumpConnector(rows [][]driver.Value, onQuery func(query string)) *fakeConnector {
+	fixture := &dumpFixture{
+		tables:      []string{"t1", "t2", "t3"},
+		createTable: "CREATE TABLE `t` (\n  `id` int,\n  `v` varchar(20)\n) ENGINE=InnoDB",
+		columns:     [][]driver.Value{{"id", "", "int", "", nil}, {"v", "", "varchar(20)", "", "utf8mb4"}},
+		data: func(string) ([]string, [][]driver.Value) {
+			return []string{"id", "v"}, rows
+		},
+		query: func(query string) ([]string, [][]driver.Value, bool) {
+			if onQuery != nil {
+				onQuery(query)
+			}
+			return nil, nil, false
+		},
+	}
+	return fixture.connector()
+}
+
+// testTableColumns 返回 test.table 的列, 供直接调用 writeTableData 等函数的测试使用
+func testTableColumns(t *testing.T, db queryer, table string) []tableColumn {
+	t.Helper()
+	columns, err := getTableColumns(context.Background(), db, "test", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return columns
+}
+
+// testRows 返回 n 行 (id, v)
+func testRows(n int) [][]driver.Value {
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = []driver.Value{fmt.Sprint(i), strings.Repeat("x", 20)}
+	}
+	return rows
+}
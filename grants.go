@@ -0,0 +1,90 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"strings"
+)
+
+// account 一个 MySQL 账号 'user'@'host'
+type account struct {
+	user string
+	host string
+}
+
+func (a account) String() string {
+	return "'" + string(appendEscaped(nil, []byte(a.user))) + "'@'" + string(appendEscaped(nil, []byte(a.host))) + "'"
+}
+
+// getDatabaseAccounts 返回在 dbName 上有库级或表级权限的账号, 需要 mysql.db 和 mysql.tables_priv 的 SELECT 权限;
+// 库名中带通配符的授权 (如 `app\_%`.*) 不包含在内
+func getDatabaseAccounts(ctx context.Context, db queryer, dbName string) ([]account, error) {
+	rows, err := db.QueryContext(ctx, "SELECT User, Host FROM mysql.db WHERE Db = ? UNION SELECT User, Host FROM mysql.tables_priv WHERE Db = ? ORDER BY 1, 2", dbName, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var accounts []account
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.user, &a.host); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// getDatabaseGrants 返回账号的 SHOW GRANTS 中作用于 dbName 的 GRANT 语句, 全局权限和其它库的权限不包含在内
+func getDatabaseGrants(ctx context.Context, db queryer, dbName string, a account) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SHOW GRANTS FOR "+a.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	target := " ON " + quoteIdentifier(dbName) + "."
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return nil, err
+		}
+		if strings.Contains(grant, target) {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, rows.Err()
+}
+
+// writeGrants 写入 dbName 相关账号的 GRANT 语句; 默认写成注释, WithGrants(true) 时写成可执行的语句.
+// 账号本身 (CREATE USER 和密码) 不导出, 导入前需要先创建
+func writeGrants(ctx context.Context, db queryer, dbName string, buf *bufio.Writer, o *dumpOption) error {
+	accounts, err := getDatabaseAccounts(ctx, db, dbName)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+	writeComment(buf, o, "Grants for "+dbName)
+	prefix := "-- "
+	if o.isExecutableGrants {
+		prefix = ""
+	}
+	for _, a := range accounts {
+		grants, err := getDatabaseGrants(ctx, db, dbName, a)
+		if err != nil {
+			return err
+		}
+		for _, grant := range grants {
+			grant = o.renameQualifiers(grant, dbName)
+			if !o.isExecutableGrants {
+				// 账号名中的换行不能结束注释
+				grant = escapeComment(grant)
+			}
+			_, _ = buf.WriteString(prefix + grant + o.terminator + "\n")
+		}
+	}
+	_, _ = buf.WriteString("\n")
+	return nil
+}
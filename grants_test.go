@@ -0,0 +1,96 @@
+package mysqldump
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func Test_writeGrants(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []DumpOption
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "commented by default",
+			opts: []DumpOption{WithGrants(false)},
+			want: []string{
+				"-- GRANT SELECT, INSERT ON `test`.* TO `app`@`%`;\n",
+				"-- GRANT SELECT ON `test`.`t1` TO `o'neil`@`localhost`;\n",
+			},
+			notWant: []string{"\nGRANT", "ON *.*", "`other`"},
+		},
+		{
+			name: "executable",
+			opts: []DumpOption{WithGrants(true)},
+			want: []string{
+				"\nGRANT SELECT, INSERT ON `test`.* TO `app`@`%`;\n",
+				"\nGRANT SELECT ON `test`.`t1` TO `o'neil`@`localhost`;\n",
+			},
+			notWant: []string{"-- GRANT", "ON *.*"},
+		},
+		{
+			name:    "commented with no comments",
+			opts:    []DumpOption{WithGrants(false), WithNoComments()},
+			want:    []string{"-- GRANT SELECT, INSERT ON `test`.* TO `app`@`%`;\n"},
+			notWant: []string{"Grants for"},
+		},
+		{
+			name: "renamed database",
+			opts: []DumpOption{WithGrants(true), WithRenameDatabase("test_copy")},
+			want: []string{"\nGRANT SELECT, INSERT ON `test_copy`.* TO `app`@`%`;\n"},
+		},
+		{
+			name:    "disabled",
+			notWant: []string{"GRANT"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var showGrants []string
+			fixture := &dumpFixture{query: func(query string) ([]string, [][]driver.Value, bool) {
+				switch {
+				case strings.HasPrefix(query, "SELECT User, Host FROM mysql.db"):
+					return []string{"User", "Host"}, [][]driver.Value{{"app", "%"}, {"o'neil", "localhost"}}, true
+				case strings.HasPrefix(query, "SHOW GRANTS FOR 'app'@'%'"):
+					showGrants = append(showGrants, query)
+					return []string{"Grants"}, [][]driver.Value{
+						{"GRANT USAGE ON *.* TO `app`@`%`"},
+						{"GRANT SELECT, INSERT ON `test`.* TO `app`@`%`"},
+						{"GRANT ALL PRIVILEGES ON `other`.* TO `app`@`%`"},
+					}, true
+				case strings.HasPrefix(query, "SHOW GRANTS FOR"):
+					showGrants = append(showGrants, query)
+					return []string{"Grants"}, [][]driver.Value{{"GRANT SELECT ON `test`.`t1` TO `o'neil`@`localhost`"}}, true
+				}
+				return nil, nil, false
+			}}
+			connector := fixture.connector()
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			var b strings.Builder
+			err := Dump(db, "test", append(tt.opts, WithWriter(&b))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := b.String()
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("dump does not contain %q:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("dump contains %q:\n%s", notWant, got)
+				}
+			}
+			if tt.want != nil && (len(showGrants) != 2 || showGrants[1] != `SHOW GRANTS FOR 'o\'neil'@'localhost'`) {
+				t.Errorf("SHOW GRANTS queries = %q", showGrants)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package mysqldump
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// preserveZeroAutoIncrementSQL 在原有 sql_mode 上加入 NO_AUTO_VALUE_ON_ZERO, 由 restoreSQLModeSQL 恢复
+const (
+	preserveZeroAutoIncrementSQL = "/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE=CONCAT_WS(',', NULLIF(@@SQL_MODE, ''), 'NO_AUTO_VALUE_ON_ZERO') */"
+	restoreSQLModeSQL            = "/*!40101 SET SQL_MODE=@OLD_SQL_MODE */"
+)
+
+// writeHeader 写入 dump 开头的注释和会话设置, createDatabase 不为空时写在 USE 之前
+func writeHeader(buf *bufio.Writer, o *dumpOption, dbName, charset, createDatabase string, start time.Time) {
+	if !o.isNoComments {
+		_, _ = buf.WriteString("-- ----------------------------\n")
+		_, _ = buf.WriteString(dumpHeaderComment + "\n")
+		_, _ = buf.WriteString("-- Start Time: " + start.Format("2006-01-02 15:04:05") + "\n")
+		_, _ = buf.WriteString("-- Database Name: " + escapeComment(dbName) + "\n")
+		_, _ = buf.WriteString("-- ----------------------------\n")
+	}
+	if o.isCompatibleHeader {
+		writeCompatibleHeader(buf, o)
+	}
+	_, _ = buf.WriteString(fmt.Sprintf("SET NAMES %s%s\n\n", charset, o.terminator))
+	if o.isData && !o.isCompatibleHeader {
+		// 保留 AUTO_INCREMENT 列中显式的 0 值, 而不是导入时生成新的自增 ID
+		_, _ = buf.WriteString(preserveZeroAutoIncrementSQL + o.terminator + "\n\n")
+	}
+	if o.withTransaction {
+		_, _ = buf.WriteString("SET AUTOCOMMIT=0" + o.terminator + "\n")
+		_, _ = buf.WriteString("START TRANSACTION" + o.terminator + "\n\n")
+	}
+	if createDatabase != "" {
+		_, _ = buf.WriteString(createDatabase + o.terminator + "\n\n")
+	}
+	if o.withUseDatabase {
+		_, _ = buf.WriteString(fmt.Sprintf("USE %s%s\n\n", quoteIdentifier(o.targetDatabase(dbName)), o.terminator))
+	}
+	if o.isFastRestore && !o.isCompatibleHeader {
+		// 兼容头部已经保存并关闭了 UNIQUE_CHECKS
+		_, _ = buf.WriteString("SET UNIQUE_CHECKS=0" + o.terminator + "\n")
+	}
+	if !o.isNoForeignKeyChecksToggle {
+		_, _ = buf.WriteString("SET FOREIGN_KEY_CHECKS=0" + o.terminator + "\n\n")
+	} else if o.isFastRestore && !o.isCompatibleHeader {
+		_, _ = buf.WriteString("\n")
+	}
+	writeVerbatim(buf, o.prologue)
+}
+
+// writeVerbatim 原样写入 WithPrologue / WithEpilogue 的 SQL, 各自换行结尾, 最后空一行
+func writeVerbatim(buf *bufio.Writer, sqls []string) {
+	if len(sqls) == 0 {
+		return
+	}
+	for _, sql := range sqls {
+		_, _ = buf.WriteString(sql)
+		if !strings.HasSuffix(sql, "\n") {
+			_, _ = buf.WriteString("\n")
+		}
+	}
+	_, _ = buf.WriteString("\n")
+}
+
+// createDatabaseSQL 返回使用源库默认字符集和排序规则的 CREATE DATABASE IF NOT EXISTS 语句
+func createDatabaseSQL(dbName, charset, collation string) string {
+	return fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s CHARACTER SET %s COLLATE %s", quoteIdentifier(dbName), charset, collation)
+}
+
+// commentEscaper 把换行写为 \n 和 \r; 表名等可以包含换行, 原样写入时换行之后的文字成为可执行的语句 (CVE-2016-5483)
+var commentEscaper = strings.NewReplacer("\r", `\r`, "\n", `\n`)
+
+// escapeComment 返回可以放在一行 -- 注释中的文字
+func escapeComment(s string) string {
+	return commentEscaper.Replace(s)
+}
+
+// writeComment 写入一个 -- 注释块, WithNoComments 时不写入; comment 中的换行被转义
+func writeComment(buf *bufio.Writer, o *dumpOption, comment string) {
+	if o.isNoComments {
+		return
+	}
+	_, _ = buf.WriteString("-- ----------------------------\n")
+	_, _ = buf.WriteString("-- " + escapeComment(comment) + "\n")
+	_, _ = buf.WriteString("-- ----------------------------\n")
+}
+
+// dumpHeaderComment 和 dumpCompletedComment 是开头注释的标题和最后一行; 只有整个 dump 成功时才写入 dumpCompletedComment,
+// Source 读到开头注释却没有读到最后一行时, dump 可能不完整
+const (
+	dumpHeaderComment    = "-- MySQL Database Dump"
+	dumpCompletedComment = "-- Dump completed successfully"
+)
+
+// writeFooter 写入 dump 结尾的会话恢复和统计注释, 最后一行为 dumpCompletedComment
+func writeFooter(buf *bufio.Writer, o *dumpOption, start time.Time, tableCount int, totalRows uint64) {
+	writeVerbatim(buf, o.epilogue)
+	if !o.isNoForeignKeyChecksToggle {
+		_, _ = buf.WriteString("SET FOREIGN_KEY_CHECKS=1" + o.terminator + "\n")
+	}
+	if o.withTransaction {
+		_, _ = buf.WriteString("COMMIT" + o.terminator + "\n")
+		_, _ = buf.WriteString("SET AUTOCOMMIT=1" + o.terminator + "\n")
+	}
+	if o.isFastRestore && !o.isCompatibleHeader {
+		// 数据提交之后再恢复
+		_, _ = buf.WriteString("SET UNIQUE_CHECKS=1" + o.terminator + "\n")
+	}
+	if o.isData && !o.isCompatibleHeader {
+		_, _ = buf.WriteString(restoreSQLModeSQL + o.terminator + "\n")
+	}
+	if o.isCompatibleHeader {
+		writeCompatibleFooter(buf, o)
+	}
+	if o.isNoComments {
+		return
+	}
+	_, _ = buf.WriteString("-- ----------------------------\n")
+	_, _ = buf.WriteString("-- Dumped by mysqldump\n")
+	_, _ = buf.WriteString("-- Maintained by Yusta (https://github.com/NotYusta)\n")
+	_, _ = buf.WriteString("-- Cost Time: " + time.Since(start).String() + "\n")
+	_, _ = buf.WriteString("-- Complete Time: " + time.Now().Format("2006-01-02 15:04:05") + "\n")
+	_, _ = buf.WriteString("-- Table Counts: " + fmt.Sprintf("%d", tableCount) + "\n")
+	_, _ = buf.WriteString("-- Table Rows: " + fmt.Sprintf("%d", totalRows) + "\n")
+	_, _ = buf.WriteString("-- ----------------------------\n")
+	_, _ = buf.WriteString(dumpCompletedComment + "\n")
+}
+
+// compatibleHeaderStatements 与官方 mysqldump 相同的会话变量保存语句
+var compatibleHeaderStatements = []string{
+	"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */",
+	"/*!40101 SET @OLD_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS */",
+	"/*!40101 SET @OLD_COLLATION_CONNECTION=@@COLLATION_CONNECTION */",
+	"/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */",
+	"/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */",
+	"/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */",
+	"/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */",
+	"/*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */",
+}
+
+// compatibleFooterStatements 恢复 compatibleHeaderStatements 保存的会话变量
+var compatibleFooterStatements = []string{
+	"/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */",
+	restoreSQLModeSQL,
+	"/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */",
+	"/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */",
+	"/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */",
+	"/*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */",
+	"/*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */",
+	"/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */",
+}
+
+// writeCompatibleHeader 写入与官方 mysqldump 相同的会话变量保存语句
+func writeCompatibleHeader(buf *bufio.Writer, o *dumpOption) {
+	for _, stmt := range compatibleHeaderStatements {
+		if o.isNoForeignKeyChecksToggle && strings.Contains(stmt, "FOREIGN_KEY_CHECKS") {
+			continue
+		}
+		_, _ = buf.WriteString(stmt + o.terminator + "\n")
+	}
+	_, _ = buf.WriteString("\n")
+}
+
+// writeCompatibleFooter 恢复 writeCompatibleHeader 保存的会话变量
+func writeCompatibleFooter(buf *bufio.Writer, o *dumpOption) {
+	_, _ = buf.WriteString("\n")
+	for _, stmt := range compatibleFooterStatements {
+		if o.isNoForeignKeyChecksToggle && strings.Contains(stmt, "FOREIGN_KEY_CHECKS") {
+			continue
+		}
+		_, _ = buf.WriteString(stmt + o.terminator + "\n")
+	}
+	_, _ = buf.WriteString("\n")
+}
@@ -0,0 +1,403 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_writeNoComments(t *testing.T) {
+	tests := []struct {
+		name         string
+		o            dumpOption
+		wantComments bool
+	}{
+		{
+			name:         "with comments",
+			o:            dumpOption{withTransaction: true, terminator: ";"},
+			wantComments: true,
+		},
+		{
+			name: "no comments",
+			o:    dumpOption{withTransaction: true, isCompatibleHeader: true, isNoComments: true, terminator: ";"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			start := time.Now()
+			writeHeader(buf, &tt.o, "test", "utf8mb4", "", start)
+			writeComment(buf, &tt.o, "Table structure for t")
+			_, _ = buf.WriteString("CREATE TABLE IF NOT EXISTS `t` (`id` int);\n\n")
+			writeStoredProgram("PROCEDURE", "p", "CREATE PROCEDURE `p`() SELECT 1", buf, &tt.o)
+			writeFooter(buf, &tt.o, start, 1, 0)
+			_ = buf.Flush()
+			got := sb.String()
+
+			if hasComments := strings.Contains(got, "-- "); hasComments != tt.wantComments {
+				t.Fatalf("output contains comments = %v, want %v:\n%s", hasComments, tt.wantComments, got)
+			}
+			if tt.wantComments {
+				return
+			}
+			for _, line := range strings.Split(got, "\n") {
+				line = strings.TrimSpace(line)
+				if strings.HasPrefix(line, "--") || strings.HasPrefix(line, "#") ||
+					(strings.HasPrefix(line, "/*") && !strings.HasPrefix(line, "/*!")) {
+					t.Errorf("line %q is a comment", line)
+				}
+			}
+		})
+	}
+}
+
+func Test_writeHeaderPreserveZeroAutoIncrement(t *testing.T) {
+	tests := []struct {
+		name     string
+		o        dumpOption
+		wantMode bool
+	}{
+		{name: "with data", o: dumpOption{isData: true, terminator: ";"}, wantMode: true},
+		{name: "schema only", o: dumpOption{terminator: ";"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			start := time.Now()
+			writeHeader(buf, &tt.o, "test", "utf8mb4", "", start)
+			// AUTO_INCREMENT 主键为 0 的行
+			stmt := newQuotedInsertStatement(InsertStrategyInsert, quoteIdentifier("t"), "`id`,`name`", "")
+			w := newInsertWriter(stmt, buf, defaultInsertBatchSize, 0)
+			if err := w.writeRow([]byte("(0,'zero')")); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.flush(); err != nil {
+				t.Fatal(err)
+			}
+			writeFooter(buf, &tt.o, start, 1, 1)
+			_ = buf.Flush()
+			got := sb.String()
+
+			insert := strings.Index(got, "INSERT INTO `t` (`id`,`name`) VALUES (0,'zero');")
+			set := strings.Index(got, "'NO_AUTO_VALUE_ON_ZERO'")
+			restore := strings.Index(got, "SQL_MODE=@OLD_SQL_MODE")
+			if !tt.wantMode {
+				if set >= 0 || restore >= 0 {
+					t.Errorf("unexpected sql_mode change:\n%s", got)
+				}
+				return
+			}
+			if set < 0 || set > insert || restore < insert {
+				t.Errorf("NO_AUTO_VALUE_ON_ZERO must wrap the insert:\n%s", got)
+			}
+		})
+	}
+}
+
+func Test_writeHeaderCreateDatabase(t *testing.T) {
+	tests := []struct {
+		name      string
+		dbName    string
+		charset   string
+		collation string
+		want      string
+	}{
+		{
+			name:      "utf8mb4",
+			dbName:    "shop",
+			charset:   "utf8mb4",
+			collation: "utf8mb4_0900_ai_ci",
+			want:      "CREATE DATABASE IF NOT EXISTS `shop` CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci",
+		},
+		{
+			name:      "latin1 database with backtick",
+			dbName:    "le`gacy",
+			charset:   "latin1",
+			collation: "latin1_swedish_ci",
+			want:      "CREATE DATABASE IF NOT EXISTS `le``gacy` CHARACTER SET latin1 COLLATE latin1_swedish_ci",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createDatabase := createDatabaseSQL(tt.dbName, tt.charset, tt.collation)
+			if createDatabase != tt.want {
+				t.Fatalf("createDatabaseSQL() = %q, want %q", createDatabase, tt.want)
+			}
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			o := dumpOption{isCreateDatabase: true, withUseDatabase: true, terminator: ";"}
+			// SET NAMES 使用连接字符集, 与库的默认字符集无关
+			writeHeader(buf, &o, tt.dbName, "utf8mb4", createDatabase, time.Now())
+			_ = buf.Flush()
+			got := sb.String()
+			create := strings.Index(got, tt.want+";\n")
+			use := strings.Index(got, "USE "+quoteIdentifier(tt.dbName)+";")
+			if create < 0 || use < create {
+				t.Errorf("CREATE DATABASE must come before USE:\n%s", got)
+			}
+		})
+	}
+}
+
+func Test_writeHeaderTerminator(t *testing.T) {
+	var sb strings.Builder
+	buf := bufio.NewWriter(&sb)
+	o := dumpOption{withTransaction: true, withUseDatabase: true, isCompatibleHeader: true, isNoComments: true, terminator: "//"}
+	start := time.Now()
+	writeHeader(buf, &o, "test", "utf8mb4", "", start)
+	writeStoredProgram("PROCEDURE", "p", "CREATE PROCEDURE `p`() BEGIN SELECT 1; END", buf, &o)
+	writeFooter(buf, &o, start, 0, 0)
+	_ = buf.Flush()
+	got := sb.String()
+
+	for _, line := range strings.Split(got, "\n") {
+		if line == "" || strings.HasPrefix(line, "DELIMITER ") || strings.HasPrefix(line, "CREATE PROCEDURE") {
+			continue
+		}
+		if !strings.HasSuffix(line, "//") {
+			t.Errorf("line %q does not end with the terminator", line)
+		}
+	}
+	if !strings.Contains(got, "DELIMITER //\n") {
+		t.Errorf("DELIMITER is not restored to the terminator:\n%s", got)
+	}
+}
+
+func Test_renameDatabase(t *testing.T) {
+	o := dumpOption{withUseDatabase: true, isCreateDatabase: true, renameDatabase: "staging", terminator: ";"}
+
+	connector := &fakeConnector{rows: func(string) ([]string, [][]driver.Value) {
+		return []string{"DEFAULT_CHARACTER_SET_NAME", "DEFAULT_COLLATION_NAME"}, [][]driver.Value{{"utf8mb4", "utf8mb4_bin"}}
+	}}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	createDatabase, err := getCreateDatabaseSQL(context.Background(), db, "prod", o.targetDatabase("prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 字符集从源库读取
+	if len(connector.queryArgs) != 1 || !reflect.DeepEqual(connector.queryArgs[0], []any{"prod"}) {
+		t.Errorf("query args = %v, want [[prod]]", connector.queryArgs)
+	}
+
+	var sb strings.Builder
+	buf := bufio.NewWriter(&sb)
+	writeHeader(buf, &o, "prod", "utf8mb4", createDatabase, time.Now())
+	_ = buf.Flush()
+	got := sb.String()
+	for _, want := range []string{"CREATE DATABASE IF NOT EXISTS `staging` CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;\n", "USE `staging`;\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("header does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "USE `prod`") {
+		t.Errorf("header uses the source database:\n%s", got)
+	}
+
+	view := "CREATE ALGORITHM=UNDEFINED VIEW `v` AS select `prod`.`t`.`id` AS `id` from `prod`.`t`"
+	wantView := "CREATE ALGORITHM=UNDEFINED VIEW `v` AS select `staging`.`t`.`id` AS `id` from `staging`.`t`"
+	if got := o.renameQualifiers(view, "prod"); got != wantView {
+		t.Errorf("renameQualifiers() = %q, want %q", got, wantView)
+	}
+}
+
+func Test_writePrologueEpilogue(t *testing.T) {
+	o := dumpOption{isNoComments: true, terminator: ";"}
+	WithPrologue("SET SESSION sql_log_bin=0;")(&o)
+	WithPrologue("SET @restore=1;\n")(&o)
+	WithEpilogue("SET @restore=NULL;")(&o)
+
+	var sb strings.Builder
+	buf := bufio.NewWriter(&sb)
+	start := time.Now()
+	writeHeader(buf, &o, "test", "utf8mb4", "", start)
+	_, _ = buf.WriteString("CREATE TABLE IF NOT EXISTS `t` (`id` int);\n\n")
+	writeFooter(buf, &o, start, 1, 0)
+	_ = buf.Flush()
+	got := sb.String()
+
+	want := []string{
+		"SET FOREIGN_KEY_CHECKS=0;\n\n",
+		"SET SESSION sql_log_bin=0;\nSET @restore=1;\n\n",
+		"CREATE TABLE IF NOT EXISTS `t`",
+		"SET @restore=NULL;\n\n",
+		"SET FOREIGN_KEY_CHECKS=1;\n",
+	}
+	pos := 0
+	for _, w := range want {
+		i := strings.Index(got[pos:], w)
+		if i < 0 {
+			t.Fatalf("%q not found after offset %d:\n%s", w, pos, got)
+		}
+		pos += i + len(w)
+	}
+}
+
+func Test_writeWithoutForeignKeyChecksToggle(t *testing.T) {
+	tests := []struct {
+		name string
+		o    dumpOption
+		want bool
+	}{
+		{name: "default", o: dumpOption{terminator: ";"}, want: true},
+		{name: "compatible header", o: dumpOption{isCompatibleHeader: true, terminator: ";"}, want: true},
+		{name: "without toggle", o: dumpOption{isNoForeignKeyChecksToggle: true, terminator: ";"}},
+		{name: "compatible header without toggle", o: dumpOption{isCompatibleHeader: true, isNoForeignKeyChecksToggle: true, terminator: ";"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			start := time.Now()
+			writeHeader(buf, &tt.o, "test", "utf8mb4", "", start)
+			writeFooter(buf, &tt.o, start, 0, 0)
+			_ = buf.Flush()
+			got := sb.String()
+			if strings.Contains(got, "FOREIGN_KEY_CHECKS") != tt.want {
+				t.Errorf("output contains FOREIGN_KEY_CHECKS = %v, want %v:\n%s", !tt.want, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_writeFastRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []DumpOption
+		want []string
+		// 不应出现在输出中
+		notWant string
+	}{
+		{
+			name: "fast restore",
+			opts: []DumpOption{WithFastRestore()},
+			want: []string{
+				"SET AUTOCOMMIT=0;\nSTART TRANSACTION;\n\n",
+				"SET UNIQUE_CHECKS=0;\nSET FOREIGN_KEY_CHECKS=0;\n\n",
+				"INSERT INTO `t` VALUES (1);\n\n",
+				"SET FOREIGN_KEY_CHECKS=1;\nCOMMIT;\nSET AUTOCOMMIT=1;\nSET UNIQUE_CHECKS=1;\n",
+			},
+		},
+		{
+			name:    "compatible header",
+			opts:    []DumpOption{WithFastRestore(), WithCompatibleHeader()},
+			want:    []string{"START TRANSACTION;\n\n", "INSERT INTO `t`", "COMMIT;\n", "SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;\n"},
+			notWant: "SET UNIQUE_CHECKS=0;",
+		},
+		{
+			name:    "default",
+			want:    []string{"SET FOREIGN_KEY_CHECKS=0;\n\n", "INSERT INTO `t`"},
+			notWant: "UNIQUE_CHECKS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newDumpOption(append(tt.opts, WithNoComments()))
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			start := time.Now()
+			writeHeader(buf, &o, "test", "utf8mb4", "", start)
+			_, _ = buf.WriteString("INSERT INTO `t` VALUES (1);\n\n")
+			writeFooter(buf, &o, start, 1, 1)
+			_ = buf.Flush()
+			got := sb.String()
+
+			pos := 0
+			for _, w := range tt.want {
+				i := strings.Index(got[pos:], w)
+				if i < 0 {
+					t.Fatalf("%q not found after offset %d:\n%s", w, pos, got)
+				}
+				pos += i + len(w)
+			}
+			if tt.notWant != "" && strings.Contains(got, tt.notWant) {
+				t.Errorf("output contains %q:\n%s", tt.notWant, got)
+			}
+		})
+	}
+}
+
+func Test_dumpCompletedComment(t *testing.T) {
+	tests := []struct {
+		name string
+		// SHOW CREATE TABLE 返回错误的列数, 导出中途失败
+		failTable     bool
+		wantCompleted bool
+	}{
+		{name: "success", wantCompleted: true},
+		{name: "failed dump", failTable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := &dumpFixture{tables: []string{"t"}, query: func(query string) ([]string, [][]driver.Value, bool) {
+				if tt.failTable && strings.HasPrefix(query, "SHOW CREATE TABLE") {
+					return []string{"Table"}, [][]driver.Value{{"t"}}, true
+				}
+				return nil, nil, false
+			}}
+			connector := fixture.connector()
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			var b strings.Builder
+			err := Dump(db, "test", WithData(), WithWriter(&b))
+			if (err == nil) != tt.wantCompleted {
+				t.Fatalf("Dump() error = %v, want error %v", err, !tt.wantCompleted)
+			}
+			got := b.String()
+			if !strings.Contains(got, dumpHeaderComment) {
+				t.Fatalf("partial dump does not contain the header:\n%s", got)
+			}
+			if completed := strings.HasSuffix(got, dumpCompletedComment+"\n"); completed != tt.wantCompleted {
+				t.Errorf("dump ends with %q = %v, want %v:\n%s", dumpCompletedComment, completed, tt.wantCompleted, got)
+			}
+
+			// Source 对不完整的 dump 打印警告
+			logger := &recordingLogger{}
+			target := sql.OpenDB(&fakeConnector{})
+			defer target.Close()
+			if err := Source(target, "test", strings.NewReader(got), WithSourceLogger(logger)); err != nil {
+				t.Fatal(err)
+			}
+			if warned := logger.has("warn", "may be truncated"); warned == tt.wantCompleted {
+				t.Errorf("truncation warning = %v, want %v: %q", warned, !tt.wantCompleted, logger.entries)
+			}
+		})
+	}
+}
+
+// Test_commentNewline 名称中的换行不能结束 -- 注释, 否则换行之后的文字成为可执行的语句 (CVE-2016-5483)
+func Test_commentNewline(t *testing.T) {
+	const injected = "x\nDROP DATABASE prod;\r\nDROP DATABASE prod2;"
+	db := sql.OpenDB((&dumpFixture{tables: []string{injected}}).connector())
+	defer db.Close()
+
+	var b strings.Builder
+	if err := Dump(db, injected, WithData(), WithWriter(&b)); err != nil {
+		t.Fatal(err)
+	}
+	r := newStatementReader(strings.NewReader(b.String()))
+	for {
+		stmt, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(stmt, "DROP DATABASE") {
+			t.Errorf("name in a comment became a statement %q:\n%s", stmt, b.String())
+		}
+	}
+	if want := "-- Table structure for x\\nDROP DATABASE prod;\\r\\nDROP DATABASE prod2;\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("dump does not contain %q:\n%s", want, b.String())
+	}
+}
@@ -0,0 +1,74 @@
+package mysqldump
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// incremental WithIncremental 的设置
+type incremental struct {
+	column string
+	since  time.Time
+}
+
+// condition 返回只选择 column 晚于 since 的行的条件, since 按自身的时区格式化
+func (inc incremental) condition() string {
+	return quoteIdentifier(inc.column) + " > '" + inc.since.Format("2006-01-02 15:04:05.999999") + "'"
+}
+
+// dataCondition 返回导出表数据时的 WHERE 条件: WithWhere 的条件和 WithIncremental 的条件, 都没有时为空
+func (o *dumpOption) dataCondition(table string) string {
+	condition := o.whereConditions[table]
+	inc, ok := o.incrementals[table]
+	if !ok {
+		return condition
+	}
+	if condition == "" {
+		return inc.condition()
+	}
+	return "(" + condition + ") AND " + inc.condition()
+}
+
+// watermarkSet 收集 WithIncremental 的表读取到的最大值, 并发导出时由多个 goroutine 添加
+type watermarkSet struct {
+	mu     sync.Mutex
+	values map[string]time.Time
+}
+
+func (s *watermarkSet) add(table string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]time.Time)
+	}
+	s.values[table] = t
+}
+
+// watermarkColumn 跟踪一个表中 column 的最大值; DATE, DATETIME 和 TIMESTAMP 的文本格式固定, 按字节比较即按时间比较
+type watermarkColumn struct {
+	inc incremental
+	// column 在结果集中的位置
+	index int
+	max   []byte
+}
+
+func (w *watermarkColumn) observe(value []byte) {
+	if value != nil && (w.max == nil || bytes.Compare(value, w.max) > 0) {
+		w.max = append(w.max[:0], value...)
+	}
+}
+
+// watermark 返回读取到的最大值, 没有读取到行时为 since
+func (w *watermarkColumn) watermark() (time.Time, error) {
+	if w.max == nil {
+		return w.inc.since, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, string(w.max), w.inc.since.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("incremental column %s value %q is not a date or time", w.inc.column, w.max)
+}
@@ -0,0 +1,245 @@
+package mysqldump
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// insertStatement 一个表的 INSERT 语句中除数据外的部分
+type insertStatement struct {
+	// INSERT INTO `table` (columns) VALUES
+	prefix string
+	// ON DUPLICATE KEY UPDATE ..., 可为空
+	suffix string
+	// 语句结束符, 默认 ;
+	terminator string
+}
+
+// newQuotedInsertStatement quotedTable 已按 WithIdentifierQuote 加引号, columnNames 为空时不写列名, update 为空时不写 ON DUPLICATE KEY UPDATE
+func newQuotedInsertStatement(strategy InsertStrategy, quotedTable string, columnNames string, update string) insertStatement {
+	stmt := insertStatement{terminator: ";"}
+	if columnNames == "" {
+		stmt.prefix = fmt.Sprintf("%s %s VALUES ", strategy.verb(), quotedTable)
+	} else {
+		stmt.prefix = fmt.Sprintf("%s %s (%s) VALUES ", strategy.verb(), quotedTable, columnNames)
+	}
+	if update != "" {
+		stmt.suffix = " ON DUPLICATE KEY UPDATE " + update
+	}
+	return stmt
+}
+
+// overhead 返回语句中除数据外的字节数
+func (stmt insertStatement) overhead() int {
+	// 结束符和 \n
+	return len(stmt.prefix) + len(stmt.suffix) + len(stmt.terminator) + 1
+}
+
+// insertWriter 将行直接写入 buf, 不在内存中累积整条语句;
+// 每 batchSize 行或即将超过 maxSize 字节时结束当前 INSERT, maxSize 为 0 表示不限制
+type insertWriter struct {
+	stmt      insertStatement
+	buf       *bufio.Writer
+	batchSize int
+	maxSize   int
+	// 当前语句已写入的行数和字节数
+	rows int
+	size int
+}
+
+func newInsertWriter(stmt insertStatement, buf *bufio.Writer, batchSize, maxSize int) *insertWriter {
+	return &insertWriter{
+		stmt:      stmt,
+		buf:       buf,
+		batchSize: batchSize,
+		maxSize:   maxSize,
+	}
+}
+
+// writeRow 写入一行, tuple 形如 ('1','a'), 返回后可复用; 返回 buf 的写入错误
+func (w *insertWriter) writeRow(tuple []byte) error {
+	// 超出 max_allowed_packet 前先结束当前语句
+	if w.maxSize > 0 && w.rows > 0 && w.size+len(tuple)+1 > w.maxSize {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	if w.rows == 0 {
+		_, _ = w.buf.WriteString(w.stmt.prefix)
+		w.size = w.stmt.overhead()
+	} else {
+		_ = w.buf.WriteByte(',')
+		w.size++
+	}
+	_, err := w.buf.Write(tuple)
+	w.size += len(tuple)
+	w.rows++
+	if err == nil && w.rows >= w.batchSize {
+		err = w.flush()
+	}
+	return err
+}
+
+// flush 结束当前语句, 没有未结束的语句时不写入任何内容; 返回 buf 的写入错误
+func (w *insertWriter) flush() error {
+	if w.rows == 0 {
+		return bufferError(w.buf)
+	}
+	_, _ = w.buf.WriteString(w.stmt.suffix)
+	_, _ = w.buf.WriteString(w.stmt.terminator)
+	w.rows = 0
+	w.size = 0
+	return w.buf.WriteByte('\n')
+}
+
+// valueKind 决定列值的书写方式
+type valueKind int
+
+const (
+	// valueKindString 加引号并转义
+	valueKindString valueKind = iota
+	// valueKindBinary 十六进制字面量
+	valueKindBinary
+	// valueKindNumeric 原样输出, 不加引号
+	valueKindNumeric
+	// valueKindBoolean TINYINT(1) 列, 写成不加引号的整数, "true" / "false" 写成 1 / 0
+	valueKindBoolean
+	// valueKindSpatial 空间类型列, 写成内部格式 (4 字节 SRID + WKB) 的十六进制字面量
+	valueKindSpatial
+	// valueKindJSON JSON 列, 与字符串相同地加引号并转义
+	valueKindJSON
+)
+
+// columnKind 返回列类型对应的书写方式, typed 为 false 时数值也按字符串输出
+func columnKind(typeName string, typed bool) valueKind {
+	typeName = strings.TrimPrefix(strings.ToUpper(typeName), "UNSIGNED ")
+	switch typeName {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return valueKindBinary
+	case "BIT":
+		// BIT 的值是大端序的原始字节, 不是 "0"/"1" 文本; 写成字符串时可能不是有效的字符集编码,
+		// 十六进制字面量在 BIT 列中按数值导入
+		return valueKindBinary
+	case "JSON":
+		return valueKindJSON
+	case "ENUM", "SET":
+		// 文本协议总是返回成员名, 多个 SET 成员以逗号分隔, 空 SET 为空字符串 (NULL 为 nil);
+		// 不加引号的数字会被当作成员序号, 所以即使 typed 也必须加引号.
+		// ENUM 的错误值 '' (序号 0) 在严格模式下无法导入, 与 mysqldump 相同
+		return valueKindString
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+		if typed {
+			return valueKindNumeric
+		}
+	}
+	return valueKindString
+}
+
+// appendValue 将一个列值以 SQL 字面量追加到 dst, value 为 nil 表示 NULL
+func appendValue(dst []byte, value []byte, kind valueKind) []byte {
+	if value == nil {
+		return append(dst, "NULL"...)
+	}
+	switch kind {
+	case valueKindBinary:
+		return appendHexLiteral(dst, value)
+	case valueKindSpatial:
+		// 与 mysqldump --hex-blob 相同, 内部格式可直接插入空间列并保留 SRID; 不使用 ST_GeomFromWKB,
+		// 它对 MySQL 8 的地理坐标系按 SRS 的轴顺序解释 WKB, 而各版本的默认轴顺序不同
+		return appendHexLiteral(dst, value)
+	case valueKindNumeric:
+		return append(dst, value...)
+	case valueKindBoolean:
+		// go-sql-driver/mysql 的文本协议和预处理协议都把 TINYINT(1) 返回为 "0" / "1" 等整数文本, 与 DSN 参数无关
+		// (parseTime 只影响时间类型, 驱动没有布尔转换); "true" / "false" 只可能来自 WithRowRewriter 等改写
+		switch {
+		case bytes.EqualFold(value, []byte("true")):
+			return append(dst, '1')
+		case bytes.EqualFold(value, []byte("false")):
+			return append(dst, '0')
+		case isInteger(value):
+			return append(dst, value...)
+		}
+	case valueKindJSON:
+		// 服务器返回规范化的 JSON 文本, 其中字符串里的 \", \\ 和 \uXXXX 是 JSON 的转义;
+		// appendEscaped 逐字节转义, 导入时字符串字面量还原为完全相同的文本, JSON 转义不会被重复处理或丢失.
+		// 不使用十六进制字面量: JSON 列拒绝 binary 字符集的值
+	}
+	dst = append(dst, '\'')
+	dst = appendEscaped(dst, value)
+	return append(dst, '\'')
+}
+
+// appendIntroduced 把原始字节 value 写成带字符集前缀的字符串, 如 _latin1'caf\xe9';
+// 尾字节可能是 \ 或 ' 的多字节字符集写成十六进制, 避免转义破坏字符
+func appendIntroduced(dst []byte, value []byte, charset string) []byte {
+	if value == nil {
+		return append(dst, "NULL"...)
+	}
+	dst = append(dst, '_')
+	dst = append(dst, charset...)
+	switch charset {
+	case "big5", "cp932", "gbk", "gb18030", "sjis":
+		dst = append(dst, ' ')
+		return appendHexLiteral(dst, value)
+	}
+	dst = append(dst, '\'')
+	dst = appendEscaped(dst, value)
+	return append(dst, '\'')
+}
+
+// isInteger 判断 value 是否为可选负号加数字
+func isInteger(value []byte) bool {
+	if len(value) > 0 && value[0] == '-' {
+		value = value[1:]
+	}
+	if len(value) == 0 {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// appendEscaped 按 mysql_real_escape_string 的规则转义 s, 结果放在 '...' 字符串字面量中
+func appendEscaped(dst []byte, s []byte) []byte {
+	for _, c := range s {
+		switch c {
+		case '\\':
+			dst = append(dst, `\\`...)
+		case '\'':
+			dst = append(dst, `\'`...)
+		case '"':
+			dst = append(dst, `\"`...)
+		case '\n':
+			dst = append(dst, `\n`...)
+		case '\r':
+			dst = append(dst, `\r`...)
+		case 0:
+			dst = append(dst, `\0`...)
+		case '\032':
+			dst = append(dst, `\Z`...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// appendHexLiteral 把 value 写成十六进制字面量, 如 0xAB12
+func appendHexLiteral(dst []byte, value []byte) []byte {
+	const digits = "0123456789ABCDEF"
+	if len(value) == 0 {
+		return append(dst, "''"...)
+	}
+	dst = append(dst, "0x"...)
+	for _, b := range value {
+		dst = append(dst, digits[b>>4], digits[b&0x0f])
+	}
+	return dst
+}
@@ -0,0 +1,483 @@
+package mysqldump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_appendHexLiteral(t *testing.T) {
+	type args struct {
+		value []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "empty",
+			args: args{value: []byte{}},
+			want: "''",
+		},
+		{
+			name: "non utf8 bytes",
+			args: args{value: []byte{0x00, 0xab, 0x12, 0xff, '\'', '\\'}},
+			want: "0x00AB12FF275C",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(appendHexLiteral(nil, tt.args.value)); got != tt.want {
+				t.Errorf("appendHexLiteral() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendValueBinaryRoundTrip(t *testing.T) {
+	// 每个字节值各一次, 再加上随机字节
+	value := make([]byte, 256, 256+4096)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 4096; i++ {
+		value = append(value, byte(r.Intn(256)))
+	}
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "empty", value: []byte{}},
+		{name: "all bytes", value: value[:256]},
+		{name: "random", value: value[256:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			literal := string(appendValue(nil, tt.value, valueKindBinary))
+			if got := decodeHexLiteral(t, literal); !bytes.Equal(got, tt.value) {
+				t.Errorf("%s decodes to %x, want %x", literal, got, tt.value)
+			}
+		})
+	}
+}
+
+func Test_appendValueBitRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		// 驱动返回的大端序原始字节
+		value []byte
+		want  uint64
+	}{
+		{name: "bit(8) value 5", value: []byte{0x05}, want: 5},
+		{name: "bit(8) value 0", value: []byte{0x00}, want: 0},
+		{name: "bit(16) value 256", value: []byte{0x01, 0x00}, want: 256},
+		{name: "bit(64) max", value: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: math.MaxUint64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			literal := string(appendValue(nil, tt.value, columnKind("BIT", false)))
+			// BIT 列把十六进制字面量按大端序的无符号整数导入
+			var got uint64
+			for _, b := range decodeHexLiteral(t, literal) {
+				got = got<<8 | uint64(b)
+			}
+			if got != tt.want {
+				t.Errorf("%s imports as %d, want %d", literal, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendValuePointRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		srid uint32
+		x, y float64
+	}{
+		{name: "srid 0", srid: 0, x: 1, y: 2},
+		{name: "srid 4326", srid: 4326, x: 39.9042, y: 116.4074},
+		{name: "negative coordinates", srid: 3857, x: -8238310.24, y: -4970071.58},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 内部格式: 4 字节小端 SRID, 然后是小端 WKB POINT
+			value := binary.LittleEndian.AppendUint32(nil, tt.srid)
+			value = append(value, 1)
+			value = binary.LittleEndian.AppendUint32(value, 1)
+			value = binary.LittleEndian.AppendUint64(value, math.Float64bits(tt.x))
+			value = binary.LittleEndian.AppendUint64(value, math.Float64bits(tt.y))
+
+			literal := string(appendValue(nil, value, valueKindSpatial))
+			// 导入的值与原值 ST_Equals: SRID, 类型和坐标都相同
+			got := decodeHexLiteral(t, literal)
+			if len(got) != 25 || got[4] != 1 || binary.LittleEndian.Uint32(got[5:9]) != 1 {
+				t.Fatalf("%s is not a little-endian POINT", literal)
+			}
+			srid := binary.LittleEndian.Uint32(got[:4])
+			x := math.Float64frombits(binary.LittleEndian.Uint64(got[9:17]))
+			y := math.Float64frombits(binary.LittleEndian.Uint64(got[17:25]))
+			if srid != tt.srid || x != tt.x || y != tt.y {
+				t.Errorf("%s imports as SRID %d POINT(%v %v), want SRID %d POINT(%v %v)", literal, srid, x, y, tt.srid, tt.x, tt.y)
+			}
+		})
+	}
+}
+
+// decodeHexLiteral 还原 appendHexLiteral 写出的 0x... 字面量, 空值写为两个单引号
+func decodeHexLiteral(t *testing.T, literal string) []byte {
+	t.Helper()
+	if literal == "''" {
+		return []byte{}
+	}
+	digits, ok := strings.CutPrefix(literal, "0x")
+	if !ok {
+		t.Fatalf("%s is not a hex literal", literal)
+	}
+	value, err := hex.DecodeString(digits)
+	if err != nil {
+		t.Fatalf("decode %s: %v", literal, err)
+	}
+	return value
+}
+
+func Test_appendEscaped(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{name: "plain", args: args{s: "hello world"}, want: "hello world"},
+		{name: "single quote", args: args{s: "it's"}, want: `it\'s`},
+		{name: "double quote", args: args{s: `say "hi"`}, want: `say \"hi\"`},
+		{name: "backslash", args: args{s: `C:\path`}, want: `C:\\path`},
+		{name: "backslash quote", args: args{s: `\'`}, want: `\\\'`},
+		{name: "trailing backslash", args: args{s: `abc\`}, want: `abc\\`},
+		{name: "newline and carriage return", args: args{s: "a\r\nb"}, want: `a\r\nb`},
+		{name: "nul byte", args: args{s: "a\x00b"}, want: `a\0b`},
+		{name: "ctrl z", args: args{s: "a\x1ab"}, want: `a\Zb`},
+		{name: "tab is kept", args: args{s: "a\tb"}, want: "a\tb"},
+		{name: "multibyte", args: args{s: "héllo 😀'"}, want: `héllo 😀\'`},
+		{name: "statement injection", args: args{s: "'); DROP TABLE t; --"}, want: `\'); DROP TABLE t; --`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(appendEscaped(nil, []byte(tt.args.s))); got != tt.want {
+				t.Errorf("appendEscaped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendValue(t *testing.T) {
+	// 混合类型的一行: 列类型, 值, 是否 WithTypedValues
+	type args struct {
+		typeName string
+		value    []byte
+		typed    bool
+		// TINYINT(1) 列
+		boolean bool
+		// 空间类型列
+		spatial bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{name: "null", args: args{typeName: "INT", value: nil, typed: true}, want: "NULL"},
+		{name: "int untyped", args: args{typeName: "INT", value: []byte("42")}, want: "'42'"},
+		{name: "int typed", args: args{typeName: "INT", value: []byte("42"), typed: true}, want: "42"},
+		{name: "unsigned bigint typed", args: args{typeName: "UNSIGNED BIGINT", value: []byte("18446744073709551615"), typed: true}, want: "18446744073709551615"},
+		{name: "decimal typed", args: args{typeName: "DECIMAL", value: []byte("-1234.56"), typed: true}, want: "-1234.56"},
+		{name: "double typed", args: args{typeName: "DOUBLE", value: []byte("1.5e-7"), typed: true}, want: "1.5e-7"},
+		{name: "tinyint typed", args: args{typeName: "TINYINT", value: []byte("1"), typed: true}, want: "1"},
+		{name: "bit typed", args: args{typeName: "BIT", value: []byte{0x66}, typed: true}, want: "0x66"},
+		{name: "bit(8) value 5", args: args{typeName: "BIT", value: []byte{0x05}}, want: "0x05"},
+		{name: "bit(16) untyped", args: args{typeName: "BIT", value: []byte{0x01, 0x00}}, want: "0x0100"},
+		{name: "varchar typed", args: args{typeName: "VARCHAR", value: []byte("42"), typed: true}, want: "'42'"},
+		{name: "empty varchar", args: args{typeName: "VARCHAR", value: []byte{}}, want: "''"},
+		{name: "datetime typed", args: args{typeName: "DATETIME", value: []byte("2023-03-17 10:00:00"), typed: true}, want: "'2023-03-17 10:00:00'"},
+		{name: "blob", args: args{typeName: "BLOB", value: []byte{0xab}}, want: "0xAB"},
+		{name: "set multiple members", args: args{typeName: "SET", value: []byte("a,b"), typed: true}, want: "'a,b'"},
+		{name: "set empty", args: args{typeName: "SET", value: []byte{}, typed: true}, want: "''"},
+		{name: "set null", args: args{typeName: "SET", value: nil, typed: true}, want: "NULL"},
+		{name: "enum numeric member typed", args: args{typeName: "ENUM", value: []byte("2"), typed: true}, want: "'2'"},
+		{name: "enum with quote", args: args{typeName: "ENUM", value: []byte("it's")}, want: "'it\\'s'"},
+		{name: "tinyint(1) stores 1", args: args{typeName: "TINYINT", value: []byte("1"), boolean: true}, want: "1"},
+		{name: "tinyint(1) stores 0", args: args{typeName: "TINYINT", value: []byte("0"), boolean: true}, want: "0"},
+		{name: "tinyint(1) out of range", args: args{typeName: "TINYINT", value: []byte("-128"), boolean: true}, want: "-128"},
+		{name: "tinyint(1) rewritten true", args: args{typeName: "TINYINT", value: []byte("TRUE"), boolean: true}, want: "1"},
+		{name: "tinyint(1) rewritten false", args: args{typeName: "TINYINT", value: []byte("false"), boolean: true}, want: "0"},
+		{name: "tinyint(1) null", args: args{typeName: "TINYINT", value: nil, boolean: true}, want: "NULL"},
+		{name: "tinyint(1) other text", args: args{typeName: "TINYINT", value: []byte("yes"), boolean: true}, want: "'yes'"},
+		// POINT(1 2), SRID 0: 4 字节 SRID, 字节序 1 (小端), 类型 1 (POINT), x = 1.0, y = 2.0
+		{
+			name: "point srid 0",
+			args: args{typeName: "GEOMETRY", spatial: true, value: []byte{
+				0, 0, 0, 0, 1, 1, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0xf0, 0x3f,
+				0, 0, 0, 0, 0, 0, 0, 0x40,
+			}},
+			want: "0x000000000101000000000000000000F03F0000000000000040",
+		},
+		{
+			name: "point srid 4326 reported as blob",
+			args: args{typeName: "BLOB", spatial: true, value: []byte{0xe6, 0x10, 0, 0, 1, 1, 0, 0, 0}},
+			want: "0xE61000000101000000",
+		},
+		{name: "point null", args: args{typeName: "GEOMETRY", spatial: true, value: nil}, want: "NULL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind := columnKind(tt.args.typeName, tt.args.typed)
+			if tt.args.boolean {
+				kind = valueKindBoolean
+			}
+			if tt.args.spatial {
+				kind = valueKindSpatial
+			}
+			if got := string(appendValue(nil, tt.args.value, kind)); got != tt.want {
+				t.Errorf("appendValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_insertWriter(t *testing.T) {
+	type args struct {
+		strategy    InsertStrategy
+		table       string
+		columnNames string
+		update      string
+		batchSize   int
+		maxSize     int
+		terminator  string
+		rows        []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "complete insert",
+			args: args{table: "t", columnNames: "`a`,`b`", rows: []string{"('1','x')", "('2',NULL)"}},
+			want: "INSERT INTO `t` (`a`,`b`) VALUES ('1','x'),('2',NULL);\n",
+		},
+		{
+			name: "without column names",
+			args: args{table: "t", rows: []string{"('1','x')"}},
+			want: "INSERT INTO `t` VALUES ('1','x');\n",
+		},
+		{
+			name: "table name with backtick",
+			args: args{table: "we`ird; DROP TABLE x", rows: []string{"('1')"}},
+			want: "INSERT INTO `we``ird; DROP TABLE x` VALUES ('1');\n",
+		},
+		{
+			name: "insert ignore",
+			args: args{strategy: InsertStrategyIgnore, table: "t", columnNames: "`a`", rows: []string{"('1')"}},
+			want: "INSERT IGNORE INTO `t` (`a`) VALUES ('1');\n",
+		},
+		{
+			name: "replace",
+			args: args{strategy: InsertStrategyReplace, table: "t", columnNames: "`a`", rows: []string{"('1')"}},
+			want: "REPLACE INTO `t` (`a`) VALUES ('1');\n",
+		},
+		{
+			name: "upsert",
+			args: args{table: "t", columnNames: "`id`,`a`", update: "`a`=VALUES(`a`)", rows: []string{"('1','x')", "('2','y')"}},
+			want: "INSERT INTO `t` (`id`,`a`) VALUES ('1','x'),('2','y') ON DUPLICATE KEY UPDATE `a`=VALUES(`a`);\n",
+		},
+		{
+			name: "batch size",
+			args: args{table: "t", batchSize: 2, rows: []string{"('1')", "('2')", "('3')"}},
+			want: "INSERT INTO `t` VALUES ('1'),('2');\nINSERT INTO `t` VALUES ('3');\n",
+		},
+		{
+			name: "max size",
+			// INSERT INTO `t` VALUES ('1'),('2');\n is 36 bytes
+			args: args{table: "t", maxSize: 35, rows: []string{"('1')", "('2')", "('3')"}},
+			want: "INSERT INTO `t` VALUES ('1');\nINSERT INTO `t` VALUES ('2');\nINSERT INTO `t` VALUES ('3');\n",
+		},
+		{
+			name: "custom terminator",
+			// INSERT INTO `t` VALUES ('1'),('2')//\n is 37 bytes
+			args: args{table: "t", maxSize: 36, terminator: "//", rows: []string{"('1')", "('2')"}},
+			want: "INSERT INTO `t` VALUES ('1')//\nINSERT INTO `t` VALUES ('2')//\n",
+		},
+		{
+			name: "no rows",
+			args: args{table: "t"},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.args.batchSize == 0 {
+				tt.args.batchSize = defaultInsertBatchSize
+			}
+			var b bytes.Buffer
+			buf := bufio.NewWriter(&b)
+			stmt := newQuotedInsertStatement(tt.args.strategy, quoteIdentifier(tt.args.table), tt.args.columnNames, tt.args.update)
+			if tt.args.terminator != "" {
+				stmt.terminator = tt.args.terminator
+			}
+			w := newInsertWriter(stmt, buf, tt.args.batchSize, tt.args.maxSize)
+			for _, row := range tt.args.rows {
+				if err := w.writeRow([]byte(row)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := buf.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("insertWriter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkInsertWriter(b *testing.B) {
+	// 模拟 100 万行的表, 每行一个整数, 一个字符串和一个二进制列
+	const rowCount = 1000000
+	text := []byte("it's a \"synthetic\" row\n")
+	blob := []byte{0x00, 0xff, 0x10, 0x20}
+	columnNames := "`id`,`text`,`blob`"
+
+	b.Run("insertWriter", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := bufio.NewWriter(io.Discard)
+			stmt := newQuotedInsertStatement(InsertStrategyInsert, quoteIdentifier("t"), columnNames, "")
+			w := newInsertWriter(stmt, buf, defaultInsertBatchSize, 0)
+			var tuple []byte
+			for row := 0; row < rowCount; row++ {
+				tuple = append(tuple[:0], '(')
+				tuple = appendValue(tuple, []byte("12345"), valueKindNumeric)
+				tuple = append(tuple, ',')
+				tuple = appendValue(tuple, text, valueKindString)
+				tuple = append(tuple, ',')
+				tuple = appendValue(tuple, blob, valueKindBinary)
+				tuple = append(tuple, ')')
+				if err := w.writeRow(tuple); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := w.flush(); err != nil {
+				b.Fatal(err)
+			}
+			if err := buf.Flush(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// 改为流式写入之前的做法: 每行的值拼成 []string, 一批行再用 strings.Join 拼成整条语句后写入
+	b.Run("join", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := bufio.NewWriter(io.Discard)
+			var tuples []string
+			write := func() {
+				_, _ = buf.WriteString(fmt.Sprintf("INSERT INTO `t` (%s) VALUES %s;\n", columnNames, strings.Join(tuples, ",")))
+				tuples = []string{}
+			}
+			for row := 0; row < rowCount; row++ {
+				values := make([]string, 3)
+				values[0] = string(appendValue(nil, []byte("12345"), valueKindNumeric))
+				values[1] = string(appendValue(nil, text, valueKindString))
+				values[2] = string(appendValue(nil, blob, valueKindBinary))
+				tuples = append(tuples, "("+strings.Join(values, ",")+")")
+				if len(tuples) >= defaultInsertBatchSize {
+					write()
+				}
+			}
+			if len(tuples) > 0 {
+				write()
+			}
+			if err := buf.Flush(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// unescapeStringLiteral 按 MySQL (未开启 NO_BACKSLASH_ESCAPES) 的规则还原 '...' 字符串字面量
+func unescapeStringLiteral(t *testing.T, literal string) string {
+	t.Helper()
+	if len(literal) < 2 || literal[0] != '\'' || literal[len(literal)-1] != '\'' {
+		t.Fatalf("%s is not a string literal", literal)
+	}
+	escapes := map[byte]byte{'0': 0, 'n': '\n', 'r': '\r', 'Z': '\032', 't': '\t', 'b': '\b'}
+	var b strings.Builder
+	s := literal[1 : len(literal)-1]
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			if e, ok := escapes[s[i]]; ok {
+				b.WriteByte(e)
+			} else {
+				b.WriteByte(s[i])
+			}
+		case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+			b.WriteByte('\'')
+		case c == '\'':
+			t.Fatalf("unescaped quote in %s", literal)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func Test_appendValueJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "quotes", value: `{"say": "it's \"quoted\""}`},
+		{name: "backslashes", value: `{"path": "C:\\temp\\new", "regex": "\\d+\\.\\d+"}`},
+		{name: "unicode escapes", value: `{"emoji": "\ud83d\ude00", "nul": "\u0000", "name": "caf\u00e9 中文"}`},
+		{name: "newline escape and array", value: `["line1\nline2", 1.5, null, true, {"": ""}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind := columnKind("JSON", true)
+			literal := string(appendValue(nil, []byte(tt.value), kind))
+			imported := unescapeStringLiteral(t, literal)
+			if imported != tt.value {
+				t.Fatalf("imported %s, want %s", imported, tt.value)
+			}
+			var got, want any
+			if err := json.Unmarshal([]byte(imported), &got); err != nil {
+				t.Fatalf("imported value is not valid JSON: %v", err)
+			}
+			_ = json.Unmarshal([]byte(tt.value), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("imported document = %v, want %v", got, want)
+			}
+		})
+	}
+}
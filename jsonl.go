@@ -0,0 +1,117 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"unicode/utf8"
+)
+
+// writeTableJSONL 以 JSON Lines 写出表数据. 第一行为 {"table":...,"columns":[...]}, 之后每行一个对象,
+// 键为列名; 数值列写为 JSON 数字, NULL 写为 null, 二进制列写为 base64 字符串
+func writeTableJSONL(ctx context.Context, db queryer, dbName, table string, columns []tableColumn, buf *bufio.Writer, o *dumpOption) (uint64, error) {
+	rows, err := queryTableRows(ctx, db, dbName, table, columns, o)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.close()
+
+	kinds := make([]valueKind, len(rows.types))
+	for i, columnType := range rows.types {
+		kinds[i] = columnKind(columnType.DatabaseTypeName(), true)
+		if rows.spatial[i] {
+			kinds[i] = valueKindBinary
+		}
+	}
+	// 键在各行中相同, 预先编码
+	keys := make([][]byte, len(rows.columns))
+	header := append([]byte(`{"table":`), appendJSONString(nil, []byte(table))...)
+	header = append(header, `,"columns":[`...)
+	for i, column := range rows.columns {
+		keys[i] = appendJSONString(nil, []byte(column))
+		if i > 0 {
+			header = append(header, ',')
+		}
+		header = append(header, keys[i]...)
+	}
+	header = append(header, "]}\n"...)
+	_, _ = buf.Write(header)
+
+	var line []byte
+	values := make([][]byte, len(rows.columns))
+	for rows.next() {
+		for i := range values {
+			values[i] = rows.value(i)
+		}
+		line = appendJSONObject(line[:0], keys, values, kinds)
+		line = append(line, '\n')
+		if _, err := buf.Write(line); err != nil {
+			return rows.count, err
+		}
+	}
+	if err := rows.done(); err != nil {
+		return rows.count, err
+	}
+	return rows.count, nil
+}
+
+// appendJSONObject 把一行写成 JSON 对象, keys 为已编码的列名
+func appendJSONObject(dst []byte, keys [][]byte, values [][]byte, kinds []valueKind) []byte {
+	dst = append(dst, '{')
+	for i, value := range values {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, keys[i]...)
+		dst = append(dst, ':')
+		switch {
+		case value == nil:
+			dst = append(dst, "null"...)
+		case kinds[i] == valueKindNumeric:
+			dst = append(dst, value...)
+		case kinds[i] == valueKindBinary:
+			dst = append(dst, '"')
+			dst = base64.StdEncoding.AppendEncode(dst, value)
+			dst = append(dst, '"')
+		default:
+			dst = appendJSONString(dst, value)
+		}
+	}
+	return append(dst, '}')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString 把 s 写成 JSON 字符串, 无效的 UTF-8 替换为 U+FFFD
+func appendJSONString(dst []byte, s []byte) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, "\uFFFD"...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(dst, '"')
+}
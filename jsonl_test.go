@@ -0,0 +1,51 @@
+package mysqldump
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func Test_appendJSONObject(t *testing.T) {
+	keys := [][]byte{
+		appendJSONString(nil, []byte("id")),
+		appendJSONString(nil, []byte("name")),
+		appendJSONString(nil, []byte("note")),
+		appendJSONString(nil, []byte("data")),
+	}
+	kinds := []valueKind{valueKindNumeric, valueKindString, valueKindString, valueKindBinary}
+	tests := []struct {
+		name   string
+		values [][]byte
+		want   string
+		decode map[string]any
+	}{
+		{
+			name:   "quotes and newlines",
+			values: [][]byte{[]byte("1"), []byte(`say "hi"` + "\n\\ \t\r"), []byte("a\x00b\x1f"), {0x00, 0xFF}},
+			want:   `{"id":1,"name":"say \"hi\"\n\\ \t\r","note":"a\u0000b\u001f","data":"AP8="}`,
+			decode: map[string]any{"id": 1.0, "name": "say \"hi\"\n\\ \t\r", "note": "a\x00b\x1f", "data": "AP8="},
+		},
+		{
+			name:   "null and unicode",
+			values: [][]byte{[]byte("-2.5"), nil, []byte("中文 \xff"), {}},
+			want:   `{"id":-2.5,"name":null,"note":"中文 �","data":""}`,
+			decode: map[string]any{"id": -2.5, "name": nil, "note": "中文 �", "data": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendJSONObject(nil, keys, tt.values, kinds)
+			if string(got) != tt.want {
+				t.Errorf("appendJSONObject() = %s, want %s", got, tt.want)
+			}
+			var decoded map[string]any
+			if err := json.Unmarshal(got, &decoded); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.decode) {
+				t.Errorf("decoded = %v, want %v", decoded, tt.decode)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package mysqldump
+
+import (
+	"log"
+)
+
+// Logger 接收 Dump 和 Source 的诊断信息, 可以接入 zap, zerolog 等日志库.
+// 方法可能被多个 goroutine 同时调用 (WithParallelism), 实现需要并发安全
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// nopLogger 默认的 Logger, 不输出任何内容; 需要诊断信息时通过 WithLogger 或 WithSourceLogger 传入
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...any) {}
+func (nopLogger) Infof(string, ...any)  {}
+func (nopLogger) Warnf(string, ...any)  {}
+func (nopLogger) Errorf(string, ...any) {}
+
+// stdLogger 使用标准库 log 打印全部级别, Source 使用 WithDebug 且没有 WithSourceLogger 时使用
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...any) {
+	log.Printf("[debug] "+format+"\n", args...)
+}
+
+func (stdLogger) Infof(format string, args ...any) {
+	log.Printf("[info] "+format+"\n", args...)
+}
+
+func (stdLogger) Warnf(format string, args ...any) {
+	log.Printf("[warn] "+format+"\n", args...)
+}
+
+func (stdLogger) Errorf(format string, args ...any) {
+	log.Printf("[error] "+format+"\n", args...)
+}
@@ -0,0 +1,133 @@
+package mysqldump
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger 按级别记录日志
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) add(level, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...any) { l.add("debug", format, args...) }
+func (l *recordingLogger) Infof(format string, args ...any)  { l.add("info", format, args...) }
+func (l *recordingLogger) Warnf(format string, args ...any)  { l.add("warn", format, args...) }
+func (l *recordingLogger) Errorf(format string, args ...any) { l.add("error", format, args...) }
+
+// has 是否有 level 级别且包含 substr 的日志
+func (l *recordingLogger) has(level, substr string) bool {
+	for _, entry := range l.entries {
+		if strings.HasPrefix(entry, level+" ") && strings.Contains(entry, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_dumpLogger(t *testing.T) {
+	fixture := &dumpFixture{tables: []string{"t1"}}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	logger := &recordingLogger{}
+	var b strings.Builder
+	err := Dump(db, "test", WithTables("missing"), WithIgnoreMissingTables(), WithNoData(), WithLogger(logger), WithWriter(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !logger.has("warn", `tables not found in test, skipping: ["missing"]`) {
+		t.Errorf("missing table warning not logged: %q", logger.entries)
+	}
+	if !logger.has("info", "dumped test: 0 tables") {
+		t.Errorf("dump summary not logged: %q", logger.entries)
+	}
+}
+
+func Test_sourceLogger(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	logger := &recordingLogger{}
+	input := "INSERT INTO `t` VALUES (1);\nINSERT INTO `t` VALUES (boom);\n"
+	_, err := SourceWithResult(db, "test", strings.NewReader(input), WithForceContinue(), WithSourceLogger(logger))
+	if err == nil {
+		t.Fatal("Source() error = nil, want statement error")
+	}
+	want := []struct {
+		level  string
+		substr string
+	}{
+		{"debug", "[sql] INSERT INTO `t` VALUES (1)"},
+		{"error", "statement #2 failed: syntax error near boom"},
+		{"info", "sourced test: 1 statements succeeded, 1 failed"},
+	}
+	for _, w := range want {
+		if !logger.has(w.level, w.substr) {
+			t.Errorf("%s %q not logged: %q", w.level, w.substr, logger.entries)
+		}
+	}
+}
+
+func Test_sourceLoggerFailedStatement(t *testing.T) {
+	long := "INSERT INTO `t` VALUES (boom)" + strings.Repeat(",('x')", 1000) + ";\n"
+	tests := []struct {
+		name  string
+		input string
+		opts  []SourceOption
+		want  string
+		// 写入 Errorf 的语句被截断
+		truncated bool
+	}{
+		{
+			name:  "serial",
+			input: "INSERT INTO `t` VALUES (boom);\n",
+			want:  "statement #1 failed: syntax error near boom: INSERT INTO `t` VALUES (boom)",
+		},
+		{
+			name:  "parallel",
+			input: "INSERT INTO `t` VALUES (boom);\n",
+			opts:  []SourceOption{WithSourceParallelism(2)},
+			want:  "statement #1 failed: syntax error near boom: INSERT INTO `t` VALUES (boom)",
+		},
+		{
+			name:      "long statement",
+			input:     long,
+			want:      fmt.Sprintf("... (%d bytes)", len(long)-2),
+			truncated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sql.OpenDB(&fakeConnector{})
+			defer db.Close()
+
+			logger := &recordingLogger{}
+			opts := append([]SourceOption{WithSourceLogger(logger)}, tt.opts...)
+			if err := Source(db, "test", strings.NewReader(tt.input), opts...); err == nil {
+				t.Fatal("Source() error = nil, want statement error")
+			}
+			if !logger.has("error", tt.want) {
+				t.Errorf("error %q not logged: %q", tt.want, logger.entries)
+			}
+			for _, entry := range logger.entries {
+				if tt.truncated && strings.HasPrefix(entry, "error ") && len(entry) > maxLoggedStatement+200 {
+					t.Errorf("logged %d bytes of a %d byte statement", len(entry), len(tt.input))
+				}
+			}
+		})
+	}
+}
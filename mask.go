@@ -0,0 +1,49 @@
+package mysqldump
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+)
+
+// MaskFunc 返回 table.column 的值 value 脱敏后的值
+type MaskFunc func(table, column, value string) string
+
+// MaskHash 返回 value 的 SHA-256 的前 16 个十六进制字符, 相同的值脱敏后相同, 外键等关联关系保持不变
+func MaskHash(table, column, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// MaskString 返回把所有值替换为 s 的 MaskFunc
+func MaskString(s string) MaskFunc {
+	return func(table, column, value string) string {
+		return s
+	}
+}
+
+// maskRowRewriter 返回对 columns (table -> 列名) 中的列调用 mask 的行改写函数, NULL 保持为 NULL;
+// next 不为 nil 时先调用 next, 保证脱敏后的值不会再被改写
+func maskRowRewriter(columns map[string][]string, mask MaskFunc, next func(table string, columns []string, values []sql.NullString)) func(table string, columns []string, values []sql.NullString) {
+	masked := make(map[string]map[string]bool, len(columns))
+	for table, cols := range columns {
+		masked[table] = make(map[string]bool, len(cols))
+		for _, col := range cols {
+			masked[table][col] = true
+		}
+	}
+	return func(table string, columns []string, values []sql.NullString) {
+		if next != nil {
+			next(table, columns, values)
+		}
+		tableMasked := masked[table]
+		if len(tableMasked) == 0 {
+			return
+		}
+		for i, column := range columns {
+			if tableMasked[column] && values[i].Valid {
+				values[i].String = mask(table, column, values[i].String)
+			}
+		}
+	}
+}
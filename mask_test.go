@@ -0,0 +1,68 @@
+package mysqldump
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_maskRowRewriter(t *testing.T) {
+	columns := []string{"id", "email", "phone"}
+	tests := []struct {
+		name   string
+		table  string
+		mask   MaskFunc
+		next   func(table string, columns []string, values []sql.NullString)
+		values []sql.NullString
+		want   []sql.NullString
+	}{
+		{
+			name:   "fixed string keeps null",
+			table:  "users",
+			mask:   MaskString("***"),
+			values: []sql.NullString{{String: "1", Valid: true}, {String: "a@b.c", Valid: true}, {}},
+			want:   []sql.NullString{{String: "1", Valid: true}, {String: "***", Valid: true}, {}},
+		},
+		{
+			name:   "other table untouched",
+			table:  "orders",
+			mask:   MaskString("***"),
+			values: []sql.NullString{{String: "1", Valid: true}, {String: "a@b.c", Valid: true}, {String: "123", Valid: true}},
+			want:   []sql.NullString{{String: "1", Valid: true}, {String: "a@b.c", Valid: true}, {String: "123", Valid: true}},
+		},
+		{
+			name:  "mask after next rewriter",
+			table: "users",
+			mask:  MaskString("***"),
+			next: func(table string, columns []string, values []sql.NullString) {
+				values[1] = sql.NullString{String: "changed", Valid: true}
+				values[2] = sql.NullString{String: "555", Valid: true}
+			},
+			values: []sql.NullString{{String: "1", Valid: true}, {}, {}},
+			want:   []sql.NullString{{String: "1", Valid: true}, {String: "***", Valid: true}, {String: "555", Valid: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrite := maskRowRewriter(map[string][]string{"users": {"email"}}, tt.mask, tt.next)
+			rewrite(tt.table, columns, tt.values)
+			if !reflect.DeepEqual(tt.values, tt.want) {
+				t.Errorf("maskRowRewriter() values = %v, want %v", tt.values, tt.want)
+			}
+		})
+	}
+}
+
+func Test_MaskHash(t *testing.T) {
+	a := MaskHash("users", "email", "a@b.c")
+	if len(a) != 16 || strings.Contains(a, "a@b.c") {
+		t.Errorf("MaskHash() = %q, want 16 hex characters", a)
+	}
+	if b := MaskHash("users", "email", "a@b.c"); a != b {
+		t.Errorf("MaskHash() not deterministic: %q != %q", a, b)
+	}
+	if c := MaskHash("users", "email", "x@y.z"); a == c {
+		t.Errorf("MaskHash() same hash %q for different values", a)
+	}
+}
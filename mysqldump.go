@@ -2,25 +2,107 @@ package mysqldump
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"path"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 func init() {}
 
+const defaultInsertBatchSize = 600
+
+const defaultCharset = "utf8mb4"
+
+// dumpProgressInterval 每导出多少行调用一次进度回调
+const dumpProgressInterval = 1000
+
+// InsertStrategy 导出数据时使用的 INSERT 语句
+type InsertStrategy int
+
+const (
+	// InsertStrategyInsert INSERT INTO, 默认
+	InsertStrategyInsert InsertStrategy = iota
+	// InsertStrategyIgnore INSERT IGNORE INTO, 跳过主键或唯一键冲突的行
+	InsertStrategyIgnore
+	// InsertStrategyReplace REPLACE INTO, 覆盖主键或唯一键冲突的行
+	InsertStrategyReplace
+)
+
+// verb 返回该策略对应的语句开头
+func (s InsertStrategy) verb() string {
+	switch s {
+	case InsertStrategyIgnore:
+		return "INSERT IGNORE INTO"
+	case InsertStrategyReplace:
+		return "REPLACE INTO"
+	default:
+		return "INSERT INTO"
+	}
+}
+
+// IdentifierQuote INSERT 语句中表名和列名的引号风格
+type IdentifierQuote int
+
+const (
+	// IdentifierQuoteBacktick `name`, 默认
+	IdentifierQuoteBacktick IdentifierQuote = iota
+	// IdentifierQuoteNone 不加引号, 名称是保留字或包含特殊字符时语句无效
+	IdentifierQuoteNone
+	// IdentifierQuoteDoubleQuote "name", 用于 ANSI_QUOTES 模式和其它数据库, 名称中的双引号写两次
+	IdentifierQuoteDoubleQuote
+)
+
+// quote 按引号风格返回标识符
+func (q IdentifierQuote) quote(name string) string {
+	switch q {
+	case IdentifierQuoteNone:
+		return name
+	case IdentifierQuoteDoubleQuote:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	default:
+		return quoteIdentifier(name)
+	}
+}
+
+// queryer 是 *sql.DB 和 *sql.Tx 共有的查询方法
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type dumpOption struct {
 	// 导出表数据
 	isData bool
 
+	// 不导出表数据, 优先级高于 isData
+	isNoData bool
+	// 不导出表结构, 只导出数据
+	isNoCreateInfo bool
+
+	// 按通配符和正则表达式选择表, 与 tables 合并
+	tablePatterns []string
+	tableRegexps  []*regexp.Regexp
 	// 导出指定表, 与 isAllTables 互斥, isAllTables 优先级高
 	tables []string
+	// 跳过 tables 中不存在的表, 默认返回错误
+	isIgnoreMissingTables bool
+	// 跳过导出过程中被删除的表
+	isSkipVanishedTables bool
 
 	views []string
 	// 导出全部表
@@ -30,9 +112,151 @@ type dumpOption struct {
 	isDropView      bool
 	isAllViews      bool
 	withUseDatabase bool
+	// USE 之前写入 CREATE DATABASE IF NOT EXISTS
+	isCreateDatabase bool
+	// USE, CREATE DATABASE 和限定名中使用的库名, 为空时使用源库名
+	renameDatabase  string
 	withTransaction bool
+	// 导入期间关闭 UNIQUE_CHECKS
+	isFastRestore bool
+	// 每条 INSERT 合并的行数, 默认 600
+	insertBatchSize int
+	// 单条 INSERT 的最大字节数, 0 表示不限制
+	maxAllowedPacket int
+	// 导出存储过程和函数
+	isRoutines bool
+	// 导出触发器
+	isTriggers bool
+	// 导出事件
+	isEvents bool
+	// 每个表导出后刷新输出
+	isFlushPerTable bool
+	// 诊断信息的输出, 默认为 nopLogger
+	logger Logger
+	// 导出库相关账号的 GRANT 语句, isExecutableGrants 为 false 时写成注释
+	isGrants           bool
+	isExecutableGrants bool
+	// 导入后事件的状态, nil 表示保持原状态
+	eventStatus *bool
+	// CREATE TABLE 是否带 IF NOT EXISTS, nil 表示由 isDropTable 决定
+	createIfNotExists *bool
+	// 删除 DEFINER 子句
+	isStripDefiner bool
+	// 替换 DEFINER 子句, 优先于 isStripDefiner
+	replaceDefiner string
+	// INSERT 不写列名, 默认写列名
+	isSkipCompleteInsert bool
+	// 数值列不加引号
+	isTypedValues bool
+	// 原样写在头部之后和尾部之前的 SQL
+	prologue []string
+	epilogue []string
+	// 替换 DATE, DATETIME 和 TIMESTAMP 列中的零日期, nil 表示替换为 NULL
+	isZeroDateReplacement bool
+	zeroDateReplacement   []byte
+	// INSERT 语句类型
+	insertStrategy InsertStrategy
+	// INSERT 语句中表名和列名的引号
+	identifierQuote IdentifierQuote
+	// INSERT ... ON DUPLICATE KEY UPDATE, 优先于 insertStrategy
+	isUpsert bool
+	// 删除 CREATE TABLE 中的 AUTO_INCREMENT=<n>
+	isResetAutoIncrement bool
+	// 删除 CREATE TABLE 中的分区定义
+	isNoPartitioning bool
+	// 删除列定义中的表达式默认值 DEFAULT (expr)
+	isNoExpressionDefaults bool
+	// CREATE TABLE 使用的存储引擎, 为空时保持原引擎
+	engine string
+	// 按外键依赖排序表
+	isSortByDependency bool
+	// 按主键顺序导出数据
+	isOrderByPrimaryKey bool
+	// 写成 CREATE TEMPORARY TABLE
+	isTemporaryTables bool
+	// 不写 SET FOREIGN_KEY_CHECKS=0 / =1
+	isNoForeignKeyChecksToggle bool
+	// 在一个 REPEATABLE READ 事务中读取全部表
+	isSingleTransaction bool
+	// 数据前后不写 LOCK TABLES / UNLOCK TABLES
+	isNoLockTables bool
+	// 读取前用一条 LOCK TABLES ... READ 锁定全部表
+	isLockAllTables bool
+	// 语句结束符, 默认 ;
+	terminator string
+	// 换行符, 默认 \n
+	lineEnding string
+	// 写入校验和清单, manifest 收集本次 dump 全部输出的校验和
+	checksumWriter io.Writer
+	manifest       *checksumManifest
+	// 在全局读锁下记录 binlog 位置并写入 dump 开头
+	isBinlogPosition bool
+	// 并发导出表的数量, 默认 1
+	parallelism int
+	// 排除的表, 支持 path.Match 通配符
+	excludeTables []string
+	// 每个表导出数据时的 WHERE 条件
+	whereConditions map[string]string
+	// WithIncremental 的表, watermarks 收集本次 dump 读取到的最大值
+	incrementals map[string]incremental
+	watermarks   *watermarkSet
+	// 每个表最多导出的行数, tableRowLimits 优先于 rowLimit, 0 表示不限制
+	rowLimit       int
+	tableRowLimits map[string]int
+	// 只导出 DATA_LENGTH+INDEX_LENGTH 在此范围内的表, 0 表示不限制
+	minTableBytes int64
+	maxTableBytes int64
+	// WithKeyRangeChunking 按键分段读取的表
+	keyRangeChunks map[string]keyRangeChunk
+	// 写入与官方 mysqldump 相同的会话变量保存和恢复语句
+	isCompatibleHeader bool
+	// SET NAMES 使用的字符集, 为空时使用连接的字符集
+	charset string
+	// 字符集与 dump 不同的列读取原始字节并加字符集前缀
+	isCharsetIntroducers bool
+	// dump 实际使用的字符集, 由 dump 设置
+	dumpCharset string
+	// 每个表写入该目录中单独的文件
+	filePerTableDir string
+	// 不写入 -- 注释
+	isNoComments bool
+	// 导入数据后再创建二级索引
+	isDeferIndexes bool
+	// 导入数据后 ANALYZE TABLE 更新统计信息
+	isAnalyzeAfterRestore bool
+	// 表数据前后写 DISABLE KEYS / ENABLE KEYS
+	isDisableKeys bool
+	// 写入前改写 CREATE 语句
+	statementRewriter func(stmt string) string
+	// 写入前改写每一行的值
+	rowRewriter func(table string, columns []string, values []sql.NullString)
+	// 需要脱敏的列, table -> 列名
+	maskColumns map[string][]string
+	maskFunc    MaskFunc
+	// 只读查询遇到临时错误时的重试次数和初始等待时间
+	retryAttempts int
+	retryBackoff  time.Duration
+	// 单个表和整个导出的超时时间
+	tableTimeout   time.Duration
+	overallTimeout time.Duration
+	// 输出格式
+	format Format
+	// CSV 中 NULL 的写法
+	csvNull string
+	// 进度回调
+	dumpProgress func(table string, rows uint64)
+	// 在表数据的注释中写入估计的行数
+	isApproximateRowCount bool
+	// 使用 gzip 压缩输出
+	isGzip    bool
+	gzipLevel int
+	// 替换 compress/gzip 的压缩实现和对应的扩展名
+	compressor        Compressor
+	compressExtension string
 	// writer 默认为 os.Stdout
 	writer io.Writer
+	// WithBufferedWriter 的 writer, 直接作为输出缓冲区
+	bufferedWriter *bufio.Writer
 }
 
 type DumpOption func(*dumpOption)
@@ -56,12 +280,58 @@ func WithData() DumpOption {
 	}
 }
 
+// WithNoData 只导出表结构, 优先级高于 WithData 和 WithNoCreateInfo
+func WithNoData() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoData = true
+	}
+}
+
+// WithNoCreateInfo 只导出表数据, 不写 DROP TABLE 和 CREATE TABLE;
+// 与 WithNoData 同时使用时表既无结构也无数据
+func WithNoCreateInfo() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoCreateInfo = true
+	}
+}
+
 // 导出指定表, 与 WithAllTables 互斥, WithAllTables 优先级高
 func WithTables(tables ...string) DumpOption {
 	return func(option *dumpOption) {
 		option.tables = tables
 	}
 }
+
+// WithIgnoreMissingTables 跳过 WithTables 中不存在的表并打印警告, 默认 Dump 在写入任何输出前返回错误
+func WithIgnoreMissingTables() DumpOption {
+	return func(option *dumpOption) {
+		option.isIgnoreMissingTables = true
+	}
+}
+
+// WithSkipVanishedTables 获取表列表后被其它会话删除的表 (如繁忙库中的临时表) 打印警告后跳过, 不再使 Dump 失败,
+// 跳过的表记录在 DumpResult.SkippedTables 中; 删除前已写入的该表语句保留在输出中
+func WithSkipVanishedTables() DumpOption {
+	return func(option *dumpOption) {
+		option.isSkipVanishedTables = true
+	}
+}
+
+// WithTablePattern 导出名称匹配通配符 (如 "log_20*", 语法同 WithExcludeTables) 的表, 可与 WithTables,
+// WithTableRegexp 同时使用, 导出匹配任意一项的表, 之后再应用 WithExcludeTables; 没有表匹配时 Dump 返回错误
+func WithTablePattern(patterns ...string) DumpOption {
+	return func(option *dumpOption) {
+		option.tablePatterns = append(option.tablePatterns, patterns...)
+	}
+}
+
+// WithTableRegexp 导出名称匹配正则表达式的表, 如 regexp.MustCompile(`^log_\d{4}$`), 其它同 WithTablePattern
+func WithTableRegexp(expressions ...*regexp.Regexp) DumpOption {
+	return func(option *dumpOption) {
+		option.tableRegexps = append(option.tableRegexps, expressions...)
+	}
+}
+
 func WithViews(views ...string) DumpOption {
 	return func(option *dumpOption) {
 		option.views = views
@@ -79,338 +349,2140 @@ func WithUseDatabase() DumpOption {
 		option.withUseDatabase = true
 	}
 }
+
+// WithRenameDatabase 在 USE, CREATE DATABASE 以及视图, 存储过程, 触发器和事件中 `db`.`name` 形式的限定名中
+// 使用 newName 代替源库名, 仍然从源库读取, 如将 prod 导出为导入到 staging 的 dump
+func WithRenameDatabase(newName string) DumpOption {
+	return func(option *dumpOption) {
+		option.renameDatabase = newName
+	}
+}
+
+// WithCreateDatabase 在 USE 之前写入 CREATE DATABASE IF NOT EXISTS, 字符集和排序规则与源库相同,
+// dump 可以导入到没有该库的服务器; 同时启用 WithUseDatabase
+func WithCreateDatabase() DumpOption {
+	return func(option *dumpOption) {
+		option.isCreateDatabase = true
+		option.withUseDatabase = true
+	}
+}
 func WithTransaction() DumpOption {
 	return func(option *dumpOption) {
 		option.withTransaction = true
 	}
 }
 
+// WithFastRestore 写入官方 mysqldump 推荐的快速导入设置: 导入期间 SET UNIQUE_CHECKS=0, 并启用 WithTransaction,
+// 数据在一个事务中提交后再恢复 UNIQUE_CHECKS; FOREIGN_KEY_CHECKS 默认已经关闭 (见 WithoutForeignKeyChecksToggle).
+// 关闭 UNIQUE_CHECKS 后 InnoDB 可能不检查唯一键冲突, 导入重复的数据不会报错而是留下违反唯一约束的行,
+// 只应用于导入来自同一个库, 已知没有重复的 dump
+func WithFastRestore() DumpOption {
+	return func(option *dumpOption) {
+		option.isFastRestore = true
+		option.withTransaction = true
+	}
+}
+
 func WithAllViews() DumpOption {
 	return func(option *dumpOption) {
 		option.isAllViews = true
 	}
 }
 
-// 导出到指定 writer
-func WithWriter(writer io.Writer) DumpOption {
+// WithInsertBatchSize 设置每条 INSERT 合并的行数 (默认 600)
+func WithInsertBatchSize(size int) DumpOption {
 	return func(option *dumpOption) {
-		option.writer = writer
+		option.insertBatchSize = size
 	}
 }
 
-func Dump(db *sql.DB, dbName string, opts ...DumpOption) error {
-	// 打印开始
-	start := time.Now()
-	// 打印结束
-	var err error
-
-	var o dumpOption
-
-	for _, opt := range opts {
-		opt(&o)
+// WithMaxAllowedPacket 限制单条 INSERT 的大小 (字节), 应不大于目标库的 max_allowed_packet
+func WithMaxAllowedPacket(size int) DumpOption {
+	return func(option *dumpOption) {
+		option.maxAllowedPacket = size
 	}
+}
 
-	if len(o.tables) == 0 {
-		// 默认包含全部表
-		o.isAllTable = true
+// WithRoutines 导出存储过程和函数
+func WithRoutines() DumpOption {
+	return func(option *dumpOption) {
+		option.isRoutines = true
 	}
+}
 
-	if len(o.views) == 0 && !o.isAllViews {
-		// 默认包含全部表
-		o.isAllViews = false
+// WithTriggers 导出触发器, 每个表的触发器写在该表数据之后
+func WithTriggers() DumpOption {
+	return func(option *dumpOption) {
+		option.isTriggers = true
 	}
+}
 
-	if o.writer == nil {
-		// 默认输出到 os.Stdout
-		o.writer = os.Stdout
+// WithEvents 导出事件
+func WithEvents() DumpOption {
+	return func(option *dumpOption) {
+		option.isEvents = true
 	}
+}
 
-	buf := bufio.NewWriter(o.writer)
-	defer buf.Flush()
-
-	// 打印 Header
-	_, _ = buf.WriteString("-- ----------------------------\n")
-	_, _ = buf.WriteString("-- MySQL Database Dump\n")
-	_, _ = buf.WriteString("-- Start Time: " + start.Format("2006-01-02 15:04:05") + "\n")
-	_, _ = buf.WriteString("-- Database Name: " + dbName + "\n")
-	_, _ = buf.WriteString("-- ----------------------------\n")
-	if o.withTransaction {
-		_, _ = buf.WriteString("SET AUTOCOMMIT=0;\n")
-		_, _ = buf.WriteString("START TRANSACTION;\n\n")
-	}
-	if o.withUseDatabase {
-		_, _ = buf.WriteString(fmt.Sprintf("USE `%s`;\n\n", dbName))
+// WithLogger Dump 的警告 (如忽略的选项, 跳过的表, 查询重试) 和进度信息写入 l, 默认不输出
+func WithLogger(l Logger) DumpOption {
+	return func(option *dumpOption) {
+		option.logger = l
 	}
-	_, _ = buf.WriteString("SET FOREIGN_KEY_CHECKS=0;\n\n")
-	_, err = db.Exec(fmt.Sprintf("USE `%s`", dbName))
-	if err != nil {
-		return err
+}
+
+// WithFlushPerTable 每个表导出后把缓冲区 (和 gzip 压缩流) 写入 writer, 通过网络或 DumpReader 流式导出时
+// 接收方可以逐表处理; 默认只在缓冲区满和导出结束时写入.
+// WithFilePerTable 时每个表的文件在导出后关闭, 不需要此选项
+func WithFlushPerTable() DumpOption {
+	return func(option *dumpOption) {
+		option.isFlushPerTable = true
 	}
+}
 
-	// 2. 获取表
-	var tables []string
+// WithGrants 导出在该库上有库级或表级权限的账号的 GRANT 语句, 用于完整复制环境.
+// 需要 mysql.db, mysql.tables_priv 的 SELECT 权限以及查看其它账号权限的权限 (SHOW GRANTS FOR);
+// 权限属于敏感信息, executable 为 false 时写成 -- 注释 (WithNoComments 时也写入), 为 true 时写成可执行的语句.
+// 不导出 CREATE USER 和密码, 导入前账号必须已存在
+func WithGrants(executable bool) DumpOption {
+	return func(option *dumpOption) {
+		option.isGrants = true
+		option.isExecutableGrants = executable
+	}
+}
 
-	if o.isAllTable {
-		tmp, err := getAllTables(db)
-		if err != nil {
-			return err
-		}
-		tables = tmp
-	} else {
-		tables = o.tables
+// WithEventStatus 导出的事件统一为 ENABLE (true) 或 DISABLE (false), 默认保持原状态
+func WithEventStatus(enabled bool) DumpOption {
+	return func(option *dumpOption) {
+		option.eventStatus = &enabled
 	}
+}
 
-	var views []string
+// WithStripDefiner 删除视图, 存储过程, 函数, 触发器和事件中的 DEFINER 子句,
+// 导入时使用导入用户作为定义者
+func WithStripDefiner() DumpOption {
+	return func(option *dumpOption) {
+		option.isStripDefiner = true
+	}
+}
 
-	tmp, err := getAllViews(db)
-	//Remove views from tables
-	for _, view := range tmp {
-		index := slices.Index(tables, view)
-		if index != -1 {
-			// Remove the element at the found index
-			tables = slices.Delete(tables, index, index+1)
-		}
+// WithCompleteInsert 设置 INSERT 是否写列名, 默认 true:
+// INSERT INTO `t` (`a`,`b`) VALUES ... 或 INSERT INTO `t` VALUES ...
+func WithCompleteInsert(complete bool) DumpOption {
+	return func(option *dumpOption) {
+		option.isSkipCompleteInsert = !complete
+	}
+}
 
+// WithTypedValues 整数, DECIMAL, FLOAT, DOUBLE 和 YEAR 列不加引号输出, BIT 列输出为十六进制,
+// 便于严格 SQL 模式和外部工具解析; 默认全部按字符串输出
+func WithTypedValues() DumpOption {
+	return func(option *dumpOption) {
+		option.isTypedValues = true
 	}
-	if o.isAllViews {
-		if err != nil {
-			return err
-		}
-		views = tmp
-	} else {
-		views = o.views
+}
+
+// WithPrologue 把 sql 原样写在头部的会话设置 (SET FOREIGN_KEY_CHECKS=0) 之后, 需要自行带上语句结束符;
+// 多次调用按顺序写入. WithFilePerTable 时写入每个文件
+func WithPrologue(sql string) DumpOption {
+	return func(option *dumpOption) {
+		option.prologue = append(option.prologue, sql)
 	}
+}
 
-	allTotalRows := uint64(0)
-	// 3. 导出表
-	for _, table := range tables {
-		// 删除表
-		if o.isDropTable {
-			_, _ = buf.WriteString(fmt.Sprintf("DROP TABLE IF EXISTS `%s`;\n", table))
-		}
+// WithEpilogue 把 sql 原样写在尾部的会话恢复 (SET FOREIGN_KEY_CHECKS=1) 之前, 多次调用按顺序写入
+func WithEpilogue(sql string) DumpOption {
+	return func(option *dumpOption) {
+		option.epilogue = append(option.epilogue, sql)
+	}
+}
 
-		// 导出表结构
-		err = writeTableStruct(db, table, buf)
-		if err != nil {
-			return err
-		}
-		if o.isData {
-			_, _ = buf.WriteString(fmt.Sprintf("LOCK TABLES `%s` WRITE; \n\n", table))
-			totalRows, err := writeTableData(db, table, buf)
-			_, _ = buf.WriteString("UNLOCK TABLES;\n\n")
-			allTotalRows += totalRows
-			if err != nil {
-				return err
-			}
+// WithZeroDateReplacement 把 DATE, DATETIME 和 TIMESTAMP 列中的零日期 ('0000-00-00', '0000-00-00 00:00:00')
+// 替换为 value, 如 "1970-01-01"; value 为 "NULL" 时替换为 NULL. 旧版本 MySQL 中的零日期在开启 NO_ZERO_DATE
+// 的严格模式下不能导入. 替换在 WithRowRewriter 之前进行, 对 CSV 和 JSON Lines 输出同样生效
+func WithZeroDateReplacement(value string) DumpOption {
+	return func(option *dumpOption) {
+		option.isZeroDateReplacement = true
+		option.zeroDateReplacement = nil
+		if !strings.EqualFold(value, "NULL") {
+			option.zeroDateReplacement = []byte(value)
 		}
 	}
-	// Committing transaction so Views Can Be Defined Without Issues
-	if o.withTransaction {
-		_, _ = buf.WriteString("COMMIT;\n")
-		_, _ = buf.WriteString("SET AUTOCOMMIT=1;\n")
-	}
-	// 4. Views
+}
 
-	for _, view := range views {
-		// 删除表
-		if o.isDropView {
-			_, _ = buf.WriteString(fmt.Sprintf("DROP VIEW IF EXISTS `%s`;\n", view))
-		}
+// WithInsertStrategy 设置 INSERT 语句类型, 使用 INSERT IGNORE 或 REPLACE 可重复导入
+func WithInsertStrategy(strategy InsertStrategy) DumpOption {
+	return func(option *dumpOption) {
+		option.insertStrategy = strategy
+	}
+}
 
-		// 导出表结构
-		err = writeTableStruct(db, view, buf)
-		if err != nil {
-			return err
-		}
+// WithIdentifierQuote 设置 INSERT 语句中表名和列名的引号风格, 默认为反引号; 用于导入 ANSI_QUOTES 模式或其它数据库.
+// 只影响 INSERT 语句, SHOW CREATE TABLE 得到的表结构, WithUpsert 的 ON DUPLICATE KEY UPDATE 等 MySQL 特有的语句仍使用反引号
+func WithIdentifierQuote(style IdentifierQuote) DumpOption {
+	return func(option *dumpOption) {
+		option.identifierQuote = style
 	}
+}
 
-	// Again Starting Transaction For Data Insertion
-	if o.withTransaction {
-		_, _ = buf.WriteString("SET AUTOCOMMIT=0;\n")
-		_, _ = buf.WriteString("START TRANSACTION;\n\n")
+// WithUpsert 生成 INSERT ... ON DUPLICATE KEY UPDATE col=VALUES(col), 更新全部非主键列,
+// 用于将数据合并到已有的库中, 优先于 WithInsertStrategy
+func WithUpsert() DumpOption {
+	return func(option *dumpOption) {
+		option.isUpsert = true
 	}
+}
 
-	// 导出每个表的结构和数据
-	_, _ = buf.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
-	if o.withTransaction {
-		_, _ = buf.WriteString("COMMIT;\n")
-		_, _ = buf.WriteString("SET AUTOCOMMIT=1;\n")
-	}
-	_, _ = buf.WriteString("-- ----------------------------\n")
-	_, _ = buf.WriteString("-- Dumped by mysqldump\n")
-	_, _ = buf.WriteString("-- Maintained by Yusta (https://github.com/NotYusta)\n")
-	_, _ = buf.WriteString("-- Cost Time: " + time.Since(start).String() + "\n")
-	_, _ = buf.WriteString("-- Complete Time: " + time.Now().Format("2006-01-02 15:04:05") + "\n")
-	_, _ = buf.WriteString("-- Table Counts: " + fmt.Sprintf("%d", len(tables)) + "\n")
-	_, _ = buf.WriteString("-- Table Rows: " + fmt.Sprintf("%d", allTotalRows) + "\n")
-	_, _ = buf.WriteString("-- ----------------------------\n")
-	buf.Flush()
+// WithResetAutoIncrement 删除 CREATE TABLE 中的 AUTO_INCREMENT=<n>, 导入后自增值从头开始
+func WithResetAutoIncrement() DumpOption {
+	return func(option *dumpOption) {
+		option.isResetAutoIncrement = true
+	}
+}
 
-	return nil
+// WithEngine 将每个 CREATE TABLE (包括各个分区) 的存储引擎改为 engine, 如从 MyISAM 迁移到 InnoDB,
+// 没有 ENGINE 子句时添加; 视图, 存储过程等不受影响. engine 只能包含字母, 数字和下划线
+func WithEngine(engine string) DumpOption {
+	return func(option *dumpOption) {
+		option.engine = engine
+	}
 }
 
-func getCreateTableSQL(db *sql.DB, table string) (string, error) {
-	var createTableSQL string
+// WithoutExpressionDefaults 删除列定义中 MySQL 8.0.13 起支持的表达式默认值, 如 DEFAULT (uuid()), 用于导入到 MySQL 5.7 等旧版本;
+// 这些列导入后没有默认值, dump 中的 INSERT 写入全部列, 数据不受影响. DEFAULT CURRENT_TIMESTAMP 等不带括号的默认值保留
+func WithoutExpressionDefaults() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoExpressionDefaults = true
+	}
+}
 
-	rows, err := db.Query(fmt.Sprintf("SHOW CREATE TABLE `%s`", table))
-	if err != nil {
-		return "", err
+// WithoutPartitioning 删除 CREATE TABLE 中的 /*!50100 PARTITION BY ... */ 分区定义, 导入为不分区的表;
+// 表数据按 SELECT 读取, 不受分区影响
+func WithoutPartitioning() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoPartitioning = true
 	}
-	columns, err := rows.Columns()
-	if err != nil {
-		return "", err
-	} else if len(columns) < 2 {
-		return "", fmt.Errorf("less then 2 columns found on querying table %s", table)
+}
+
+// WithSortByDependency 按外键依赖排序表, 被引用的表先创建和导入; 存在循环依赖时保持原顺序
+func WithSortByDependency() DumpOption {
+	return func(option *dumpOption) {
+		option.isSortByDependency = true
 	}
-	extras := make([]any, len(columns))
-	extras[1] = &createTableSQL
-	extras[0] = &table
-	if !rows.Next() {
-		return "", fmt.Errorf("table %s not found", table)
+}
+
+// WithTemporaryTables 把表写成 CREATE TEMPORARY TABLE, 导入的连接断开后表即消失, 适用于测试数据;
+// WithDropTable 时相应写 DROP TEMPORARY TABLE IF EXISTS, 不会删除同名的普通表, IF NOT EXISTS 也只检查临时表.
+// InnoDB 的临时表不支持外键, 带外键的表需要配合 WithStatementRewriter 去掉 FOREIGN KEY 子句
+func WithTemporaryTables() DumpOption {
+	return func(option *dumpOption) {
+		option.isTemporaryTables = true
 	}
-	var notNeededData string
-	if len(columns) > 2 {
-		for i := 2; i < len(columns); i++ {
-			extras[i] = &notNeededData
-		}
+}
+
+// WithOrderByPrimaryKey 按主键顺序读取表数据, 相同的数据每次得到相同的 dump, 便于比较;
+// 没有主键的表不排序, 顺序由存储引擎决定. 大表排序可能比默认慢
+func WithOrderByPrimaryKey() DumpOption {
+	return func(option *dumpOption) {
+		option.isOrderByPrimaryKey = true
 	}
-	err = rows.Scan(extras...)
-	if err != nil {
-		return "", err
+}
+
+// WithoutForeignKeyChecksToggle 不写 SET FOREIGN_KEY_CHECKS=0 / =1 (包括 WithCompatibleHeader 中的),
+// 导入时按会话原有设置检查外键; 通常与 WithSortByDependency 一起使用, 否则被引用的表可能后导入
+func WithoutForeignKeyChecksToggle() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoForeignKeyChecksToggle = true
 	}
-	rows.Close()
-	// IF NOT EXISTS
-	createTableSQL = strings.Replace(createTableSQL, "CREATE TABLE", "CREATE TABLE IF NOT EXISTS", 1)
-	return createTableSQL, nil
 }
 
-func getAllTables(db *sql.DB) ([]string, error) {
-	var tables []string
-	rows, err := db.Query("SHOW TABLES")
-	if err != nil {
-		return nil, err
+// WithSingleTransaction 在一个 REPEATABLE READ 只读事务中读取全部表, 得到同一时间点的一致数据,
+// 类似 mysqldump --single-transaction, 只适用于 InnoDB 等事务引擎.
+// 该模式下 dump 中不写 LOCK TABLES, 并且忽略 WithParallelism
+func WithSingleTransaction() DumpOption {
+	return func(option *dumpOption) {
+		option.isSingleTransaction = true
 	}
-	defer rows.Close()
+}
 
-	for rows.Next() {
-		var table string
-		err = rows.Scan(&table)
-		if err != nil {
-			return nil, err
-		}
-		tables = append(tables, table)
+// WithoutLockTables 表数据前后不写 LOCK TABLES ... WRITE / UNLOCK TABLES.
+// 这两条语句在导入时执行, 导入用户没有 LOCK TABLES 权限时 (如 RDS 等托管数据库) 导入会失败;
+// 导入时不再阻止其他会话写入该表. WithSingleTransaction 时总是不写
+func WithoutLockTables() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoLockTables = true
 	}
+}
 
-	return tables, nil
+// WithLockAllTables 读取前在一个连接上用一条 LOCK TABLES ... READ 锁定全部要导出的表, 全部表读取后
+// UNLOCK TABLES, 非事务引擎 (如 MyISAM) 也能得到同一时间点的数据; 锁定期间其他会话不能写入这些表.
+// 与 dump 中每个表的 LOCK TABLES 互斥, 此时不写; 忽略 WithParallelism,
+// 与 WithSingleTransaction 同时使用时以 WithSingleTransaction 为准
+func WithLockAllTables() DumpOption {
+	return func(option *dumpOption) {
+		option.isLockAllTables = true
+	}
 }
-func getAllViews(db *sql.DB) ([]string, error) {
-	var views []string
-	rows, err := db.Query("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'VIEW'")
-	if err != nil {
-		return nil, err
+
+// WithStatementTerminator 使用 terminator 代替语句末尾的 ";", 供自定义的导入工具使用;
+// 存储过程等仍用 DELIMITER 包裹. Source 和 mysql 客户端只能导入默认结束符的 dump
+func WithStatementTerminator(terminator string) DumpOption {
+	return func(option *dumpOption) {
+		option.terminator = terminator
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var table string
-		err = rows.Scan(&table)
-		if err != nil {
-			return nil, err
-		}
-		views = append(views, table)
+}
+
+// WithLineEnding 使用 lineEnding (如 Windows 工具需要的 "\r\n") 代替输出中的全部 "\n", 包括存储过程体中的换行;
+// 值中的换行已转义, 不受影响. DumpResult 中的字节数按转换前统计
+func WithLineEnding(lineEnding string) DumpOption {
+	return func(option *dumpOption) {
+		option.lineEnding = lineEnding
 	}
-	return views, nil
 }
 
-func writeTableStruct(db *sql.DB, table string, buf *bufio.Writer) error {
-	// 导出表结构
-	_, _ = buf.WriteString("-- ----------------------------\n")
-	_, _ = buf.WriteString(fmt.Sprintf("-- Table structure for %s\n", table))
-	_, _ = buf.WriteString("-- ----------------------------\n")
-	createTableSQL, err := getCreateTableSQL(db, table)
-	if err != nil {
-		return err
+// WithChecksum Dump 成功后向 w 写入输出的 SHA-256 清单, 每个输出一行 "<sha256> <字节数> <名称>",
+// 按写入 WithWriter 或文件的最终字节 (gzip 时为压缩后) 计算; WithWriter 的名称为 "-",
+// WithFilePerTable 时为目录中的文件名. 导入时可用 WithExpectedChecksum 校验
+func WithChecksum(w io.Writer) DumpOption {
+	return func(option *dumpOption) {
+		option.checksumWriter = w
 	}
-	_, _ = buf.WriteString(fmt.Sprintf("%s;\n\n", createTableSQL))
-	return nil
 }
 
-// 禁止 golangci-lint 检查
-// nolint: gocyclo
-func writeTableData(db *sql.DB, table string, buf *bufio.Writer) (uint64, error) {
-	var totalRow uint64
-	row := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM `%s`", table))
-	row.Scan(&totalRow)
+// WithBinlogPosition 读取任何表之前在 FLUSH TABLES WITH READ LOCK 下记录 binlog 文件, 位置和 GTID 集合,
+// 以注释的 CHANGE MASTER TO / SET @@GLOBAL.GTID_PURGED 写入 dump 开头, 并返回在 DumpResult.BinlogPosition 中,
+// 类似 mysqldump --master-data=2. 与 WithSingleTransaction 同时使用时建立快照后立即解锁,
+// 否则全局读锁持续到全部表数据读取完, 期间所有写入都被阻塞.
+// 需要 RELOAD 权限 (FLUSH TABLES WITH READ LOCK) 和 REPLICATION CLIENT 权限 (SHOW MASTER STATUS,
+// MySQL 8.4 为 SHOW BINARY LOG STATUS; MariaDB 10.5 以上为 BINLOG MONITOR), 源库需开启 binlog
+func WithBinlogPosition() DumpOption {
+	return func(option *dumpOption) {
+		option.isBinlogPosition = true
+	}
+}
+
+// WithParallelism 使用 n 个 goroutine 并发导出表, 输出顺序与串行导出相同.
+// 每个表的输出先缓存在内存中, 按顺序写入 writer, 内存占用可能达到多个表的大小.
+// 各个表在不同的连接上读取, 表之间不是同一时间点的数据;
+// 需要一致性时使用只读的从库或停止写入. 写入 dump 的 LOCK TABLES 只在导入时生效, 不受影响
+func WithParallelism(n int) DumpOption {
+	return func(option *dumpOption) {
+		option.parallelism = n
+	}
+}
+
+// WithExcludeTables 排除指定的表, 支持 "tmp_*" 这样的通配符, 对 WithAllTable 和 WithTables 均生效
+func WithExcludeTables(tables ...string) DumpOption {
+	return func(option *dumpOption) {
+		option.excludeTables = append(option.excludeTables, tables...)
+	}
+}
+
+// WithWhere 只导出 table 中满足 condition 的行, 多次调用可为不同的表设置条件
+func WithWhere(table string, condition string) DumpOption {
+	return func(option *dumpOption) {
+		if option.whereConditions == nil {
+			option.whereConditions = make(map[string]string)
+		}
+		option.whereConditions[table] = condition
+	}
+}
+
+// WithIncremental 增量导出: 表 table 只导出 column (DATE, DATETIME 或 TIMESTAMP 列, 如 updated_at) 晚于 since 的行,
+// 与 WithWhere 的条件同时生效. 读取到的 column 最大值返回在 DumpResult.Watermarks 中, 作为下一次的 since;
+// since 按自身的时区格式化, 应与列值的时区 (TIMESTAMP 为会话时区) 一致. 被删除的行不会出现在增量中
+func WithIncremental(table, column string, since time.Time) DumpOption {
+	return func(option *dumpOption) {
+		if option.incrementals == nil {
+			option.incrementals = make(map[string]incremental)
+		}
+		option.incrementals[table] = incremental{column: column, since: since}
+	}
+}
+
+// WithWhereConditions 批量设置每个表的 WHERE 条件, key 为表名
+func WithWhereConditions(conditions map[string]string) DumpOption {
+	return func(option *dumpOption) {
+		for table, condition := range conditions {
+			WithWhere(table, condition)(option)
+		}
+	}
+}
+
+// WithRowLimit 每个表最多导出 n 行 (SELECT ... LIMIT n), 用于从生产库生成样例数据;
+// 与 WithOrderByPrimaryKey 一起使用时每次得到相同的行, 否则行由存储引擎决定. n <= 0 表示不限制
+func WithRowLimit(n int) DumpOption {
+	return func(option *dumpOption) {
+		option.rowLimit = n
+	}
+}
+
+// WithTableRowLimit 表 table 最多导出 n 行, 优先于 WithRowLimit; n <= 0 表示该表不限制
+func WithTableRowLimit(table string, n int) DumpOption {
+	return func(option *dumpOption) {
+		if option.tableRowLimits == nil {
+			option.tableRowLimits = make(map[string]int)
+		}
+		option.tableRowLimits[table] = n
+	}
+}
+
+// WithMaxTableBytes 只导出大小 (information_schema.TABLES 的 DATA_LENGTH+INDEX_LENGTH) 不超过 n 字节的表,
+// 用于把大表排除出来单独导出. 大小是存储引擎的估计值, 与实际数据量可能相差较大; n <= 0 表示不限制
+func WithMaxTableBytes(n int64) DumpOption {
+	return func(option *dumpOption) {
+		option.maxTableBytes = n
+	}
+}
+
+// WithMinTableBytes 只导出大小不小于 n 字节的表, 与 WithMaxTableBytes 相同按 DATA_LENGTH+INDEX_LENGTH 计算; n <= 0 表示不限制
+func WithMinTableBytes(n int64) DumpOption {
+	return func(option *dumpOption) {
+		option.minTableBytes = n
+	}
+}
+
+// WithKeyRangeChunking 分段读取表 table 的数据: 每次 SELECT ... WHERE column > 上一段最后的值 ORDER BY column LIMIT chunkSize,
+// 而不是一个 SELECT 读取整个表, 避免超大表的查询长时间占用游标或超过服务器的超时. 输出的 INSERT 与不分段时相同, 按 column 排序.
+// column 必须单独构成一个唯一索引且不为 NULL (如自增主键), 否则导出该表时返回错误; chunkSize <= 0 时不分段
+func WithKeyRangeChunking(table, column string, chunkSize int) DumpOption {
+	return func(option *dumpOption) {
+		if option.keyRangeChunks == nil {
+			option.keyRangeChunks = make(map[string]keyRangeChunk)
+		}
+		if chunkSize <= 0 {
+			delete(option.keyRangeChunks, table)
+			return
+		}
+		option.keyRangeChunks[table] = keyRangeChunk{column: column, size: chunkSize}
+	}
+}
+
+// rowLimitOf 返回表 table 最多导出的行数, 0 表示不限制
+func (o *dumpOption) rowLimitOf(table string) int {
+	limit, ok := o.tableRowLimits[table]
+	if !ok {
+		limit = o.rowLimit
+	}
+	return max(limit, 0)
+}
+
+// WithCompatibleHeader 在开头保存并在结尾恢复 CHARACTER_SET_CLIENT, TIME_ZONE, SQL_MODE,
+// UNIQUE_CHECKS 等会话变量, 与官方 mysqldump 的输出格式一致
+func WithCompatibleHeader() DumpOption {
+	return func(option *dumpOption) {
+		option.isCompatibleHeader = true
+	}
+}
+
+// WithCharsetIntroducers 字符集与 dump (SET NAMES) 不同的字符串列, 如 utf8mb4 库中的 latin1 列,
+// 读取列中的原始字节并写成 _latin1'...' 形式, 导入时按列的字符集解释, 不经过连接字符集的转换;
+// 用于存放了连接字符集无法表示的字节的旧数据. 只对 FormatSQL 生效, WithRowRewriter 收到的是这些列的原始字节
+func WithCharsetIntroducers() DumpOption {
+	return func(option *dumpOption) {
+		option.isCharsetIntroducers = true
+	}
+}
+
+// WithCharset 在 dump 开头写入 SET NAMES <charset>;
+// 默认使用当前连接的 character_set_results, 无法获取时为 utf8mb4
+func WithCharset(charset string) DumpOption {
+	return func(option *dumpOption) {
+		option.charset = charset
+	}
+}
+
+// WithFilePerTable 每个表的结构, 数据和触发器写入 dir/<table>.sql, 视图, 存储过程和事件写入
+// dir/_schema.sql, 每个文件都有完整的开头和结尾, 可单独导入; 使用 WithGzip 时扩展名为 .sql.gz.
+// 优先于 WithWriter, 同时设置时 WithWriter 被忽略
+func WithFilePerTable(dir string) DumpOption {
+	return func(option *dumpOption) {
+		option.filePerTableDir = dir
+	}
+}
+
+// WithNoComments 不写入开头, 结尾和各对象前的 -- 注释, 只输出可执行的 SQL
+func WithNoComments() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoComments = true
+	}
+}
+
+// WithCreateTableIfNotExists 是否写 CREATE TABLE IF NOT EXISTS. 默认不使用 WithDropTable 时写,
+// 使用 WithDropTable 时不写, 以免已存在的表结构与 dump 不一致时被静默保留
+func WithCreateTableIfNotExists(ifNotExists bool) DumpOption {
+	return func(option *dumpOption) {
+		option.createIfNotExists = &ifNotExists
+	}
+}
+
+// WithDeferIndexes CREATE TABLE 中只保留主键, 二级索引在表数据之后用 ALTER TABLE ... ADD 创建,
+// 大表导入更快; 只在导出数据时生效
+func WithDeferIndexes() DumpOption {
+	return func(option *dumpOption) {
+		option.isDeferIndexes = true
+	}
+}
+
+// WithAnalyzeAfterRestore 在 dump 结尾为每个导出了数据的表写一条 ANALYZE TABLE, 导入后优化器的统计信息是最新的;
+// 大库导入时会增加额外的负载, 默认不写. WithFilePerTable 时写入每个表的文件
+func WithAnalyzeAfterRestore() DumpOption {
+	return func(option *dumpOption) {
+		option.isAnalyzeAfterRestore = true
+	}
+}
+
+// WithStatementRewriter 写入前用 fn 改写每条 CREATE 语句 (表, 视图, 存储过程, 函数, 触发器和事件),
+// 在 WithStripDefiner 等内置处理之后调用, 可用于替换存储引擎或数据库名
+func WithStatementRewriter(fn func(stmt string) string) DumpOption {
+	return func(option *dumpOption) {
+		option.statementRewriter = fn
+	}
+}
+
+// WithRowRewriter 写入前对每一行调用 fn, fn 可直接修改 values, 如脱敏某一列; Valid 为 false 表示 NULL.
+// fn 在转义之前调用, 修改后的值仍会被正确转义; values 在各行之间复用, 不能在 fn 返回后保存.
+// WithParallelism 时 fn 会被多个 goroutine 同时调用
+func WithRowRewriter(fn func(table string, columns []string, values []sql.NullString)) DumpOption {
+	return func(option *dumpOption) {
+		option.rowRewriter = fn
+	}
+}
+
+// WithMaskColumns 导出时对指定的列脱敏, columns 为 table -> 列名, NULL 保持为 NULL.
+// 默认使用 MaskHash, 可用 WithMaskFunc 替换; 脱敏在 WithRowRewriter 之后执行.
+// 脱敏后的值必须符合列的类型和长度, 如 WithTypedValues 时数值列不能脱敏为字符串
+func WithMaskColumns(columns map[string][]string) DumpOption {
+	return func(option *dumpOption) {
+		if option.maskColumns == nil {
+			option.maskColumns = make(map[string][]string, len(columns))
+		}
+		for table, cols := range columns {
+			option.maskColumns[table] = append(option.maskColumns[table], cols...)
+		}
+	}
+}
+
+// WithMaskFunc 设置 WithMaskColumns 使用的脱敏函数, 如 MaskHash 或 MaskString("***")
+func WithMaskFunc(fn MaskFunc) DumpOption {
+	return func(option *dumpOption) {
+		option.maskFunc = fn
+	}
+}
+
+// WithRetry 读取表结构和表数据的查询遇到临时错误 (连接断开, 锁等待超时, 死锁) 时最多尝试 attempts 次,
+// 第一次重试前等待 backoff, 之后每次翻倍. 只重试查询的开始, 已开始读取的数据中途出错不会重试.
+// 不使用 WithSingleTransaction 时重试的查询可能读到较新的数据; 使用时连接断开会结束事务,
+// 重试只对锁等待超时等不断开连接的错误有效
+func WithRetry(attempts int, backoff time.Duration) DumpOption {
+	return func(option *dumpOption) {
+		option.retryAttempts = attempts
+		option.retryBackoff = backoff
+	}
+}
+
+// WithTableTimeout 每个表的导出 (读取表结构和全部数据) 最多用时 d, 超时返回带表名的错误
+func WithTableTimeout(d time.Duration) DumpOption {
+	return func(option *dumpOption) {
+		option.tableTimeout = d
+	}
+}
+
+// WithOverallTimeout 整个导出最多用时 d, 超时后返回 context.DeadlineExceeded
+func WithOverallTimeout(d time.Duration) DumpOption {
+	return func(option *dumpOption) {
+		option.overallTimeout = d
+	}
+}
+
+// WithFormat 设置表数据的输出格式, 默认为 FormatSQL. 非 SQL 格式只导出表数据, 忽略视图,
+// 存储过程和事件; 每个表以列名行 (FormatJSONL 为 {"table":...,"columns":[...]}) 开头,
+// 写入同一个输出时 FormatCSV 的表之间以空行分隔; 使用 WithFilePerTable 时每个表写入
+// dir/<table>.csv 等单独的文件
+func WithFormat(format Format) DumpOption {
+	return func(option *dumpOption) {
+		option.format = format
+	}
+}
+
+// WithCSVNull 设置 FormatCSV 中 NULL 的写法, 默认为空字段, 与空字符串无法区分时可设为 \N 等
+func WithCSVNull(s string) DumpOption {
+	return func(option *dumpOption) {
+		option.csvNull = s
+	}
+}
+
+// WithDisableKeys 表数据前后写 /*!40000 ALTER TABLE ... DISABLE KEYS */ 和 ENABLE KEYS, 同 mysqldump --disable-keys.
+// 导入 MyISAM 表时非唯一索引在数据导入后一次性重建; 对 InnoDB 无效, InnoDB 请使用 WithDeferIndexes
+func WithDisableKeys() DumpOption {
+	return func(option *dumpOption) {
+		option.isDisableKeys = true
+	}
+}
+
+// WithDumpProgress 导出表数据时在开始查询前 (rows 为 0), 每 1000 行以及每个表导出完后调用 fn, rows 为该表已导出的行数.
+// 串行导出时 fn 在调用 Dump 的 goroutine 中执行; 使用 WithParallelism 时会被多个 goroutine 并发调用,
+// fn 需要自行保证并发安全
+func WithDumpProgress(fn func(table string, rows uint64)) DumpOption {
+	return func(option *dumpOption) {
+		option.dumpProgress = fn
+	}
+}
+
+// WithApproximateRowCount 在每个表数据的注释中写入 information_schema.TABLES.TABLE_ROWS 估计的行数,
+// 便于导入前了解表的大小; 不执行 SELECT COUNT(*), 在十亿行的表上也只读取统计信息. InnoDB 的估计值可能相差较大,
+// 准确的行数见 DumpResult 和 WithDumpProgress
+func WithApproximateRowCount() DumpOption {
+	return func(option *dumpOption) {
+		option.isApproximateRowCount = true
+	}
+}
+
+// WithGzip 使用默认压缩级别将输出压缩为 gzip
+func WithGzip() DumpOption {
+	return WithCompression(gzip.DefaultCompression)
+}
+
+// WithCompression 使用指定压缩级别 (gzip.BestSpeed ~ gzip.BestCompression) 将输出压缩为 gzip,
+// Dump 返回前会关闭 gzip 流, 无需调用方处理
+func WithCompression(level int) DumpOption {
+	return func(option *dumpOption) {
+		option.isGzip = true
+		option.gzipLevel = level
+		option.compressor = nil
+		option.compressExtension = ""
+	}
+}
+
+// WithParallelGzip 使用 blocks 个 goroutine 并发压缩 gzip 输出, 每个 1MB 的块是一个独立的 gzip member,
+// 输出仍可用 gzip -d 和 Source 解压, 压缩率比 WithCompression 稍低
+func WithParallelGzip(level, blocks int) DumpOption {
+	return WithCompressor(".gz", parallelGzipCompressor(level, blocks))
+}
+
+// WithCompressor 使用 compressor 压缩输出, 如 pgzip 或 zstd 等第三方实现;
+// extension 为 WithFilePerTable 时文件的扩展名, 如 ".gz", ".zst"
+func WithCompressor(extension string, compressor Compressor) DumpOption {
+	return func(option *dumpOption) {
+		option.isGzip = true
+		option.compressor = compressor
+		option.compressExtension = extension
+	}
+}
+
+// WithReplaceDefiner 将视图, 存储过程, 函数, 触发器和事件的 DEFINER 替换为 definer,
+// definer 格式为 user@host 或 CURRENT_USER, 优先于 WithStripDefiner
+func WithReplaceDefiner(definer string) DumpOption {
+	return func(option *dumpOption) {
+		option.replaceDefiner = definer
+	}
+}
+
+// 导出到指定 writer, 与 WithFilePerTable 同时设置时被忽略
+func WithWriter(writer io.Writer) DumpOption {
+	return func(option *dumpOption) {
+		option.writer = writer
+	}
+}
+
+// WithBufferedWriter 导出到调用方已有的缓冲区 w, 不再创建内部的 bufio.Writer, 避免两层缓冲的复制.
+// 数据留在 w 中, 由调用方 Flush; 写入 w 的字节无法统计, DumpResult.BytesWritten 和 TableResult.Bytes 为 0.
+// 与 WithGzip, WithLineEnding 或 WithChecksum 同时使用时这些转换需要在缓冲区之下进行, 仍使用内部缓冲区
+func WithBufferedWriter(w *bufio.Writer) DumpOption {
+	return func(option *dumpOption) {
+		option.writer = w
+		option.bufferedWriter = w
+	}
+}
+
+// Dump 导出数据库 dbName; 查询中的表名都带数据库名, 不执行 USE, 不改变连接池中连接的当前数据库
+func Dump(db *sql.DB, dbName string, opts ...DumpOption) error {
+	return DumpContext(context.Background(), db, dbName, opts...)
+}
+
+// DumpContext 与 Dump 相同, 但所有查询都使用 ctx, ctx 取消后尽快返回 ctx.Err()
+func DumpContext(ctx context.Context, db *sql.DB, dbName string, opts ...DumpOption) error {
+	_, err := dump(ctx, dumpTarget{db: db}, dbName, opts...)
+	return err
+}
+
+// DumpWithResult 与 Dump 相同, 并返回每个表的行数, 字节数和耗时等统计
+func DumpWithResult(db *sql.DB, dbName string, opts ...DumpOption) (*DumpResult, error) {
+	return dump(context.Background(), dumpTarget{db: db}, dbName, opts...)
+}
+
+// DumpWithResultContext 与 DumpWithResult 相同, 但所有查询都使用 ctx
+func DumpWithResultContext(ctx context.Context, db *sql.DB, dbName string, opts ...DumpOption) (*DumpResult, error) {
+	return dump(ctx, dumpTarget{db: db}, dbName, opts...)
+}
+
+// DumpSchema 只导出结构到 w: 表结构, 以及按选项导出的视图, 存储过程, 触发器和事件, 不导出数据.
+// 与 DumpData 共用 Dump 的实现, Dump 仍是同时导出结构和数据的入口; w 优先于 WithWriter
+func DumpSchema(db *sql.DB, dbName string, w io.Writer, opts ...DumpOption) error {
+	return DumpSchemaContext(context.Background(), db, dbName, w, opts...)
+}
+
+// DumpSchemaContext 与 DumpSchema 相同, 但所有查询都使用 ctx 执行
+func DumpSchemaContext(ctx context.Context, db *sql.DB, dbName string, w io.Writer, opts ...DumpOption) error {
+	_, err := dump(ctx, dumpTarget{db: db}, dbName, append(opts, WithNoData(), WithWriter(w))...)
+	return err
+}
+
+// DumpData 只导出表数据的 INSERT 语句到 w, 不导出表结构, 视图, 存储过程, 触发器和事件; w 优先于 WithWriter
+func DumpData(db *sql.DB, dbName string, w io.Writer, opts ...DumpOption) error {
+	return DumpDataContext(context.Background(), db, dbName, w, opts...)
+}
+
+// DumpDataContext 与 DumpData 相同, 但所有查询都使用 ctx 执行
+func DumpDataContext(ctx context.Context, db *sql.DB, dbName string, w io.Writer, opts ...DumpOption) error {
+	_, err := dump(ctx, dumpTarget{db: db}, dbName, append(opts, withDataOnly(), WithWriter(w))...)
+	return err
+}
+
+// withDataOnly 只导出表数据, 覆盖其它结构相关的选项
+func withDataOnly() DumpOption {
+	return func(option *dumpOption) {
+		option.isNoCreateInfo = true
+		option.isNoData = false
+		option.isRoutines = false
+		option.isTriggers = false
+		option.isEvents = false
+		option.isGrants = false
+		option.isAllViews = false
+		option.views = nil
+	}
+}
+
+// DumpToBytes 导出数据库并以 []byte 返回全部内容, 会覆盖 opts 中的 WithWriter.
+// 整个 dump 都保存在内存中, 大数据库请使用 WithWriter 写入文件或使用 WithGzip 压缩
+func DumpToBytes(db *sql.DB, dbName string, opts ...DumpOption) ([]byte, error) {
+	var b bytes.Buffer
+	_, err := dump(context.Background(), dumpTarget{db: db}, dbName, append(opts, WithWriter(&b))...)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// DumpToString 与 DumpToBytes 相同, 但以 string 返回
+func DumpToString(db *sql.DB, dbName string, opts ...DumpOption) (string, error) {
+	b, err := DumpToBytes(db, dbName, opts...)
+	return string(b), err
+}
+
+// DumpReader 在后台 goroutine 中导出数据库, 通过返回的 io.ReadCloser 边导出边读取, 如直接 io.Copy 到 http.ResponseWriter;
+// 会覆盖 opts 中的 WithWriter. 导出出错时 Read 返回该错误, 正常结束时返回 io.EOF.
+// 调用方必须调用 Close, 提前 Close 会取消导出并等待 goroutine 结束
+func DumpReader(db *sql.DB, dbName string, opts ...DumpOption) (io.ReadCloser, error) {
+	return DumpReaderContext(context.Background(), db, dbName, opts...)
+}
+
+// DumpReaderContext 与 DumpReader 相同, 但所有查询都使用 ctx 执行, ctx 取消时 Read 返回 ctx 的错误
+func DumpReaderContext(ctx context.Context, db *sql.DB, dbName string, opts ...DumpOption) (io.ReadCloser, error) {
+	if o := newDumpOption(opts); o.filePerTableDir != "" {
+		return nil, errors.New("DumpReader does not support WithFilePerTable")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	r := &dumpReader{pr: pr, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		_, err := dump(ctx, dumpTarget{db: db}, dbName, append(opts, WithWriter(pw))...)
+		// err 为 nil 时读取方得到 io.EOF
+		_ = pw.CloseWithError(err)
+	}()
+	return r, nil
+}
+
+// dumpReader DumpReader 返回的 io.ReadCloser
+type dumpReader struct {
+	pr     *io.PipeReader
+	cancel context.CancelFunc
+	// 导出 goroutine 结束时关闭
+	done chan struct{}
+}
+
+func (r *dumpReader) Read(p []byte) (int, error) {
+	return r.pr.Read(p)
+}
+
+// Close 取消未完成的导出, 之后的写入立即失败, 等待导出 goroutine 结束
+func (r *dumpReader) Close() error {
+	r.cancel()
+	_ = r.pr.Close()
+	<-r.done
+	return nil
+}
+
+// rewriteStatement 使用 WithStatementRewriter 改写 CREATE 语句
+func (o *dumpOption) rewriteStatement(stmt string) string {
+	if o.statementRewriter == nil {
+		return stmt
+	}
+	return o.statementRewriter(stmt)
+}
+
+// targetDatabase 返回 dump 中使用的库名
+func (o *dumpOption) targetDatabase(dbName string) string {
+	if o.renameDatabase != "" {
+		return o.renameDatabase
+	}
+	return dbName
+}
+
+// renameQualifiers WithRenameDatabase 时将 createSQL 中以 `dbName`. 限定的名称改为新库名
+func (o *dumpOption) renameQualifiers(createSQL, dbName string) string {
+	if o.renameDatabase == "" || o.renameDatabase == dbName {
+		return createSQL
+	}
+	return strings.ReplaceAll(createSQL, quoteIdentifier(dbName)+".", quoteIdentifier(o.renameDatabase)+".")
+}
+
+// createTableIfNotExists 返回 CREATE TABLE 是否带 IF NOT EXISTS
+func (o *dumpOption) createTableIfNotExists() bool {
+	if o.createIfNotExists != nil {
+		return *o.createIfNotExists
+	}
+	return !o.isDropTable
+}
+
+// newDumpOption 应用 opts 并填充默认值
+func newDumpOption(opts []DumpOption) dumpOption {
+	var o dumpOption
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(o.tables) == 0 && len(o.tablePatterns) == 0 && len(o.tableRegexps) == 0 {
+		// 默认包含全部表
+		o.isAllTable = true
+	}
+
+	if len(o.views) == 0 && !o.isAllViews {
+		// 默认包含全部表
+		o.isAllViews = false
+	}
+
+	if o.isNoCreateInfo {
+		o.isData = true
+	}
+	if o.isNoData {
+		o.isData = false
+	}
+
+	if o.logger == nil {
+		o.logger = nopLogger{}
+	}
+
+	if o.insertBatchSize <= 0 {
+		o.insertBatchSize = defaultInsertBatchSize
+	}
+
+	if len(o.maskColumns) > 0 {
+		if o.maskFunc == nil {
+			o.maskFunc = MaskHash
+		}
+		o.rowRewriter = maskRowRewriter(o.maskColumns, o.maskFunc, o.rowRewriter)
+	}
+
+	if o.isSingleTransaction || o.isLockAllTables {
+		// 单事务和 WithLockAllTables 时不写每个表的 LOCK TABLES
+		o.isNoLockTables = true
+	}
+	if o.isSingleTransaction && o.isLockAllTables {
+		o.logger.Warnf("LOCK TABLES would commit the transaction of WithSingleTransaction, WithLockAllTables is ignored")
+	}
+
+	if o.terminator == "" {
+		o.terminator = ";"
+	}
+	if o.checksumWriter != nil {
+		o.manifest = &checksumManifest{}
+	}
+	if len(o.incrementals) > 0 {
+		o.watermarks = &watermarkSet{}
+	}
+	if o.lineEnding == "" {
+		o.lineEnding = "\n"
+	}
+
+	if o.writer == nil {
+		// 默认输出到 os.Stdout
+		o.writer = os.Stdout
+	}
+	return o
+}
+
+// DumpConn 在调用方提供的专用连接 conn 上导出数据库, USE, LOCK TABLES, SET 等会话状态都在同一个会话中,
+// 适用于依赖会话变量的服务器或代理. 所有查询都在 conn 上顺序执行, 忽略 WithParallelism;
+// WithBinlogPosition 的全局读锁也加在 conn 上. conn 由调用方打开和关闭, DumpConn 不关闭 conn
+func DumpConn(ctx context.Context, conn *sql.Conn, dbName string, opts ...DumpOption) error {
+	_, err := dump(ctx, dumpTarget{conn: conn}, dbName, opts...)
+	return err
+}
+
+// DumpDatabases 依次导出 dbNames 中的数据库到同一个输出, 每个库是一段完整的 dump: 有自己的开头注释和结尾,
+// 在 USE 之前写入 CREATE DATABASE IF NOT EXISTS (WithCreateDatabase), 导入时按顺序切换数据库.
+// 各库的快照和锁相互独立, WithSingleTransaction 不保证多个库之间的一致性.
+// 不支持 WithFilePerTable, WithChecksum 和 WithRenameDatabase
+func DumpDatabases(db *sql.DB, dbNames []string, opts ...DumpOption) error {
+	return DumpDatabasesContext(context.Background(), db, dbNames, opts...)
+}
+
+// DumpDatabasesContext 与 DumpDatabases 相同, 但所有查询都使用 ctx 执行
+func DumpDatabasesContext(ctx context.Context, db *sql.DB, dbNames []string, opts ...DumpOption) error {
+	o := newDumpOption(opts)
+	switch {
+	case o.filePerTableDir != "":
+		return errors.New("DumpDatabases does not support WithFilePerTable")
+	case o.checksumWriter != nil:
+		return errors.New("DumpDatabases does not support WithChecksum")
+	case o.renameDatabase != "":
+		return errors.New("DumpDatabases does not support WithRenameDatabase")
+	}
+	// 所有库写入同一个 writer, 未指定时为 newDumpOption 的默认值
+	opts = append(opts, WithCreateDatabase(), WithWriter(o.writer))
+	for _, dbName := range dbNames {
+		_, err := dump(ctx, dumpTarget{db: db}, dbName, opts...)
+		if err != nil {
+			return fmt.Errorf("dump database %s: %w", dbName, err)
+		}
+	}
+	return nil
+}
+
+// dumpTarget 导出使用的连接池或调用方的专用连接, 二者只有一个不为 nil
+type dumpTarget struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func (t dumpTarget) queryer() queryer {
+	if t.conn != nil {
+		return t.conn
+	}
+	return t.db
+}
+
+// session 返回一个专用连接; 使用调用方的连接时 release 不关闭连接
+func (t dumpTarget) session(ctx context.Context) (conn *sql.Conn, release func(), err error) {
+	if t.conn != nil {
+		return t.conn, func() {}, nil
+	}
+	conn, err = t.db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() { _ = conn.Close() }, nil
+}
+
+func (t dumpTarget) beginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if t.conn != nil {
+		return t.conn.BeginTx(ctx, opts)
+	}
+	return t.db.BeginTx(ctx, opts)
+}
+
+// dump 导出数据库, 是所有 Dump 函数的实现
+func dump(ctx context.Context, target dumpTarget, dbName string, opts ...DumpOption) (*DumpResult, error) {
+	// 打印开始
+	start := time.Now()
+	// 打印结束
+	var err error
+
+	o := newDumpOption(opts)
+	if err := validateDumpNames(dbName, &o); err != nil {
+		return nil, err
+	}
+
+	if o.overallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.overallTimeout)
+		defer cancel()
+	}
+
+	if target.conn != nil && o.parallelism > 1 {
+		o.logger.Warnf("DumpConn reads all tables on the given connection, WithParallelism is ignored")
+		o.parallelism = 1
+	}
+
+	// WithBinlogPosition 时在全局读锁下记录 binlog 位置, 单事务模式下建立快照后即解锁, 否则全部表读取后解锁
+	var unlockGlobal func()
+	if o.isBinlogPosition {
+		lockConn, release, err := target.session(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		unlockGlobal, err = flushTablesWithReadLock(ctx, lockConn)
+		if err != nil {
+			return nil, err
+		}
+		defer unlockGlobal()
+	}
+
+	// 所有查询都通过 q 执行, 单事务模式下为同一个 *sql.Tx
+	q := target.queryer()
+	if o.isSingleTransaction {
+		if o.parallelism > 1 {
+			o.logger.Warnf("WithSingleTransaction reads all tables on one connection, WithParallelism is ignored")
+			o.parallelism = 1
+		}
+		if o.isBinlogPosition {
+			conn, release, err := target.session(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			end, err := beginConsistentSnapshot(ctx, conn)
+			if err != nil {
+				return nil, err
+			}
+			defer end()
+			q = conn
+		} else {
+			tx, err := target.beginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+			if err != nil {
+				return nil, err
+			}
+			// 只读事务, 结束时回滚即可
+			defer tx.Rollback()
+			q = tx
+		}
+	} else if o.isLockAllTables {
+		if o.parallelism > 1 {
+			o.logger.Warnf("WithLockAllTables reads all tables on one connection, WithParallelism is ignored")
+			o.parallelism = 1
+		}
+		// 表锁属于会话, 加锁和读取必须在同一个连接上
+		conn, release, err := target.session(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		q = conn
+	}
+	if o.retryAttempts > 1 {
+		q = newRetryQueryer(q, o.retryAttempts, o.retryBackoff, o.logger)
+	}
+
+	var binlogPosition *BinlogPosition
+	if o.isBinlogPosition {
+		binlogPosition, err = getBinlogPosition(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if o.isSingleTransaction {
+			unlockGlobal()
+		}
+	}
+
+	// 2. 获取表, 在写入任何输出之前检查 WithTables 指定的表是否存在
+	allTables, err := getAllTables(ctx, q, dbName)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	if o.isAllTable {
+		tables = allTables
+	} else {
+		names := o.tables
+		if missing := missingTables(allTables, names); len(missing) > 0 {
+			if !o.isIgnoreMissingTables {
+				return nil, fmt.Errorf("tables not found in %s: %q", dbName, missing)
+			}
+			o.logger.Warnf("tables not found in %s, skipping: %q", dbName, missing)
+			names = slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+				return slices.Contains(missing, name)
+			})
+		}
+		if len(o.tablePatterns) > 0 || len(o.tableRegexps) > 0 {
+			tables, err = selectTables(allTables, names, o.tablePatterns, o.tableRegexps)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			tables = names
+		}
+	}
+	tables, err = excludeTables(tables, o.excludeTables)
+	if err != nil {
+		return nil, err
+	}
+	if o.minTableBytes > 0 || o.maxTableBytes > 0 {
+		sizes, err := getTableSizes(ctx, q, dbName)
+		if err != nil {
+			return nil, err
+		}
+		tables = filterTablesBySize(tables, sizes, o.minTableBytes, o.maxTableBytes)
+	}
+
+	result := &DumpResult{StartTime: start, BinlogPosition: binlogPosition}
+	var out *dumpOutput
+	if o.filePerTableDir != "" {
+		err = os.MkdirAll(o.filePerTableDir, 0o755)
+		if err != nil {
+			return nil, err
+		}
+		if o.format == FormatSQL {
+			out, err = createDumpOutput(o.filePerTableDir, schemaFileName, &o)
+		} else {
+			// 其它格式只有表数据, 不需要 _schema 文件
+			out, err = newDumpOutput(io.Discard, &o)
+		}
+	} else {
+		out, err = newDumpOutput(o.writer, &o)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 出错返回时也保证输出是完整的 gzip 流
+	defer out.close()
+	buf := out.buf
+
+	charset := o.charset
+	if charset == "" {
+		charset, err = getConnectionCharset(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !isValidCharsetName(charset) {
+		return nil, fmt.Errorf("invalid charset name %q", charset)
+	}
+	o.dumpCharset = charset
+	var createDatabase string
+	if o.isCreateDatabase {
+		createDatabase, err = getCreateDatabaseSQL(ctx, q, dbName, o.targetDatabase(dbName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 打印 Header
+	if o.format == FormatSQL {
+		writeHeader(buf, &o, dbName, charset, createDatabase, start)
+		if binlogPosition != nil {
+			writeBinlogPosition(buf, binlogPosition)
+		}
+		// 写入失败的 writer (如已断开的管道) 不必再读取任何表
+		if err := bufferError(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	var views []string
+
+	tmp, err := getAllViews(ctx, q, dbName)
+	//Remove views from tables
+	for _, view := range tmp {
+		index := slices.Index(tables, view)
+		if index != -1 {
+			// Remove the element at the found index
+			tables = slices.Delete(tables, index, index+1)
+		}
+
+	}
+	if o.isAllViews {
+		if err != nil {
+			return nil, err
+		}
+		views = tmp
+	} else {
+		views = o.views
+	}
+
+	// 视图可能引用其它视图, 被引用的视图先创建
+	if len(views) > 1 {
+		definitions, err := getViewDefinitions(ctx, q, dbName)
+		if err != nil {
+			return nil, err
+		}
+		sorted, ok := sortByDependency(views, viewDependencies(dbName, definitions))
+		if !ok {
+			o.logger.Warnf("cyclic view dependency found in %s, keeping original view order", dbName)
+		}
+		views = sorted
+	}
+
+	if o.isSortByDependency {
+		deps, err := getForeignKeyDependencies(ctx, q, dbName)
+		if err != nil {
+			return nil, err
+		}
+		sorted, ok := sortByDependency(tables, deps)
+		if !ok {
+			o.logger.Warnf("cyclic foreign key dependency found in %s, keeping original table order", dbName)
+		}
+		tables = sorted
+	}
+
+	allTotalRows := uint64(0)
+	// 3. 导出表
+	dumpTable := func(ctx context.Context, table string, buf *bufio.Writer) (TableResult, error) {
+		rows, err := writeTable(ctx, q, dbName, table, buf, &o)
+		if o.format == FormatCSV {
+			// 同一个输出中的各个表以空行分隔
+			_, _ = buf.WriteString("\n")
+		}
+		return TableResult{Name: table, Rows: rows}, err
+	}
+	if o.filePerTableDir != "" {
+		dumpTable = func(ctx context.Context, table string, _ *bufio.Writer) (TableResult, error) {
+			return writeTableFile(ctx, q, dbName, table, charset, createDatabase, start, &o)
+		}
+	}
+	if o.tableTimeout > 0 {
+		dumpTable = withTableTimeout(dumpTable, o.tableTimeout)
+	}
+	if o.isSkipVanishedTables {
+		dumpTable = withSkipVanishedTables(dumpTable, o.logger)
+	}
+	if o.isLockAllTables && !o.isSingleTransaction && len(tables) > 0 {
+		var unlock func()
+		unlock, err = lockTablesForRead(ctx, q, dbName, tables)
+		if err != nil {
+			return nil, err
+		}
+		// 出错返回时也要解锁, 否则连接带着表锁回到连接池
+		defer unlock()
+		result.Tables, err = writeTables(ctx, tables, out, &o, dumpTable)
+		// 加锁期间不能读取未加锁的视图, 导出表后立即解锁
+		unlock()
+	} else {
+		result.Tables, err = writeTables(ctx, tables, out, &o, dumpTable)
+	}
+	if unlockGlobal != nil {
+		// 表数据已读取, 不再阻止其它会话写入
+		unlockGlobal()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tableFileBytes int64
+	result.Tables = slices.DeleteFunc(result.Tables, func(tableResult TableResult) bool {
+		if tableResult.Skipped {
+			result.SkippedTables = append(result.SkippedTables, tableResult.Name)
+		}
+		return tableResult.Skipped
+	})
+	for _, tableResult := range result.Tables {
+		allTotalRows += tableResult.Rows
+		if o.filePerTableDir != "" {
+			tableFileBytes += tableResult.Bytes
+		}
+	}
+	if o.format == FormatSQL {
+		var analyzeTables []string
+		if o.filePerTableDir == "" {
+			for _, tableResult := range result.Tables {
+				analyzeTables = append(analyzeTables, tableResult.Name)
+			}
+		}
+		result.Views, err = writeSchemaObjects(ctx, q, dbName, views, analyzeTables, buf, &o)
+		if err != nil {
+			return nil, err
+		}
+		writeFooter(buf, &o, start, len(result.Tables), allTotalRows)
+	}
+	// 出错时 close 返回缓冲区记录的写入错误
+	err = out.close()
+	if err != nil {
+		return nil, err
+	}
+	if o.manifest != nil {
+		err = o.manifest.writeTo(o.checksumWriter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.TotalRows = allTotalRows
+	if o.watermarks != nil {
+		result.Watermarks = maps.Clone(o.watermarks.values)
+	}
+	result.BytesWritten = out.written() + tableFileBytes
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(start)
+	o.logger.Infof("dumped %s: %d tables, %d rows, %d bytes in %s", dbName, len(result.Tables), result.TotalRows, result.BytesWritten, result.Duration)
+	return result, nil
+}
+
+// writeSchemaObjects 在表之后写入存储过程, 事件和视图, 以及 WithAnalyzeAfterRestore 时 analyzeTables 的 ANALYZE TABLE, 返回已导出的视图
+func writeSchemaObjects(ctx context.Context, q queryer, dbName string, views, analyzeTables []string, buf *bufio.Writer, o *dumpOption) ([]string, error) {
+	var written []string
+	var err error
+	// Committing transaction so Views Can Be Defined Without Issues
+	if o.withTransaction {
+		_, _ = buf.WriteString("COMMIT" + o.terminator + "\n")
+		_, _ = buf.WriteString("SET AUTOCOMMIT=1" + o.terminator + "\n")
+	}
+	// 4. Routines
+	if o.isRoutines {
+		err = writeRoutines(ctx, q, dbName, buf, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 5. Events
+	if o.isEvents {
+		err = writeEvents(ctx, q, dbName, buf, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 6. Views
+
+	for _, view := range views {
+		// 删除表
+		if o.isDropView {
+			_, _ = buf.WriteString(fmt.Sprintf("DROP VIEW IF EXISTS %s%s\n", quoteIdentifier(view), o.terminator))
+		}
+
+		// 导出视图结构
+		err = writeViewStruct(ctx, q, dbName, view, buf, o)
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, view)
+	}
+
+	// 7. Grants
+	if o.isGrants {
+		err = writeGrants(ctx, q, dbName, buf, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 8. ANALYZE TABLE, 会隐式提交, 写在事务之外
+	writeAnalyzeTables(analyzeTables, buf, o)
+
+	// Again Starting Transaction For Data Insertion
+	if o.withTransaction {
+		_, _ = buf.WriteString("SET AUTOCOMMIT=0" + o.terminator + "\n")
+		_, _ = buf.WriteString("START TRANSACTION" + o.terminator + "\n\n")
+	}
+	return written, bufferError(buf)
+}
+
+// DumpTable 导出连接当前数据库 (DSN 中的数据库) 中的一个表到 w, 只包含表结构以及 WithData 时的数据,
+// 不写入开头和结尾; w 优先于 WithWriter
+func DumpTable(db *sql.DB, table string, w io.Writer, opts ...DumpOption) error {
+	return DumpTableContext(context.Background(), db, table, w, opts...)
+}
+
+// DumpTableContext 与 DumpTable 相同, 但所有查询都使用 ctx 执行
+func DumpTableContext(ctx context.Context, db *sql.DB, table string, w io.Writer, opts ...DumpOption) error {
+	if err := validateIdentifier("table", table); err != nil {
+		return err
+	}
+	o := newDumpOption(opts)
+	out, err := newDumpOutput(w, &o)
+	if err != nil {
+		return err
+	}
+	defer out.close()
+
+	// DSN 中没有数据库时 DATABASE() 返回 NULL
+	var dbName sql.NullString
+	err = db.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&dbName)
+	if err != nil {
+		return err
+	}
+	if !dbName.Valid {
+		return errors.New("DumpTable: no database selected on the connection")
+	}
+	_, err = writeTable(ctx, db, dbName.String, table, out.buf, &o)
+	if err != nil {
+		return err
+	}
+	return out.close()
+}
+
+// GetCreateStatements 返回数据库 dbName 中每个表和视图的名称到 SHOW CREATE 语句的映射,
+// 语句原样返回, 不带 IF NOT EXISTS 也不做其它改写, 可用于与目标数据库比较
+func GetCreateStatements(db *sql.DB, dbName string) (map[string]string, error) {
+	return GetCreateStatementsContext(context.Background(), db, dbName)
+}
+
+// GetCreateStatementsContext 与 GetCreateStatements 相同, 但所有查询都使用 ctx 执行
+func GetCreateStatementsContext(ctx context.Context, db *sql.DB, dbName string) (map[string]string, error) {
+	if err := validateIdentifier("database", dbName); err != nil {
+		return nil, err
+	}
+	// SHOW TABLES 的结果包含视图
+	tables, err := getAllTables(ctx, db, dbName)
+	if err != nil {
+		return nil, err
+	}
+	statements := make(map[string]string, len(tables))
+	for _, table := range tables {
+		createSQL, err := getCreateTableSQL(ctx, db, dbName, table)
+		if err != nil {
+			return nil, err
+		}
+		statements[table] = createSQL
+	}
+	return statements, nil
+}
+
+// writeTable 导出单个表的结构, 数据和触发器, 返回导出的行数
+func writeTable(ctx context.Context, db queryer, dbName, table string, buf *bufio.Writer, o *dumpOption) (uint64, error) {
+	// 表结构和数据共用一次查询到的列
+	var columns []tableColumn
+	if o.format != FormatSQL || !o.isNoCreateInfo || o.isData {
+		var err error
+		columns, err = getTableColumns(ctx, db, dbName, table)
+		if err != nil {
+			return 0, err
+		}
+	}
+	switch o.format {
+	case FormatCSV:
+		return writeTableCSV(ctx, db, dbName, table, columns, buf, o)
+	case FormatJSONL:
+		return writeTableJSONL(ctx, db, dbName, table, columns, buf, o)
+	}
+	var totalRows uint64
+	var indexes []string
+	if !o.isNoCreateInfo {
+		// 删除表
+		if o.isDropTable {
+			drop := "DROP TABLE"
+			if o.isTemporaryTables {
+				drop = "DROP TEMPORARY TABLE"
+			}
+			_, _ = buf.WriteString(fmt.Sprintf("%s IF EXISTS %s%s\n", drop, quoteIdentifier(table), o.terminator))
+		}
+
+		// 导出表结构
+		var err error
+		indexes, err = writeTableStruct(ctx, db, dbName, table, columns, buf, o)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if o.isData {
+		if !o.isNoLockTables {
+			_, _ = buf.WriteString(fmt.Sprintf("LOCK TABLES %s WRITE%s \n\n", quoteIdentifier(table), o.terminator))
+		}
+		if o.isDisableKeys {
+			_, _ = buf.WriteString(fmt.Sprintf("/*!40000 ALTER TABLE %s DISABLE KEYS */%s\n", quoteIdentifier(table), o.terminator))
+		}
+		var err error
+		totalRows, err = writeTableData(ctx, db, dbName, table, columns, buf, o)
+		if o.isDisableKeys {
+			_, _ = buf.WriteString(fmt.Sprintf("/*!40000 ALTER TABLE %s ENABLE KEYS */%s\n", quoteIdentifier(table), o.terminator))
+		}
+		if !o.isNoLockTables {
+			_, _ = buf.WriteString("UNLOCK TABLES" + o.terminator + "\n\n")
+		}
+		if err != nil {
+			return totalRows, err
+		}
+		writeDeferredIndexes(table, indexes, buf, o)
+	}
+	if o.isTriggers {
+		err := writeTableTriggers(ctx, db, dbName, table, buf, o)
+		if err != nil {
+			return totalRows, err
+		}
+	}
+	return totalRows, bufferError(buf)
+}
+
+// lockTablesForRead 用一条 LOCK TABLES 以 READ 锁定 tables, 返回的 unlock 可重复调用
+func lockTablesForRead(ctx context.Context, q queryer, dbName string, tables []string) (unlock func(), err error) {
+	locks := make([]string, len(tables))
+	for i, table := range tables {
+		locks[i] = qualifiedName(dbName, table) + " READ"
+	}
+	_, err = q.ExecContext(ctx, "LOCK TABLES "+strings.Join(locks, ", "))
+	if err != nil {
+		return nil, err
+	}
+	unlocked := false
+	return func() {
+		if unlocked {
+			return
+		}
+		unlocked = true
+		// ctx 可能已取消, 解锁不使用 ctx
+		_, _ = q.ExecContext(context.Background(), "UNLOCK TABLES")
+	}, nil
+}
+
+// writeTableFile 将一个表写入 WithFilePerTable 目录中单独的文件, 文件有完整的开头和结尾
+func writeTableFile(ctx context.Context, db queryer, dbName, table, charset, createDatabase string, start time.Time, o *dumpOption) (TableResult, error) {
+	tableResult := TableResult{Name: table}
+	out, err := createDumpOutput(o.filePerTableDir, table, o)
+	if err != nil {
+		return tableResult, err
+	}
+	defer out.close()
+	if o.format == FormatSQL {
+		writeHeader(out.buf, o, dbName, charset, createDatabase, start)
+		if err := bufferError(out.buf); err != nil {
+			return tableResult, err
+		}
+	}
+	tableResult.Rows, err = writeTable(ctx, db, dbName, table, out.buf, o)
+	if err != nil {
+		return tableResult, err
+	}
+	if o.format == FormatSQL {
+		writeAnalyzeTables([]string{table}, out.buf, o)
+		writeFooter(out.buf, o, start, 1, tableResult.Rows)
+	}
+	err = out.close()
+	tableResult.Bytes = out.counter.n
+	return tableResult, err
+}
+
+// getConnectionCharset 返回查询结果使用的字符集, 即 dump 中数据的编码
+func getConnectionCharset(ctx context.Context, db queryer) (string, error) {
+	var charset sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT @@character_set_results").Scan(&charset)
+	if err != nil {
+		return "", err
+	}
+	// NULL 或 binary 表示不转换, 无法确定编码
+	if !charset.Valid || charset.String == "" || charset.String == "binary" {
+		return defaultCharset, nil
+	}
+	return charset.String, nil
+}
 
-	// 导出表数据
-	_, _ = buf.WriteString("-- ----------------------------\n")
-	_, _ = buf.WriteString(fmt.Sprintf("-- Records of %s (%d Rows)\n", table, totalRow))
-	_, _ = buf.WriteString("-- ----------------------------\n")
+// getCreateDatabaseSQL 从 information_schema.SCHEMATA 读取 dbName 的默认字符集和排序规则, 返回创建 targetName 的 CREATE DATABASE 语句
+func getCreateDatabaseSQL(ctx context.Context, db queryer, dbName, targetName string) (string, error) {
+	var charset, collation string
+	err := db.QueryRowContext(ctx, "SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", dbName).Scan(&charset, &collation)
+	if err != nil {
+		return "", err
+	}
+	if !isValidCharsetName(charset) || !isValidCharsetName(collation) {
+		return "", fmt.Errorf("invalid charset %q or collation %q of database %s", charset, collation, dbName)
+	}
+	return createDatabaseSQL(targetName, charset, collation), nil
+}
+
+// isValidCharsetName 字符集名称只能包含字母, 数字和下划线
+func isValidCharsetName(charset string) bool {
+	if charset == "" {
+		return false
+	}
+	for _, c := range charset {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// maxIdentifierLength 库名, 表名和列名的最大字符数
+const maxIdentifierLength = 64
+
+// validateIdentifier 检查调用方传入的库名或表名是否为合法的 MySQL 标识符: 非空, 不超过 64 个字符, 有效的 UTF-8,
+// 不含 NUL 和 U+FFFF 以上的字符, 不以空格结尾. 反引号是合法字符, 所有 SQL 都通过 quoteIdentifier 转义, 不能跳出引号
+func validateIdentifier(kind, name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("empty %s name", kind)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("invalid %s name %q: not valid UTF-8", kind, name)
+	case utf8.RuneCountInString(name) > maxIdentifierLength:
+		return fmt.Errorf("invalid %s name %q: longer than %d characters", kind, name, maxIdentifierLength)
+	case strings.HasSuffix(name, " "):
+		return fmt.Errorf("invalid %s name %q: ends with a space", kind, name)
+	}
+	for _, c := range name {
+		if c == 0 || c > 0xFFFF {
+			return fmt.Errorf("invalid %s name %q: contains %U", kind, name, c)
+		}
+	}
+	return nil
+}
+
+// validateDumpNames 在执行任何查询之前检查库名, WithRenameDatabase, WithTables 和 WithViews 中的名称
+func validateDumpNames(dbName string, o *dumpOption) error {
+	if err := validateIdentifier("database", dbName); err != nil {
+		return err
+	}
+	if o.renameDatabase != "" {
+		if err := validateIdentifier("database", o.renameDatabase); err != nil {
+			return err
+		}
+	}
+	for _, table := range o.tables {
+		if err := validateIdentifier("table", table); err != nil {
+			return err
+		}
+	}
+	for _, view := range o.views {
+		if err := validateIdentifier("view", view); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteIdentifier 用反引号包裹标识符, 标识符中的反引号写两次
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// qualifiedName 返回 `dbName`.`name`, 查询时不依赖连接的当前数据库
+func qualifiedName(dbName, name string) string {
+	return quoteIdentifier(dbName) + "." + quoteIdentifier(name)
+}
+
+func getCreateTableSQL(ctx context.Context, db queryer, dbName, table string) (string, error) {
+	var createTableSQL string
 
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM `%s`", table))
+	rows, err := db.QueryContext(ctx, "SHOW CREATE TABLE "+qualifiedName(dbName, table))
 	if err != nil {
-		return totalRow, err
+		return "", err
 	}
-	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	} else if len(columns) < 2 {
+		return "", fmt.Errorf("less then 2 columns found on querying table %s", table)
+	}
+	extras := make([]any, len(columns))
+	extras[1] = &createTableSQL
+	extras[0] = &table
+	if !rows.Next() {
+		return "", fmt.Errorf("table %s not found", table)
+	}
+	var notNeededData string
+	if len(columns) > 2 {
+		for i := 2; i < len(columns); i++ {
+			extras[i] = &notNeededData
+		}
+	}
+	err = rows.Scan(extras...)
+	if err != nil {
+		return "", err
+	}
+	rows.Close()
+	return createTableSQL, nil
+}
 
-	var columns []string
-	columns, err = rows.Columns()
+func getAllTables(ctx context.Context, db queryer, dbName string) ([]string, error) {
+	var tables []string
+	rows, err := db.QueryContext(ctx, "SHOW TABLES FROM "+quoteIdentifier(dbName))
 	if err != nil {
-		return totalRow, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	quotedColumns := make([]string, len(columns))
-	for i, col := range columns {
-		quotedColumns[i] = "`" + col + "`"
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
 	}
 
-	columnNames := strings.Join(quotedColumns, ",")
+	return tables, nil
+}
+
+var autoIncrementRegexp = regexp.MustCompile(`\s+AUTO_INCREMENT=\d+`)
+
+// rewriteCreateTable 按 WithTemporaryTables 和 IF NOT EXISTS 改写 SHOW CREATE TABLE 开头的 CREATE TABLE
+func rewriteCreateTable(createTableSQL string, temporary, ifNotExists bool) string {
+	rest, ok := strings.CutPrefix(createTableSQL, "CREATE TABLE")
+	if !ok {
+		return createTableSQL
+	}
+	prefix := "CREATE TABLE"
+	if temporary {
+		prefix = "CREATE TEMPORARY TABLE"
+	}
+	if ifNotExists {
+		prefix += " IF NOT EXISTS"
+	}
+	return prefix + rest
+}
+
+// removeAutoIncrement 删除表选项中的 AUTO_INCREMENT=<n>, 列定义和注释不受影响
+func removeAutoIncrement(createTableSQL string) string {
+	// 表选项位于列定义的右括号之后, SHOW CREATE TABLE 中该括号总在行首
+	idx := strings.Index(createTableSQL, "\n)")
+	if idx == -1 {
+		return createTableSQL
+	}
+	return createTableSQL[:idx] + autoIncrementRegexp.ReplaceAllString(createTableSQL[idx:], "")
+}
+
+// partitionRegexp MySQL 的 /*!50100 PARTITION BY 和 MariaDB 不带条件注释的 PARTITION BY, 总在新的一行开始
+var partitionRegexp = regexp.MustCompile(`\n ?(/\*!\d{5} )?PARTITION BY `)
+
+// removePartitioning 删除表选项之后的分区定义, 分区定义总在 CREATE TABLE 的末尾
+func removePartitioning(createTableSQL string) string {
+	idx := strings.Index(createTableSQL, "\n)")
+	if idx == -1 {
+		return createTableSQL
+	}
+	loc := partitionRegexp.FindStringIndex(createTableSQL[idx:])
+	if loc == nil {
+		return createTableSQL
+	}
+	return createTableSQL[:idx+loc[0]]
+}
 
-	if totalRow > 0 {
-		dataValueString := []string{}
-		rowNumber := 0
-		for rows.Next() {
-			data := make([]*sql.NullString, len(columns))
-			ptrs := make([]interface{}, len(columns))
-			for i := range data {
-				ptrs[i] = &data[i]
+// removeExpressionDefaults 删除列定义中引号之外的 DEFAULT (expr), 注释和字符串默认值中的文字不受影响;
+// SHOW CREATE TABLE 中的表达式默认值总是写在括号中
+func removeExpressionDefaults(createTableSQL string) string {
+	end := strings.Index(createTableSQL, "\n)")
+	if end == -1 {
+		return createTableSQL
+	}
+	var b strings.Builder
+	start := 0
+	for i := 0; i < end; i++ {
+		switch c := createTableSQL[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(createTableSQL, i) - 1
+			if i < 0 {
+				return createTableSQL
 			}
+		case c == ' ' && strings.HasPrefix(createTableSQL[i:], " DEFAULT ("):
+			exprEnd := tupleEnd(createTableSQL, i+len(" DEFAULT "))
+			if exprEnd < 0 || exprEnd > end {
+				return createTableSQL
+			}
+			b.WriteString(createTableSQL[start:i])
+			start = exprEnd
+			i = exprEnd - 1
+		}
+	}
+	b.WriteString(createTableSQL[start:])
+	return b.String()
+}
+
+var engineRegexp = regexp.MustCompile(`\bENGINE\s*=\s*\w+`)
+
+// setEngine 将表选项和各个分区的 ENGINE 改为 engine, 没有 ENGINE 子句时加在表选项开头
+func setEngine(createTableSQL, engine string) string {
+	idx := strings.Index(createTableSQL, "\n)")
+	if idx == -1 {
+		return createTableSQL
+	}
+	options := createTableSQL[idx+len("\n)"):]
+	if !engineRegexp.MatchString(options) {
+		return createTableSQL[:idx] + "\n) ENGINE=" + engine + options
+	}
+	return createTableSQL[:idx] + "\n)" + engineRegexp.ReplaceAllStringFunc(options, func(match string) string {
+		// 保留原来的 = 两侧空白, 分区中为 ENGINE = InnoDB
+		return match[:strings.LastIndexAny(match, "= ")+1] + engine
+	})
+}
+
+// secondaryKeyPrefixes SHOW CREATE TABLE 中二级索引定义的开头
+var secondaryKeyPrefixes = []string{"KEY ", "UNIQUE KEY ", "FULLTEXT KEY ", "SPATIAL KEY "}
+
+// splitSecondaryIndexes 从 CREATE TABLE 中移除二级索引, 返回移除后的语句和被移除的索引定义.
+// 主键, 外键和 CHECK 约束保留; 以 AUTO_INCREMENT 列开头的索引也保留, 因为自增列必须有索引
+func splitSecondaryIndexes(createTableSQL string) (string, []string) {
+	lines := strings.Split(createTableSQL, "\n")
+	// lines[0] 为 CREATE TABLE ... (, 列定义到第一个以 ) 开头的行结束
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], ")") {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return createTableSQL, nil
+	}
+
+	var autoIncrementColumn string
+	for _, line := range lines[1:end] {
+		def := strings.TrimSpace(line)
+		if strings.HasPrefix(def, "`") && strings.Contains(def, " AUTO_INCREMENT") {
+			autoIncrementColumn = leadingIdentifier(def)
+		}
+	}
+
+	var kept, indexes []string
+	for _, line := range lines[1:end] {
+		def := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		if isSecondaryKey(def) && (autoIncrementColumn == "" || !strings.Contains(def, " ("+autoIncrementColumn)) {
+			indexes = append(indexes, def)
+			continue
+		}
+		kept = append(kept, "  "+def)
+	}
+	if len(indexes) == 0 {
+		return createTableSQL, nil
+	}
+	result := append([]string{lines[0]}, strings.Join(kept, ",\n"))
+	result = append(result, lines[end:]...)
+	return strings.Join(result, "\n"), indexes
+}
+
+// leadingIdentifier 返回 def 开头带反引号的标识符, 标识符中的反引号写作两个
+func leadingIdentifier(def string) string {
+	for i := 1; i < len(def); i++ {
+		if def[i] != '`' {
+			continue
+		}
+		if i+1 < len(def) && def[i+1] == '`' {
+			i++
+			continue
+		}
+		return def[:i+1]
+	}
+	return ""
+}
+
+func isSecondaryKey(def string) bool {
+	for _, prefix := range secondaryKeyPrefixes {
+		if strings.HasPrefix(def, prefix) {
+			return true
+		}
+	}
+	return false
+}
 
-			// Read data
-			if err := rows.Scan(ptrs...); err != nil {
-				return totalRow, err
+// selectTables 按 allTables 的顺序返回在 names 中或匹配任意 patterns, expressions 的表;
+// 只有 names 之外的条件时, 没有表匹配返回错误
+func selectTables(allTables, names, patterns []string, expressions []*regexp.Regexp) ([]string, error) {
+	var selected []string
+	for _, table := range allTables {
+		matched := slices.Contains(names, table)
+		for _, pattern := range patterns {
+			if matched {
+				break
+			}
+			ok, err := path.Match(pattern, table)
+			if err != nil {
+				return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+			}
+			matched = ok
+		}
+		for _, expression := range expressions {
+			if matched {
+				break
 			}
+			matched = expression.MatchString(table)
+		}
+		if matched {
+			selected = append(selected, table)
+		}
+	}
+	if len(selected) == 0 {
+		descriptions := slices.Clone(patterns)
+		for _, expression := range expressions {
+			descriptions = append(descriptions, expression.String())
+		}
+		return nil, fmt.Errorf("no tables match %q", descriptions)
+	}
+	return selected, nil
+}
+
+// missingTables 返回 names 中不在 allTables 里的表
+func missingTables(allTables, names []string) []string {
+	var missing []string
+	for _, name := range names {
+		if !slices.Contains(allTables, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
 
-			dataStrings := make([]string, len(columns))
-			for key, value := range data {
-				if value != nil && value.Valid {
-					escaped := strings.ReplaceAll(value.String, "'", "''")
-					dataStrings[key] = "'" + escaped + "'"
-				} else {
-					dataStrings[key] = "NULL"
-				}
+// excludeTables 返回 tables 中不匹配任何 patterns 的表
+func excludeTables(tables []string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return tables, nil
+	}
+	var filtered []string
+	for _, table := range tables {
+		excluded := false
+		for _, pattern := range patterns {
+			matched, err := path.Match(pattern, table)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
 			}
-			dataValueString = append(dataValueString, "("+strings.Join(dataStrings, ",")+")")
-			rowNumber += 1
-			if rowNumber >= 600 {
-				writeDataInsertToBuffer(table, columnNames, dataValueString, buf)
-				rowNumber = 0
-				dataValueString = []string{}
+			if matched {
+				excluded = true
+				break
 			}
 		}
-		if rowNumber > 0 {
-			writeDataInsertToBuffer(table, columnNames, dataValueString, buf)
+		if !excluded {
+			filtered = append(filtered, table)
+		}
+	}
+	return filtered, nil
+}
+
+func getAllViews(ctx context.Context, db queryer, dbName string) ([]string, error) {
+	var views []string
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'VIEW'", dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, table)
+	}
+	return views, nil
+}
+
+// writeTableStruct 导出表结构, columns 为 getTableColumns 返回的列; WithDeferIndexes 时返回从 CREATE TABLE 中移除的二级索引
+func writeTableStruct(ctx context.Context, db queryer, dbName, table string, columns []tableColumn, buf *bufio.Writer, o *dumpOption) ([]string, error) {
+	// 导出表结构
+	writeComment(buf, o, "Table structure for "+table)
+	createTableSQL, err := getCreateTableSQL(ctx, db, dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	// 只有 SHOW CREATE TABLE 没有表注释时才查询 information_schema 确认
+	var tableComment string
+	if !hasTableComment(createTableSQL) {
+		tableComment, err = getTableComment(ctx, db, dbName, table)
+		if err != nil {
+			return nil, err
+		}
+	}
+	createTableSQL = addMissingComments(createTableSQL, tableComment, columns)
+	createTableSQL = rewriteCreateTable(createTableSQL, o.isTemporaryTables, o.createTableIfNotExists())
+	if o.isResetAutoIncrement {
+		createTableSQL = removeAutoIncrement(createTableSQL)
+	}
+	if o.isNoPartitioning {
+		createTableSQL = removePartitioning(createTableSQL)
+	}
+	if o.isNoExpressionDefaults {
+		createTableSQL = removeExpressionDefaults(createTableSQL)
+	}
+	if o.engine != "" {
+		if !isValidCharsetName(o.engine) {
+			return nil, fmt.Errorf("invalid engine name %q", o.engine)
 		}
+		createTableSQL = setEngine(createTableSQL, o.engine)
+	}
+	var indexes []string
+	if o.isDeferIndexes && o.isData {
+		createTableSQL, indexes = splitSecondaryIndexes(createTableSQL)
 	}
+	createTableSQL = o.rewriteStatement(createTableSQL)
+	_, err = buf.WriteString(fmt.Sprintf("%s%s\n\n", createTableSQL, o.terminator))
+	return indexes, err
+}
+
+// writeDeferredIndexes 导入数据后用一条 ALTER TABLE 添加全部二级索引, 只重建一次表
+func writeDeferredIndexes(table string, indexes []string, buf *bufio.Writer, o *dumpOption) {
+	if len(indexes) == 0 {
+		return
+	}
+	writeComment(buf, o, "Indexes for "+table)
+	_, _ = buf.WriteString(fmt.Sprintf("ALTER TABLE %s\n  ADD %s%s\n\n", quoteIdentifier(table), strings.Join(indexes, ",\n  ADD "), o.terminator))
+}
 
+// writeAnalyzeTables WithAnalyzeAfterRestore 且导出数据时为每个表写一条 ANALYZE TABLE
+func writeAnalyzeTables(tables []string, buf *bufio.Writer, o *dumpOption) {
+	if !o.isAnalyzeAfterRestore || !o.isData || len(tables) == 0 {
+		return
+	}
+	writeComment(buf, o, "Analyze tables")
+	for _, table := range tables {
+		_, _ = buf.WriteString("ANALYZE TABLE " + quoteIdentifier(table) + o.terminator + "\n")
+	}
 	_, _ = buf.WriteString("\n")
-	return totalRow, nil
 }
 
-func writeDataInsertToBuffer(table string, columnNames string, dataValueString []string, buf *bufio.Writer) {
-	s := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s;\n", table, columnNames, strings.Join(dataValueString, ","))
-	s = strings.ReplaceAll(s, "\\'", "\\\\'")
-	// s = strings.ReplaceAll(s, "')", "`)")
-	// s = strings.ReplaceAll(s, "',", "`,")
-	// s = strings.ReplaceAll(s, ",'", ",`")
-	buf.WriteString(s)
+func writeViewStruct(ctx context.Context, db queryer, dbName, view string, buf *bufio.Writer, o *dumpOption) error {
+	writeComment(buf, o, "View structure for "+view)
+	createViewSQL, err := getCreateTableSQL(ctx, db, dbName, view)
+	if err != nil {
+		return err
+	}
+	createViewSQL = o.rewriteStatement(o.renameQualifiers(o.applyDefiner(createViewSQL), dbName))
+	_, err = buf.WriteString(fmt.Sprintf("%s%s\n\n", createViewSQL, o.terminator))
+	return err
+}
+
+// 禁止 golangci-lint 检查
+// nolint: gocyclo
+func writeTableData(ctx context.Context, db queryer, dbName, table string, columns []tableColumn, buf *bufio.Writer, o *dumpOption) (uint64, error) {
+	// 导出表数据; 行数在读取时统计, 不额外执行 SELECT COUNT(*)
+	comment := "Records of " + table
+	if o.isApproximateRowCount && !o.isNoComments {
+		estimate, err := getApproximateRowCount(ctx, db, dbName, table)
+		if err != nil {
+			return 0, err
+		}
+		if limit := o.rowLimitOf(table); limit > 0 {
+			estimate = min(estimate, uint64(limit))
+		}
+		comment += fmt.Sprintf(" (approximately %d rows)", estimate)
+	}
+	writeComment(buf, o, comment)
+
+	rows, err := queryTableRows(ctx, db, dbName, table, columns, o)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.close()
+
+	quotedColumns := make([]string, len(rows.columns))
+	for i, col := range rows.columns {
+		quotedColumns[i] = o.identifierQuote.quote(col)
+	}
+
+	columnNames := strings.Join(quotedColumns, ",")
+	// 跳过了生成列或有不可见列时必须写列名, 否则值的个数与表的 (可见) 列数不一致
+	if o.isSkipCompleteInsert && !rows.explicitColumns {
+		columnNames = ""
+	}
+	strategy := o.insertStrategy
+	var update string
+	if o.isUpsert {
+		strategy = InsertStrategyInsert
+		primaryKeys, err := getPrimaryKeyColumns(ctx, db, dbName, table)
+		if err != nil {
+			return 0, err
+		}
+		update = buildUpsertClause(rows.columns, primaryKeys)
+	}
+	stmt := newQuotedInsertStatement(strategy, o.identifierQuote.quote(table), columnNames, update)
+	stmt.terminator = o.terminator
+
+	kinds := make([]valueKind, len(rows.types))
+	for i, columnType := range rows.types {
+		kinds[i] = columnKind(columnType.DatabaseTypeName(), o.isTypedValues)
+		switch {
+		case rows.boolean[i]:
+			kinds[i] = valueKindBoolean
+		case rows.spatial[i]:
+			kinds[i] = valueKindSpatial
+		}
+	}
+
+	w := newInsertWriter(stmt, buf, o.insertBatchSize, o.maxAllowedPacket)
+	// tuple 在各行之间复用, 避免每行分配内存
+	var tuple []byte
+	for rows.next() {
+		tuple = append(tuple[:0], '(')
+		for i := range rows.columns {
+			if i > 0 {
+				tuple = append(tuple, ',')
+			}
+			// WithCharsetIntroducers 时字符集不同的列
+			if rows.introducers != nil && rows.introducers[i] != "" {
+				tuple = appendIntroduced(tuple, rows.value(i), rows.introducers[i])
+				continue
+			}
+			tuple = appendValue(tuple, rows.value(i), kinds[i])
+		}
+		tuple = append(tuple, ')')
+		// 写入失败时立即停止读取, 不再导出剩余的行
+		if err := w.writeRow(tuple); err != nil {
+			return rows.count, err
+		}
+	}
+	if err := w.flush(); err != nil {
+		return rows.count, err
+	}
+	if err := rows.done(); err != nil {
+		return rows.count, err
+	}
+
+	_, err = buf.WriteString("\n")
+	return rows.count, err
+}
+
+// getApproximateRowCount 返回 information_schema 中估计的行数, 没有统计信息时为 0
+func getApproximateRowCount(ctx context.Context, db queryer, dbName, table string) (uint64, error) {
+	var rows sql.NullInt64
+	err := db.QueryRowContext(ctx, "SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", dbName, table).Scan(&rows)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(max(rows.Int64, 0)), nil
+}
+
+// getTableSizes 返回库中每个表的 DATA_LENGTH+INDEX_LENGTH, 不包含视图
+func getTableSizes(ctx context.Context, db queryer, dbName string) (map[string]int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_NAME, DATA_LENGTH + INDEX_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'", dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var size sql.NullInt64
+		err = rows.Scan(&table, &size)
+		if err != nil {
+			return nil, err
+		}
+		if size.Valid {
+			sizes[table] = size.Int64
+		}
+	}
+	return sizes, rows.Err()
+}
+
+// filterTablesBySize 返回大小在 [minBytes, maxBytes] 内的表, 0 表示不限制; 不知道大小的表 (如视图) 保留
+func filterTablesBySize(tables []string, sizes map[string]int64, minBytes, maxBytes int64) []string {
+	var filtered []string
+	for _, table := range tables {
+		size, ok := sizes[table]
+		if ok && (minBytes > 0 && size < minBytes || maxBytes > 0 && size > maxBytes) {
+			continue
+		}
+		filtered = append(filtered, table)
+	}
+	return filtered
+}
+
+// getPrimaryKeyColumns 返回表的主键列, 按主键中的顺序
+func getPrimaryKeyColumns(ctx context.Context, db queryer, dbName, table string) ([]string, error) {
+	var columns []string
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY' ORDER BY ORDINAL_POSITION", dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// buildUpsertClause 生成 ON DUPLICATE KEY UPDATE 之后的赋值列表, 跳过主键列;
+// 全部列都是主键时使用 pk=pk 保证语句合法
+func buildUpsertClause(columns []string, primaryKeys []string) string {
+	var assignments []string
+	for _, col := range columns {
+		if slices.Contains(primaryKeys, col) {
+			continue
+		}
+		assignments = append(assignments, fmt.Sprintf("%s=VALUES(%s)", quoteIdentifier(col), quoteIdentifier(col)))
+	}
+	if len(assignments) == 0 && len(columns) > 0 {
+		assignments = append(assignments, quoteIdentifier(columns[0])+"="+quoteIdentifier(columns[0]))
+	}
+	return strings.Join(assignments, ",")
 }
@@ -0,0 +1,893 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_excludeTables(t *testing.T) {
+	type args struct {
+		tables   []string
+		patterns []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "no patterns",
+			args: args{tables: []string{"a", "b"}},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "exact and glob",
+			args: args{
+				tables:   []string{"users", "sessions", "tmp_1", "tmp_2", "orders"},
+				patterns: []string{"sessions", "tmp_*"},
+			},
+			want: []string{"users", "orders"},
+		},
+		{
+			name:    "bad pattern",
+			args:    args{tables: []string{"a"}, patterns: []string{"[a"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := excludeTables(tt.args.tables, tt.args.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("excludeTables() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("excludeTables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_removeAutoIncrement(t *testing.T) {
+	type args struct {
+		createTableSQL string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "table options",
+			args: args{createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB AUTO_INCREMENT=42 DEFAULT CHARSET=utf8mb4"},
+			want: "CREATE TABLE `t` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		},
+		{
+			name: "partitioned",
+			args: args{createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL AUTO_INCREMENT\n) ENGINE=InnoDB AUTO_INCREMENT=7\n/*!50100 PARTITION BY HASH (`id`)\nPARTITIONS 2 */"},
+			want: "CREATE TABLE `t` (\n  `id` int NOT NULL AUTO_INCREMENT\n) ENGINE=InnoDB\n/*!50100 PARTITION BY HASH (`id`)\nPARTITIONS 2 */",
+		},
+		{
+			name: "column comment untouched",
+			args: args{createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL COMMENT 'was AUTO_INCREMENT=1'\n) ENGINE=InnoDB"},
+			want: "CREATE TABLE `t` (\n  `id` int NOT NULL COMMENT 'was AUTO_INCREMENT=1'\n) ENGINE=InnoDB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeAutoIncrement(tt.args.createTableSQL); got != tt.want {
+				t.Errorf("removeAutoIncrement() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildUpsertClause(t *testing.T) {
+	type args struct {
+		columns     []string
+		primaryKeys []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "skip primary key",
+			args: args{columns: []string{"id", "a", "b"}, primaryKeys: []string{"id"}},
+			want: "`a`=VALUES(`a`),`b`=VALUES(`b`)",
+		},
+		{
+			name: "composite primary key",
+			args: args{columns: []string{"x", "y", "v"}, primaryKeys: []string{"x", "y"}},
+			want: "`v`=VALUES(`v`)",
+		},
+		{
+			name: "only primary key",
+			args: args{columns: []string{"id"}, primaryKeys: []string{"id"}},
+			want: "`id`=`id`",
+		},
+		{
+			name: "no primary key",
+			args: args{columns: []string{"a"}},
+			want: "`a`=VALUES(`a`)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildUpsertClause(tt.args.columns, tt.args.primaryKeys); got != tt.want {
+				t.Errorf("buildUpsertClause() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitSecondaryIndexes(t *testing.T) {
+	tests := []struct {
+		name        string
+		createSQL   string
+		wantSQL     string
+		wantIndexes []string
+	}{
+		{
+			name: "secondary indexes moved",
+			createSQL: "CREATE TABLE IF NOT EXISTS `t` (\n" +
+				"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+				"  `email` varchar(255) NOT NULL,\n" +
+				"  `user_id` int DEFAULT NULL,\n" +
+				"  `body` text,\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  UNIQUE KEY `uk_email` (`email`),\n" +
+				"  KEY `idx_user` (`user_id`),\n" +
+				"  FULLTEXT KEY `ft_body` (`body`),\n" +
+				"  CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)\n" +
+				") ENGINE=InnoDB AUTO_INCREMENT=10 DEFAULT CHARSET=utf8mb4",
+			wantSQL: "CREATE TABLE IF NOT EXISTS `t` (\n" +
+				"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+				"  `email` varchar(255) NOT NULL,\n" +
+				"  `user_id` int DEFAULT NULL,\n" +
+				"  `body` text,\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)\n" +
+				") ENGINE=InnoDB AUTO_INCREMENT=10 DEFAULT CHARSET=utf8mb4",
+			wantIndexes: []string{"UNIQUE KEY `uk_email` (`email`)", "KEY `idx_user` (`user_id`)", "FULLTEXT KEY `ft_body` (`body`)"},
+		},
+		{
+			name: "last definition is an index",
+			createSQL: "CREATE TABLE `t` (\n" +
+				"  `id` int NOT NULL,\n" +
+				"  `a` int,\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  KEY `idx_a` (`a`)\n" +
+				") ENGINE=InnoDB",
+			wantSQL: "CREATE TABLE `t` (\n" +
+				"  `id` int NOT NULL,\n" +
+				"  `a` int,\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				") ENGINE=InnoDB",
+			wantIndexes: []string{"KEY `idx_a` (`a`)"},
+		},
+		{
+			name: "auto increment index kept",
+			createSQL: "CREATE TABLE `t` (\n" +
+				"  `seq` int NOT NULL AUTO_INCREMENT,\n" +
+				"  `seq2` int,\n" +
+				"  KEY `idx_seq` (`seq`),\n" +
+				"  KEY `idx_seq2` (`seq2`)\n" +
+				") ENGINE=InnoDB",
+			wantSQL: "CREATE TABLE `t` (\n" +
+				"  `seq` int NOT NULL AUTO_INCREMENT,\n" +
+				"  `seq2` int,\n" +
+				"  KEY `idx_seq` (`seq`)\n" +
+				") ENGINE=InnoDB",
+			wantIndexes: []string{"KEY `idx_seq2` (`seq2`)"},
+		},
+		{
+			name:      "no secondary indexes",
+			createSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+			wantSQL:   "CREATE TABLE `t` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSQL, gotIndexes := splitSecondaryIndexes(tt.createSQL)
+			if gotSQL != tt.wantSQL {
+				t.Errorf("splitSecondaryIndexes() sql = %q, want %q", gotSQL, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(gotIndexes, tt.wantIndexes) {
+				t.Errorf("splitSecondaryIndexes() indexes = %q, want %q", gotIndexes, tt.wantIndexes)
+			}
+		})
+	}
+}
+
+func Test_selectTables(t *testing.T) {
+	allTables := []string{"users", "log_2023", "log_2024", "log_archive", "orders"}
+	tests := []struct {
+		name        string
+		names       []string
+		patterns    []string
+		expressions []*regexp.Regexp
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:     "glob",
+			patterns: []string{"log_*"},
+			want:     []string{"log_2023", "log_2024", "log_archive"},
+		},
+		{
+			name:        "regexp",
+			expressions: []*regexp.Regexp{regexp.MustCompile(`^log_\d{4}$`)},
+			want:        []string{"log_2023", "log_2024"},
+		},
+		{
+			name:     "combined with names keeps table order",
+			names:    []string{"orders", "users"},
+			patterns: []string{"log_2024"},
+			want:     []string{"users", "log_2024", "orders"},
+		},
+		{
+			name:     "no match",
+			patterns: []string{"tmp_*"},
+			wantErr:  true,
+		},
+		{
+			name:     "bad pattern",
+			patterns: []string{"[a"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectTables(allTables, tt.names, tt.patterns, tt.expressions)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("selectTables() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectTables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_quoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "users", want: "`users`"},
+		{name: "na`me", want: "`na``me`"},
+		{name: "``", want: "``````"},
+		{name: "we`ird; DROP TABLE x", want: "`we``ird; DROP TABLE x`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quoteIdentifier(tt.name); got != tt.want {
+				t.Errorf("quoteIdentifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got, want := qualifiedName("d`b", "t`1"), "`d``b`.`t``1`"; got != want {
+		t.Errorf("qualifiedName() = %v, want %v", got, want)
+	}
+	if got, want := buildUpsertClause([]string{"id", "v`al"}, []string{"id"}), "`v``al`=VALUES(`v``al`)"; got != want {
+		t.Errorf("buildUpsertClause() = %v, want %v", got, want)
+	}
+	if got, want := leadingIdentifier("`a``b` int NOT NULL AUTO_INCREMENT"), "`a``b`"; got != want {
+		t.Errorf("leadingIdentifier() = %v, want %v", got, want)
+	}
+}
+
+func Test_missingTables(t *testing.T) {
+	allTables := []string{"users", "orders", "v_orders"}
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{name: "all exist", names: []string{"orders", "users"}, want: nil},
+		{name: "typo", names: []string{"users", "typo_name", "order"}, want: []string{"typo_name", "order"}},
+		{name: "case sensitive", names: []string{"Users"}, want: []string{"Users"}},
+		{name: "no names", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingTables(allTables, tt.names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingTables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_removePartitioning(t *testing.T) {
+	rangePartitioned := "CREATE TABLE `orders` (\n  `id` int NOT NULL,\n  `created` date NOT NULL,\n  PRIMARY KEY (`id`,`created`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	rangeClause := "\n/*!50100 PARTITION BY RANGE (year(`created`))\n(PARTITION p2023 VALUES LESS THAN (2024) ENGINE = InnoDB,\n PARTITION pmax VALUES LESS THAN MAXVALUE ENGINE = InnoDB) */"
+	tests := []struct {
+		name           string
+		createTableSQL string
+		noPartitioning bool
+		want           string
+	}{
+		{
+			name:           "range partitioned kept by default",
+			createTableSQL: rangePartitioned + rangeClause,
+			want:           rangePartitioned + rangeClause,
+		},
+		{
+			name:           "range partitioned stripped",
+			createTableSQL: rangePartitioned + rangeClause,
+			noPartitioning: true,
+			want:           rangePartitioned,
+		},
+		{
+			name:           "range columns",
+			createTableSQL: rangePartitioned + "\n/*!50500 PARTITION BY RANGE  COLUMNS(`created`)\n(PARTITION p0 VALUES LESS THAN ('2024-01-01') ENGINE = InnoDB) */",
+			noPartitioning: true,
+			want:           rangePartitioned,
+		},
+		{
+			name:           "mariadb without conditional comment",
+			createTableSQL: rangePartitioned + "\n PARTITION BY RANGE (year(`created`))\n(PARTITION `p0` VALUES LESS THAN (2024) ENGINE = InnoDB)",
+			noPartitioning: true,
+			want:           rangePartitioned,
+		},
+		{
+			name:           "mariadb partition at line start",
+			createTableSQL: rangePartitioned + "\nPARTITION BY HASH (`id`)\nPARTITIONS 4",
+			noPartitioning: true,
+			want:           rangePartitioned,
+		},
+		{
+			name:           "column comment untouched",
+			createTableSQL: "CREATE TABLE `t` (\n  `id` int COMMENT 'x\nPARTITION BY y'\n) ENGINE=InnoDB",
+			noPartitioning: true,
+			want:           "CREATE TABLE `t` (\n  `id` int COMMENT 'x\nPARTITION BY y'\n) ENGINE=InnoDB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.createTableSQL
+			if tt.noPartitioning {
+				got = removePartitioning(got)
+			}
+			if got != tt.want {
+				t.Errorf("removePartitioning() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setEngine(t *testing.T) {
+	tests := []struct {
+		name           string
+		createTableSQL string
+		want           string
+	}{
+		{
+			name:           "myisam",
+			createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=MyISAM DEFAULT CHARSET=utf8mb4",
+			want:           "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		},
+		{
+			name:           "already innodb",
+			createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=InnoDB",
+			want:           "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=InnoDB",
+		},
+		{
+			name:           "no engine clause",
+			createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL\n) DEFAULT CHARSET=latin1",
+			want:           "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=latin1",
+		},
+		{
+			name:           "partitions",
+			createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=MyISAM\n/*!50100 PARTITION BY RANGE (`id`)\n(PARTITION p0 VALUES LESS THAN (10) ENGINE = MyISAM,\n PARTITION p1 VALUES LESS THAN MAXVALUE ENGINE = MyISAM) */",
+			want:           "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=InnoDB\n/*!50100 PARTITION BY RANGE (`id`)\n(PARTITION p0 VALUES LESS THAN (10) ENGINE = InnoDB,\n PARTITION p1 VALUES LESS THAN MAXVALUE ENGINE = InnoDB) */",
+		},
+		{
+			name:           "column named engine untouched",
+			createTableSQL: "CREATE TABLE `t` (\n  `engine` varchar(10) DEFAULT 'ENGINE=MyISAM'\n) ENGINE=Aria",
+			want:           "CREATE TABLE `t` (\n  `engine` varchar(10) DEFAULT 'ENGINE=MyISAM'\n) ENGINE=InnoDB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setEngine(tt.createTableSQL, "InnoDB"); got != tt.want {
+				t.Errorf("setEngine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_DumpReader(t *testing.T) {
+	emptyDatabase := func(query string) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SHOW TABLES") {
+			return []string{"Tables_in_test"}, nil
+		}
+		return []string{"@@character_set_results"}, [][]driver.Value{{"utf8mb4"}}
+	}
+
+	t.Run("streams the dump", func(t *testing.T) {
+		db := sql.OpenDB(&fakeConnector{rows: emptyDatabase})
+		defer db.Close()
+		r, err := DumpReader(db, "test", WithNoComments())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(got), "SET NAMES utf8mb4;\n") {
+			t.Errorf("dump = %q", got)
+		}
+	})
+
+	t.Run("error from read", func(t *testing.T) {
+		db := sql.OpenDB(&fakeConnector{})
+		defer db.Close()
+		r, err := DumpReader(db, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if _, err := io.ReadAll(r); err == nil || !strings.Contains(err.Error(), "no rows for SHOW TABLES") {
+			t.Errorf("ReadAll() error = %v, want the dump error", err)
+		}
+	})
+
+	t.Run("close without reading", func(t *testing.T) {
+		db := sql.OpenDB(&fakeConnector{rows: emptyDatabase})
+		defer db.Close()
+		r, err := DumpReader(db, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 返回说明导出 goroutine 已结束
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+			t.Errorf("Read() after Close error = %v, want io.ErrClosedPipe", err)
+		}
+	})
+
+	t.Run("file per table not supported", func(t *testing.T) {
+		if _, err := DumpReader(nil, "test", WithFilePerTable(t.TempDir())); err == nil {
+			t.Error("want error")
+		}
+	})
+}
+
+func Test_DumpConn(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []DumpOption
+	}{
+		{name: "default", opts: []DumpOption{WithParallelism(4)}},
+		{name: "lock all tables", opts: []DumpOption{WithLockAllTables()}},
+		{name: "binlog position", opts: []DumpOption{WithBinlogPosition()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := &dumpFixture{tables: []string{"t1", "t2"}, query: func(query string) ([]string, [][]driver.Value, bool) {
+				if strings.HasPrefix(query, "SHOW MASTER STATUS") {
+					return []string{"File", "Position"}, [][]driver.Value{{"binlog.000001", "4"}}, true
+				}
+				return nil, nil, false
+			}}
+			connector := fixture.connector()
+			db := sql.OpenDB(connector)
+			defer db.Close()
+			ctx := context.Background()
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			var b strings.Builder
+			err = DumpConn(ctx, conn, "test", append(tt.opts, WithData(), WithWriter(&b))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(b.String(), "INSERT INTO `t2`") {
+				t.Errorf("dump does not contain t2 data:\n%s", b.String())
+			}
+			if connector.connects != 1 {
+				t.Errorf("opened %d connections, want 1", connector.connects)
+			}
+			// 连接由调用方关闭
+			if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil {
+				t.Errorf("conn is not usable after DumpConn: %v", err)
+			}
+		})
+	}
+}
+
+func Test_validateIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "plain", input: "orders"},
+		{name: "unicode", input: "订单"},
+		{name: "backtick injection is quoted", input: "t`; DROP TABLE users; --"},
+		{name: "quote and semicolon", input: "a'; DELETE FROM b"},
+		{name: "empty", input: "", wantErr: true},
+		{name: "nul byte", input: "t\x00`; DROP TABLE users", wantErr: true},
+		{name: "invalid utf-8", input: "t\xff", wantErr: true},
+		{name: "supplementary character", input: "t😀", wantErr: true},
+		{name: "trailing space", input: "t ", wantErr: true},
+		{name: "too long", input: strings.Repeat("a", 65), wantErr: true},
+		{name: "64 characters", input: strings.Repeat("表", 64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateIdentifier("table", tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("validateIdentifier(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_injectionNames(t *testing.T) {
+	name := "t`; DROP TABLE users; --"
+	if got, want := qualifiedName("db`x", name), "`db``x`.`t``; DROP TABLE users; --`"; got != want {
+		t.Errorf("qualifiedName() = %s, want %s", got, want)
+	}
+
+	var queries []string
+	db := sql.OpenDB(&fakeConnector{rows: func(query string) ([]string, [][]driver.Value) {
+		queries = append(queries, query)
+		return []string{"Tables_in_test"}, nil
+	}})
+	defer db.Close()
+	for _, opts := range [][]DumpOption{
+		{WithTables("t\x00`; DROP TABLE users")},
+		{WithRenameDatabase("new ")},
+		{WithViews("")},
+	} {
+		if err := Dump(db, "test", append(opts, WithWriter(io.Discard))...); err == nil {
+			t.Error("Dump() with an invalid name succeeded")
+		}
+	}
+	if err := Dump(db, "te\x00st", WithWriter(io.Discard)); err == nil {
+		t.Error("Dump() with an invalid database name succeeded")
+	}
+	if err := DumpTable(db, "t\xff", io.Discard); err == nil {
+		t.Error("DumpTable() with an invalid table name succeeded")
+	}
+	if len(queries) != 0 {
+		t.Errorf("invalid names reached the server: %q", queries)
+	}
+}
+
+func Test_DumpTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		database driver.Value
+		wantErr  string
+	}{
+		{name: "current database", database: "test"},
+		{name: "no database selected", database: nil, wantErr: "DumpTable: no database selected on the connection"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := &dumpFixture{
+				query: func(query string) ([]string, [][]driver.Value, bool) {
+					if query != "SELECT DATABASE()" {
+						return nil, nil, false
+					}
+					return []string{"DATABASE()"}, [][]driver.Value{{tt.database}}, true
+				},
+			}
+			db := sql.OpenDB(fixture.connector())
+			defer db.Close()
+
+			var b strings.Builder
+			err := DumpTable(db, "t", &b, WithData())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("DumpTable() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(b.String(), "INSERT INTO `t`") {
+				t.Errorf("DumpTable() output has no INSERT:\n%s", b.String())
+			}
+		})
+	}
+}
+
+func Test_rewriteCreateTable(t *testing.T) {
+	create := "CREATE TABLE `t` (\n  `note` varchar(20) DEFAULT 'CREATE TABLE'\n) ENGINE=InnoDB"
+	tests := []struct {
+		name        string
+		temporary   bool
+		ifNotExists bool
+		want        string
+	}{
+		{name: "unchanged", want: create},
+		{name: "if not exists", ifNotExists: true, want: "CREATE TABLE IF NOT EXISTS `t` (\n  `note` varchar(20) DEFAULT 'CREATE TABLE'\n) ENGINE=InnoDB"},
+		{name: "temporary", temporary: true, want: "CREATE TEMPORARY TABLE `t` (\n  `note` varchar(20) DEFAULT 'CREATE TABLE'\n) ENGINE=InnoDB"},
+		{name: "temporary if not exists", temporary: true, ifNotExists: true, want: "CREATE TEMPORARY TABLE IF NOT EXISTS `t` (\n  `note` varchar(20) DEFAULT 'CREATE TABLE'\n) ENGINE=InnoDB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteCreateTable(create, tt.temporary, tt.ifNotExists); got != tt.want {
+				t.Errorf("rewriteCreateTable() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeTemporaryTable(t *testing.T) {
+	db := sql.OpenDB((&dumpFixture{}).connector())
+	defer db.Close()
+
+	o := newDumpOption([]DumpOption{WithNoComments(), WithNoData(), WithDropTable(), WithTemporaryTables()})
+	var sb strings.Builder
+	buf := bufio.NewWriter(&sb)
+	if _, err := writeTable(context.Background(), db, "test", "t", buf, &o); err != nil {
+		t.Fatal(err)
+	}
+	_ = buf.Flush()
+	want := "DROP TEMPORARY TABLE IF EXISTS `t`;\nCREATE TEMPORARY TABLE `t` (\n  `id` int\n) ENGINE=InnoDB;\n\n"
+	if got := sb.String(); got != want {
+		t.Errorf("writeTable() = %q, want %q", got, want)
+	}
+}
+
+func Test_filterTablesBySize(t *testing.T) {
+	tables := []string{"small", "medium", "big", "v"}
+	// 视图没有大小
+	sizes := map[string]int64{"small": 16 << 10, "medium": 10 << 20, "big": 50 << 30}
+	tests := []struct {
+		name     string
+		minBytes int64
+		maxBytes int64
+		want     []string
+	}{
+		{name: "no limit", want: []string{"small", "medium", "big", "v"}},
+		{name: "max", maxBytes: 1 << 30, want: []string{"small", "medium", "v"}},
+		{name: "min", minBytes: 1 << 20, want: []string{"medium", "big", "v"}},
+		{name: "range", minBytes: 1 << 20, maxBytes: 1 << 30, want: []string{"medium", "v"}},
+		{name: "bounds inclusive", minBytes: 16 << 10, maxBytes: 10 << 20, want: []string{"small", "medium", "v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterTablesBySize(tables, sizes, tt.minBytes, tt.maxBytes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterTablesBySize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_maxTableBytes(t *testing.T) {
+	var created []string
+	fixture := &dumpFixture{tables: []string{"countries", "events", "users"}, query: func(query string) ([]string, [][]driver.Value, bool) {
+		switch {
+		case strings.HasPrefix(query, "SELECT TABLE_NAME, DATA_LENGTH + INDEX_LENGTH"):
+			return []string{"TABLE_NAME", "SIZE"}, [][]driver.Value{{"countries", int64(32 << 10)}, {"events", int64(200 << 30)}, {"users", int64(64 << 20)}}, true
+		case strings.HasPrefix(query, "SHOW CREATE TABLE"):
+			created = append(created, query)
+		}
+		return nil, nil, false
+	}}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	result, err := DumpWithResult(db, "test", WithMaxTableBytes(1<<30), WithWriter(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"SHOW CREATE TABLE `test`.`countries`", "SHOW CREATE TABLE `test`.`users`"}
+	if !reflect.DeepEqual(created, want) {
+		t.Errorf("dumped %q, want %q", created, want)
+	}
+	if len(result.Tables) != 2 {
+		t.Errorf("result has %d tables, want 2", len(result.Tables))
+	}
+}
+
+func Test_DumpDatabases(t *testing.T) {
+	fixture := &dumpFixture{
+		tables:      []string{"users"},
+		createTable: "CREATE TABLE `users` (\n  `name` varchar(10)\n) ENGINE=InnoDB",
+		columns:     [][]driver.Value{{"name", "", "varchar(10)", "", "utf8mb4"}},
+		data: func(query string) ([]string, [][]driver.Value) {
+			if strings.HasSuffix(query, "FROM `billing`.`users`") {
+				return []string{"name"}, [][]driver.Value{{"billing user"}}
+			}
+			return []string{"name"}, [][]driver.Value{{"app user"}}
+		},
+	}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var b strings.Builder
+	err := DumpDatabases(db, []string{"app", "billing"}, WithData(), WithWriter(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	want := []string{
+		"-- Database Name: app\n",
+		"CREATE DATABASE IF NOT EXISTS `app` CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci;\n\nUSE `app`;\n",
+		"INSERT INTO `users` (`name`) VALUES ('app user');\n",
+		"-- Database Name: billing\n",
+		"CREATE DATABASE IF NOT EXISTS `billing` CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci;\n\nUSE `billing`;\n",
+		"INSERT INTO `users` (`name`) VALUES ('billing user');\n",
+	}
+	pos := 0
+	for _, w := range want {
+		i := strings.Index(got[pos:], w)
+		if i < 0 {
+			t.Fatalf("%q not found after offset %d:\n%s", w, pos, got)
+		}
+		pos += i + len(w)
+	}
+
+	if err := DumpDatabases(db, []string{"app"}, WithRenameDatabase("copy")); err == nil {
+		t.Error("DumpDatabases() with WithRenameDatabase error = nil, want error")
+	}
+}
+
+func Test_analyzeAfterRestore(t *testing.T) {
+	db := sql.OpenDB(tableDumpConnector(testRows(3), nil))
+	defer db.Close()
+	tests := []struct {
+		name string
+		opts []DumpOption
+		want bool
+	}{
+		{name: "with data", opts: []DumpOption{WithData(), WithAnalyzeAfterRestore()}, want: true},
+		{name: "transaction", opts: []DumpOption{WithData(), WithTransaction(), WithAnalyzeAfterRestore()}, want: true},
+		{name: "no data", opts: []DumpOption{WithNoData(), WithAnalyzeAfterRestore()}},
+		{name: "not enabled", opts: []DumpOption{WithData()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := Dump(db, "test", append(tt.opts, WithWriter(&b))...); err != nil {
+				t.Fatal(err)
+			}
+			got := b.String()
+			if !tt.want {
+				if strings.Contains(got, "ANALYZE TABLE") {
+					t.Errorf("unexpected ANALYZE TABLE:\n%s", got)
+				}
+				return
+			}
+			// 全部表的数据之后, 事务之外: 在提交数据的 COMMIT 和重新开始的 START TRANSACTION 之间
+			after := strings.LastIndex(got, "INSERT INTO")
+			if commit := strings.Index(got[after:], "COMMIT;"); commit >= 0 {
+				after += commit
+			}
+			before := len(got)
+			if start := strings.Index(got[after:], "START TRANSACTION"); start >= 0 {
+				before = after + start
+			}
+			for _, table := range []string{"t1", "t2", "t3"} {
+				i := strings.Index(got, "ANALYZE TABLE `"+table+"`;\n")
+				if i < after || i > before {
+					t.Errorf("ANALYZE TABLE `%s` at %d, want between %d and %d:\n%s", table, i, after, before, got)
+				}
+			}
+		})
+	}
+}
+
+// expressionDefaultsTable MySQL 8 带表达式默认值的表
+const expressionDefaultsTable = "CREATE TABLE `events` (\n" +
+	"  `id` binary(16) NOT NULL DEFAULT (uuid_to_bin(uuid())),\n" +
+	"  `created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+	"  `expires` datetime DEFAULT ((now() + interval 1 day)),\n" +
+	"  `tags` json DEFAULT (json_array()),\n" +
+	"  `label` varchar(20) DEFAULT (concat(_utf8mb4'a)',_utf8mb4'b')) COMMENT 'DEFAULT (x)',\n" +
+	"  `name` varchar(20) DEFAULT ' DEFAULT (y)',\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+func Test_removeExpressionDefaults(t *testing.T) {
+	tests := []struct {
+		name           string
+		createTableSQL string
+		want           string
+	}{
+		{
+			name:           "expression defaults",
+			createTableSQL: expressionDefaultsTable,
+			want: "CREATE TABLE `events` (\n" +
+				"  `id` binary(16) NOT NULL,\n" +
+				"  `created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+				"  `expires` datetime,\n" +
+				"  `tags` json,\n" +
+				"  `label` varchar(20) COMMENT 'DEFAULT (x)',\n" +
+				"  `name` varchar(20) DEFAULT ' DEFAULT (y)',\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		},
+		{
+			name:           "no expression defaults",
+			createTableSQL: "CREATE TABLE `t` (\n  `id` int NOT NULL DEFAULT '0'\n) ENGINE=InnoDB",
+			want:           "CREATE TABLE `t` (\n  `id` int NOT NULL DEFAULT '0'\n) ENGINE=InnoDB",
+		},
+		{
+			name:           "unbalanced parentheses kept",
+			createTableSQL: "CREATE TABLE `t` (\n  `id` int DEFAULT (1\n) ENGINE=InnoDB",
+			want:           "CREATE TABLE `t` (\n  `id` int DEFAULT (1\n) ENGINE=InnoDB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeExpressionDefaults(tt.createTableSQL); got != tt.want {
+				t.Errorf("removeExpressionDefaults() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_expressionDefaults SHOW CREATE TABLE 中的表达式默认值原样写入 dump, DEFAULT_GENERATED 的列不当作生成列
+func Test_expressionDefaults(t *testing.T) {
+	fixture := &dumpFixture{
+		tables:      []string{"events"},
+		createTable: expressionDefaultsTable,
+		columns: [][]driver.Value{
+			{"id", "DEFAULT_GENERATED", "binary(16)", "", nil},
+			{"created", "DEFAULT_GENERATED", "datetime", "", nil},
+			{"expires", "DEFAULT_GENERATED", "datetime", "", nil},
+			{"tags", "DEFAULT_GENERATED", "json", "", nil},
+			{"label", "DEFAULT_GENERATED", "varchar(20)", "DEFAULT (x)", "utf8mb4"},
+			{"name", "", "varchar(20)", "", "utf8mb4"},
+		},
+		data: func(string) ([]string, [][]driver.Value) {
+			return []string{"id", "created", "expires", "tags", "label", "name"}, [][]driver.Value{{"0123456789abcdef", "2024-01-01 00:00:00", nil, "[]", "a)b", "n"}}
+		},
+	}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	tests := []struct {
+		name string
+		opts []DumpOption
+		want string
+	}{
+		{name: "preserved", want: expressionDefaultsTable},
+		{name: "preserved with rewrites", opts: []DumpOption{WithResetAutoIncrement(), WithoutPartitioning(), WithDeferIndexes()}, want: expressionDefaultsTable},
+		{name: "downgraded", opts: []DumpOption{WithoutExpressionDefaults()}, want: removeExpressionDefaults(expressionDefaultsTable)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := Dump(db, "test", append([]DumpOption{WithData(), WithWriter(&b)}, tt.opts...)...); err != nil {
+				t.Fatal(err)
+			}
+			got := b.String()
+			// 默认写为 CREATE TABLE IF NOT EXISTS, 只比较列定义和表选项
+			if !strings.Contains(got, strings.TrimPrefix(tt.want, "CREATE TABLE")+";\n") {
+				t.Errorf("dump does not contain %q:\n%s", tt.want, got)
+			}
+			if !strings.Contains(got, "'a)b','n');") {
+				t.Errorf("dump does not contain the row:\n%s", got)
+			}
+		})
+	}
+}
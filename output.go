@@ -0,0 +1,172 @@
+package mysqldump
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// schemaFileName WithFilePerTable 时写入视图, 存储过程和事件的文件
+const schemaFileName = "_schema"
+
+// dumpOutput 一个输出目标, 依次经过缓冲, 字节统计, 换行转换, 可选的 gzip 压缩和 WithChecksum 的校验和计算后写入 writer
+type dumpOutput struct {
+	buf *bufio.Writer
+	// 使用 WithBufferedWriter 的缓冲区时为 nil, 不统计字节数
+	counter *countingWriter
+	// 压缩流, 不压缩时为 nil
+	gz io.WriteCloser
+	// 由 dumpOutput 打开的文件, 关闭时一起关闭
+	file *os.File
+	// WithChecksum 时计算最终字节的校验和, 关闭时加入 manifest
+	checksum *checksumWriter
+	manifest *checksumManifest
+	name     string
+	closed   bool
+}
+
+func newDumpOutput(w io.Writer, o *dumpOption) (*dumpOutput, error) {
+	if b, ok := w.(*bufio.Writer); ok && b == o.bufferedWriter && o.manifest == nil && !o.isGzip && o.lineEnding == "\n" {
+		return &dumpOutput{name: "-", buf: b}, nil
+	}
+	out := &dumpOutput{name: "-"}
+	if o.manifest != nil && w != io.Discard {
+		out.checksum = &checksumWriter{w: w, h: sha256.New()}
+		out.manifest = o.manifest
+		w = out.checksum
+	}
+	if o.isGzip {
+		compressor := o.compressor
+		if compressor == nil {
+			compressor = gzipCompressor(o.gzipLevel)
+		}
+		gz, err := compressor(w)
+		if err != nil {
+			return nil, err
+		}
+		out.gz = gz
+		w = gz
+	}
+	if o.lineEnding != "\n" {
+		w = &lineEndingWriter{w: w, ending: []byte(o.lineEnding)}
+	}
+	out.counter = &countingWriter{w: w}
+	out.buf = bufio.NewWriter(out.counter)
+	return out, nil
+}
+
+// createDumpOutput 在 dir 中创建 name.sql (gzip 时为 name.sql.gz), 其它格式使用对应的扩展名
+func createDumpOutput(dir, name string, o *dumpOption) (*dumpOutput, error) {
+	fileName := url.PathEscape(name) + o.format.extension()
+	if o.isGzip {
+		fileName += o.compressionExtension()
+	}
+	f, err := os.Create(filepath.Join(dir, fileName))
+	if err != nil {
+		return nil, err
+	}
+	out, err := newDumpOutput(f, o)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	out.file = f
+	out.name = fileName
+	return out, nil
+}
+
+// compressionExtension 返回压缩文件的扩展名, 默认为 .gz
+func (o *dumpOption) compressionExtension() string {
+	if o.compressor != nil {
+		return o.compressExtension
+	}
+	return ".gz"
+}
+
+// written 返回已写入的 SQL 字节数 (压缩前), 包含尚在缓冲区中的数据
+func (out *dumpOutput) written() int64 {
+	if out.counter == nil {
+		return 0
+	}
+	return out.counter.n + int64(out.buf.Buffered())
+}
+
+// flush 把缓冲区和压缩流中的数据写入 writer, 压缩流不支持 Flush 时 (如 WithParallelGzip) 数据留在压缩流中
+func (out *dumpOutput) flush() error {
+	err := out.buf.Flush()
+	if err != nil {
+		return err
+	}
+	if f, ok := out.gz.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// bufferError 返回 buf 记录的第一个写入错误; bufio.Writer 写入底层 writer 失败后, 之后的每次写入都返回同一个错误,
+// 所以只需在语句和表之间检查, 不必检查每次 WriteString
+func bufferError(buf *bufio.Writer) error {
+	_, err := buf.Write(nil)
+	return err
+}
+
+// close 刷新缓冲区, 结束 gzip 流并关闭文件; 可重复调用, 只有第一次生效
+func (out *dumpOutput) close() error {
+	if out.closed {
+		return nil
+	}
+	out.closed = true
+	var err error
+	if out.counter == nil {
+		// 调用方的缓冲区由调用方 Flush
+		err = bufferError(out.buf)
+	} else {
+		err = out.buf.Flush()
+	}
+	if out.gz != nil {
+		if gzErr := out.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if out.checksum != nil && err == nil {
+		out.manifest.add(out.name, out.checksum)
+	}
+	if out.file != nil {
+		if fileErr := out.file.Close(); err == nil {
+			err = fileErr
+		}
+	}
+	return err
+}
+
+// lineEndingWriter 将 \n 替换为 ending 后写入 w; 值中的换行已转义为 \n, 只有语句之间和语句中的换行被替换
+type lineEndingWriter struct {
+	w      io.Writer
+	ending []byte
+	// 复用的转换缓冲区
+	converted []byte
+}
+
+func (l *lineEndingWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	l.converted = l.converted[:0]
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			break
+		}
+		l.converted = append(l.converted, p[:i]...)
+		l.converted = append(l.converted, l.ending...)
+		p = p[i+1:]
+	}
+	l.converted = append(l.converted, p...)
+	_, err := l.w.Write(l.converted)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,254 @@
+package mysqldump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_lineEndingWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		ending string
+		writes []string
+		want   string
+	}{
+		{name: "crlf", ending: "\r\n", writes: []string{"SET NAMES utf8mb4;\n\nSELECT 1;\n"}, want: "SET NAMES utf8mb4;\r\n\r\nSELECT 1;\r\n"},
+		{name: "split writes", ending: "\r\n", writes: []string{"a;", "\n", "b;\nc"}, want: "a;\r\nb;\r\nc"},
+		{name: "escaped newline in value", ending: "\r\n", writes: []string{"INSERT INTO `t` VALUES ('a\\nb');\n"}, want: "INSERT INTO `t` VALUES ('a\\nb');\r\n"},
+		{name: "no newline", ending: "\r\n", writes: []string{"abc"}, want: "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := &lineEndingWriter{w: &b, ending: []byte(tt.ending)}
+			for _, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(s))
+				}
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("lineEndingWriter = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingWriter 记录每次 Write, 可以在导出过程中查看已写入的数据
+type recordingWriter struct {
+	mu     sync.Mutex
+	writes int
+	data   bytes.Buffer
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes++
+	return w.data.Write(p)
+}
+
+func (w *recordingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.data.String()
+}
+
+func Test_flushPerTable(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []DumpOption
+		// 查询 t2 时 t1 的数据是否已写入 writer, 并发导出和 gzip 时不检查
+		wantT1Visible bool
+		skipVisible   bool
+		// writer 至少收到的 Write 次数
+		wantWrites int
+		gzip       bool
+	}{
+		{name: "default", wantWrites: 1},
+		{name: "flush per table", opts: []DumpOption{WithFlushPerTable()}, wantT1Visible: true, wantWrites: 3},
+		{name: "parallel", opts: []DumpOption{WithFlushPerTable(), WithParallelism(2)}, skipVisible: true, wantWrites: 3},
+		{name: "gzip", opts: []DumpOption{WithFlushPerTable(), WithGzip()}, skipVisible: true, wantWrites: 3, gzip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &recordingWriter{}
+			var t1Visible bool
+			fixture := &dumpFixture{tables: []string{"t1", "t2"}, data: func(query string) ([]string, [][]driver.Value) {
+				if strings.HasSuffix(query, "FROM `test`.`t2`") {
+					t1Visible = strings.Contains(w.String(), "INSERT INTO `t1`")
+				}
+				return []string{"id"}, [][]driver.Value{{"1"}}
+			}}
+			connector := fixture.connector()
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			err := Dump(db, "test", append(tt.opts, WithData(), WithWriter(w))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.skipVisible && t1Visible != tt.wantT1Visible {
+				t.Errorf("t1 data written before t2 was queried = %v, want %v", t1Visible, tt.wantT1Visible)
+			}
+			if w.writes < tt.wantWrites {
+				t.Errorf("writes = %d, want at least %d", w.writes, tt.wantWrites)
+			}
+			got := w.String()
+			if tt.gzip {
+				r, err := gzip.NewReader(strings.NewReader(got))
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = string(b)
+			}
+			if !strings.Contains(got, "INSERT INTO `t2`") {
+				t.Errorf("dump does not contain t2 data:\n%s", got)
+			}
+		})
+	}
+}
+
+// limitWriter 写入 limit 字节后返回 errWriteFailed, 模拟已满的磁盘或断开的管道
+type limitWriter struct {
+	limit   int
+	written int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		n := w.limit - w.written
+		w.written = w.limit
+		return n, errWriteFailed
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func Test_dumpWriteError(t *testing.T) {
+	rows := testRows(5000)
+	tests := []struct {
+		name  string
+		limit int
+		opts  []DumpOption
+		// 并发导出时其它 worker 可能已开始读取之后的表
+		parallel bool
+	}{
+		{name: "header", limit: 0},
+		{name: "first table data", limit: 20000},
+		{name: "parallel", limit: 20000, opts: []DumpOption{WithParallelism(2)}, parallel: true},
+		{name: "jsonl", limit: 20000, opts: []DumpOption{WithFormat(FormatJSONL)}},
+		{name: "gzip", limit: 100, opts: []DumpOption{WithGzip()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var queries []string
+			connector := tableDumpConnector(rows, func(query string) {
+				mu.Lock()
+				queries = append(queries, query)
+				mu.Unlock()
+			})
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			w := &limitWriter{limit: tt.limit}
+			err := Dump(db, "test", append([]DumpOption{WithData(), WithAllTable(), WithWriter(w)}, tt.opts...)...)
+			if !errors.Is(err, errWriteFailed) {
+				t.Fatalf("Dump() error = %v, want %v", err, errWriteFailed)
+			}
+			if tt.parallel {
+				return
+			}
+			// 出错后不再导出之后的表
+			mu.Lock()
+			defer mu.Unlock()
+			for _, query := range queries {
+				if strings.Contains(query, "`t3`") {
+					t.Errorf("table t3 was dumped after the write error: %s", query)
+				}
+			}
+		})
+	}
+}
+
+func Test_bufferedWriter(t *testing.T) {
+	db := sql.OpenDB(tableDumpConnector(testRows(10), nil))
+	defer db.Close()
+	// 去掉开头和结尾注释中的时间
+	dumpOf := func(opts ...DumpOption) string {
+		var b strings.Builder
+		if err := Dump(db, "test", append([]DumpOption{WithData(), WithNoComments(), WithWriter(&b)}, opts...)...); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	tests := []struct {
+		name string
+		opts []DumpOption
+		want string
+		// 直接写入调用方的缓冲区
+		buffered bool
+	}{
+		{name: "buffered", want: dumpOf(), buffered: true},
+		{name: "line ending uses internal buffer", opts: []DumpOption{WithLineEnding("\r\n")}, want: dumpOf(WithLineEnding("\r\n"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			bw := bufio.NewWriterSize(&b, 1<<20)
+			result, err := DumpWithResult(db, "test", append([]DumpOption{WithData(), WithNoComments(), WithBufferedWriter(bw)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 只有内部缓冲区统计字节数
+			if buffered := result.BytesWritten == 0; buffered != tt.buffered {
+				t.Errorf("BytesWritten = %d, want written into the caller's buffer %v", result.BytesWritten, tt.buffered)
+			}
+			if err := bw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkBufferedWriter(b *testing.B) {
+	db := sql.OpenDB(tableDumpConnector(testRows(100), nil))
+	defer db.Close()
+	writers := []struct {
+		name string
+		opt  func(w *bufio.Writer) DumpOption
+	}{
+		{name: "WithWriter", opt: func(w *bufio.Writer) DumpOption { return WithWriter(w) }},
+		{name: "WithBufferedWriter", opt: WithBufferedWriter},
+	}
+	for _, writer := range writers {
+		b.Run(writer.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w := bufio.NewWriter(io.Discard)
+				if err := Dump(db, "test", WithData(), writer.opt(w)); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
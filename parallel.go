@@ -0,0 +1,185 @@
+package mysqldump
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// tableDumper 导出一个表, 写入 buf 的字节数由调用方计入 TableResult.Bytes
+type tableDumper func(ctx context.Context, table string, buf *bufio.Writer) (TableResult, error)
+
+// writeTables 按 tables 的顺序导出全部表, o.parallelism > 1 时并发导出
+func writeTables(ctx context.Context, tables []string, out *dumpOutput, o *dumpOption, dumpTable tableDumper) ([]TableResult, error) {
+	var flush func() error
+	if o.isFlushPerTable {
+		flush = out.flush
+	}
+	if o.parallelism > 1 {
+		return writeTablesParallel(ctx, tables, out.buf, o.parallelism, dumpTable, flush)
+	}
+	results := make([]TableResult, 0, len(tables))
+	for _, table := range tables {
+		tableStart := out.written()
+		tableResult, err := dumpTable(ctx, table, out.buf)
+		if err != nil {
+			return nil, err
+		}
+		tableResult.Bytes += out.written() - tableStart
+		results = append(results, tableResult)
+		if flush != nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// TableTimeoutError 表的导出超过了 WithTableTimeout
+type TableTimeoutError struct {
+	Table   string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TableTimeoutError) Error() string {
+	return fmt.Sprintf("dump table %s exceeded timeout %s: %v", e.Table, e.Timeout, e.Err)
+}
+
+func (e *TableTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// withTableTimeout 返回每个表最多用时 timeout 的 tableDumper
+func withTableTimeout(dumpTable tableDumper, timeout time.Duration) tableDumper {
+	return func(ctx context.Context, table string, buf *bufio.Writer) (TableResult, error) {
+		tableCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		tableResult, err := dumpTable(tableCtx, table, buf)
+		// 只有表自己的超时才包装, 外层 ctx 的取消原样返回
+		if err != nil && ctx.Err() == nil && errors.Is(tableCtx.Err(), context.DeadlineExceeded) {
+			err = &TableTimeoutError{Table: table, Timeout: timeout, Err: err}
+		}
+		return tableResult, err
+	}
+}
+
+// erNoSuchTable 表不存在, MySQL 错误码 ER_NO_SUCH_TABLE
+const erNoSuchTable = 1146
+
+// withSkipVanishedTables 返回的 tableDumper 在表已被删除时打印警告并返回 Skipped 的 TableResult,
+// 该表已写入的部分语句保留在输出中
+func withSkipVanishedTables(dumpTable tableDumper, logger Logger) tableDumper {
+	return func(ctx context.Context, table string, buf *bufio.Writer) (TableResult, error) {
+		tableResult, err := dumpTable(ctx, table, buf)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == erNoSuchTable {
+			logger.Warnf("table %s no longer exists, skipping: %v", table, err)
+			return TableResult{Name: table, Skipped: true}, nil
+		}
+		return tableResult, err
+	}
+}
+
+// tableOutput 并发导出时单个表的输出
+type tableOutput struct {
+	data   []byte
+	result TableResult
+	err    error
+	// 导出完成或放弃时关闭
+	done chan struct{}
+}
+
+// writeTablesParallel 使用 parallelism 个 goroutine 导出 tables, 按 tables 的顺序写入 buf;
+// flush 不为 nil 时每写入一个表后调用
+func writeTablesParallel(ctx context.Context, tables []string, buf *bufio.Writer, parallelism int, dumpTable tableDumper, flush func() error) ([]TableResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outputs := make([]*tableOutput, len(tables))
+	for i := range outputs {
+		outputs[i] = &tableOutput{done: make(chan struct{})}
+	}
+
+	// 记录最先发生的错误, 其它表因取消而返回的错误不覆盖它
+	var errOnce sync.Once
+	var firstErr error
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range tables {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				// 未分发的表直接放弃
+				for _, out := range outputs[i:] {
+					out.err = ctx.Err()
+					close(out.done)
+				}
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out := outputs[i]
+				var b bytes.Buffer
+				tableBuf := bufio.NewWriter(&b)
+				out.result, out.err = dumpTable(ctx, tables[i], tableBuf)
+				_ = tableBuf.Flush()
+				out.data = b.Bytes()
+				if out.err != nil {
+					fail(out.err)
+				}
+				close(out.done)
+			}
+		}()
+	}
+
+	results := make([]TableResult, 0, len(tables))
+	for _, out := range outputs {
+		<-out.done
+		if out.err != nil {
+			fail(out.err)
+			wg.Wait()
+			return nil, firstErr
+		}
+		if _, err := buf.Write(out.data); err != nil {
+			cancel()
+			wg.Wait()
+			return nil, err
+		}
+		out.result.Bytes += int64(len(out.data))
+		results = append(results, out.result)
+		// 已写出的表释放内存
+		out.data = nil
+		if flush != nil {
+			if err := flush(); err != nil {
+				cancel()
+				wg.Wait()
+				return nil, err
+			}
+		}
+	}
+	wg.Wait()
+	return results, nil
+}
@@ -0,0 +1,79 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func Test_withTableTimeout(t *testing.T) {
+	// 阻塞直到 ctx 结束
+	blocking := func(ctx context.Context, table string, buf *bufio.Writer) (TableResult, error) {
+		<-ctx.Done()
+		return TableResult{Name: table}, ctx.Err()
+	}
+
+	t.Run("table timeout names the table", func(t *testing.T) {
+		_, err := withTableTimeout(blocking, 10*time.Millisecond)(context.Background(), "big_table", nil)
+		var timeoutErr *TableTimeoutError
+		if !errors.As(err, &timeoutErr) || timeoutErr.Table != "big_table" {
+			t.Fatalf("error = %v, want *TableTimeoutError for big_table", err)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want to wrap context.DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("outer cancel not wrapped", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := withTableTimeout(blocking, time.Hour)(ctx, "t", nil)
+		var timeoutErr *TableTimeoutError
+		if errors.As(err, &timeoutErr) || !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("fast table succeeds", func(t *testing.T) {
+		fast := func(ctx context.Context, table string, buf *bufio.Writer) (TableResult, error) {
+			return TableResult{Name: table, Rows: 3}, nil
+		}
+		got, err := withTableTimeout(fast, time.Second)(context.Background(), "t", nil)
+		if err != nil || got.Rows != 3 {
+			t.Errorf("got %v, %v, want 3 rows", got, err)
+		}
+	})
+}
+
+func Test_withSkipVanishedTables(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantSkipped bool
+		wantErr     bool
+	}{
+		{name: "no such table", err: &mysql.MySQLError{Number: 1146, Message: "Table 'test.tmp' doesn't exist"}, wantSkipped: true},
+		{name: "wrapped no such table", err: fmt.Errorf("show create table: %w", &mysql.MySQLError{Number: 1146}), wantSkipped: true},
+		{name: "other mysql error", err: &mysql.MySQLError{Number: 1142, Message: "SELECT command denied"}, wantErr: true},
+		{name: "success"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dumpTable := func(ctx context.Context, table string, buf *bufio.Writer) (TableResult, error) {
+				return TableResult{Name: table, Rows: 1}, tt.err
+			}
+			got, err := withSkipVanishedTables(dumpTable, nopLogger{})(context.Background(), "tmp", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Skipped != tt.wantSkipped || got.Name != "tmp" {
+				t.Errorf("got %+v, want Skipped %v", got, tt.wantSkipped)
+			}
+		})
+	}
+}
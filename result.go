@@ -0,0 +1,53 @@
+package mysqldump
+
+import (
+	"io"
+	"time"
+)
+
+// DumpResult 导出结果统计
+type DumpResult struct {
+	// 开始时间
+	StartTime time.Time
+	// 结束时间
+	EndTime time.Time
+	// 耗时
+	Duration time.Duration
+	// 已导出的表, 按导出顺序
+	Tables []TableResult
+	// WithSkipVanishedTables 时导出过程中已被删除而跳过的表
+	SkippedTables []string
+	// 已导出的视图, 按导出顺序
+	Views []string
+	// 全部表的行数
+	TotalRows uint64
+	// 写入的 SQL 总字节数 (压缩前)
+	BytesWritten int64
+	// 开始读取表时的 binlog 位置, 只在 WithBinlogPosition 时设置
+	BinlogPosition *BinlogPosition
+	// WithIncremental 的表读取到的增量列最大值, 没有新的行时为 since, 作为下一次增量导出的 since
+	Watermarks map[string]time.Time
+}
+
+// TableResult 单个表的导出统计
+type TableResult struct {
+	Name string
+	// 导出的行数, 未导出数据时为 0
+	Rows uint64
+	// 该表结构和数据写入的字节数 (压缩前)
+	Bytes int64
+	// 导出过程中表已被删除, 只在 WithSkipVanishedTables 时出现
+	Skipped bool
+}
+
+// countingWriter 统计写入底层 writer 的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
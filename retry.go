@@ -0,0 +1,63 @@
+package mysqldump
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// retryQueryer 对 QueryContext 的临时错误重试, 只用于只读查询.
+// 只重试查询本身, 已开始读取的结果集中途出错不会重试
+type retryQueryer struct {
+	queryer
+	attempts int
+	backoff  time.Duration
+	logger   Logger
+}
+
+func newRetryQueryer(q queryer, attempts int, backoff time.Duration, logger Logger) *retryQueryer {
+	return &retryQueryer{queryer: q, attempts: attempts, backoff: backoff, logger: logger}
+}
+
+func (q *retryQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	delay := q.backoff
+	for attempt := 1; ; attempt++ {
+		rows, err := q.queryer.QueryContext(ctx, query, args...)
+		if err == nil || attempt >= q.attempts || !isTransientError(err) {
+			return rows, err
+		}
+		q.logger.Warnf("query failed (attempt %d/%d), retrying in %s: %v", attempt, q.attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransientError 判断错误是否可能在重试后消失: 连接断开, 锁等待超时和死锁
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		// ER_LOCK_WAIT_TIMEOUT, ER_LOCK_DEADLOCK, CR_SERVER_GONE_ERROR, CR_SERVER_LOST
+		case 1205, 1213, 2006, 2013:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
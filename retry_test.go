@@ -0,0 +1,63 @@
+package mysqldump
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// failingQueryer 前 failures 次 QueryContext 返回 err
+type failingQueryer struct {
+	queryer
+	failures int
+	err      error
+	calls    int
+}
+
+func (q *failingQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	q.calls++
+	if q.calls <= q.failures {
+		return nil, q.err
+	}
+	return nil, nil
+}
+
+func Test_retryQueryer(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		attempts  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "bad connection retried", failures: 2, err: driver.ErrBadConn, attempts: 3, wantCalls: 3},
+		{name: "lock wait timeout retried", failures: 1, err: &mysql.MySQLError{Number: 1205}, attempts: 3, wantCalls: 2},
+		{name: "attempts exhausted", failures: 5, err: mysql.ErrInvalidConn, attempts: 3, wantCalls: 3, wantErr: true},
+		{name: "syntax error not retried", failures: 1, err: &mysql.MySQLError{Number: 1064}, attempts: 3, wantCalls: 1, wantErr: true},
+		{name: "wrapped error retried", failures: 1, err: fmt.Errorf("query: %w", driver.ErrBadConn), attempts: 2, wantCalls: 2},
+		{name: "context canceled not retried", failures: 1, err: context.Canceled, attempts: 3, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &failingQueryer{failures: tt.failures, err: tt.err}
+			q := newRetryQueryer(f, tt.attempts, time.Millisecond, nopLogger{})
+			_, err := q.QueryContext(context.Background(), "SELECT 1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("QueryContext() error = %v, want %v", err, tt.err)
+			}
+			if f.calls != tt.wantCalls {
+				t.Errorf("QueryContext() calls = %d, want %d", f.calls, tt.wantCalls)
+			}
+		})
+	}
+}
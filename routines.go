@@ -0,0 +1,223 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// routine 存储过程或函数
+type routine struct {
+	name string
+	// PROCEDURE 或 FUNCTION
+	routineType string
+}
+
+// definerRegexp 匹配 DEFINER=`user`@`host` 子句
+var definerRegexp = regexp.MustCompile("DEFINER\\s*=\\s*(?:`[^`]*`|'[^']*'|[^\\s@]+)(?:@(?:`[^`]*`|'[^']*'|\\S+))?\\s*")
+
+// rewriteDefiner 将 CREATE 语句中的 DEFINER 子句替换为 definer, definer 为空时删除该子句;
+// 只处理第一个匹配, 不改动程序体
+func rewriteDefiner(createSQL, definer string) string {
+	loc := definerRegexp.FindStringIndex(createSQL)
+	if loc == nil {
+		return createSQL
+	}
+	replacement := ""
+	if definer != "" {
+		replacement = "DEFINER=" + quoteDefiner(definer) + " "
+	}
+	return createSQL[:loc[0]] + replacement + createSQL[loc[1]:]
+}
+
+// quoteDefiner 将 user@host 转为 `user`@`host`, 已加引号或 CURRENT_USER 原样返回
+func quoteDefiner(definer string) string {
+	if strings.ContainsAny(definer, "`'") || strings.EqualFold(strings.TrimSuffix(definer, "()"), "CURRENT_USER") {
+		return definer
+	}
+	idx := strings.LastIndex(definer, "@")
+	if idx == -1 {
+		return "`" + definer + "`@`%`"
+	}
+	return "`" + definer[:idx] + "`@`" + definer[idx+1:] + "`"
+}
+
+// applyDefiner 按 WithReplaceDefiner / WithStripDefiner 处理 DEFINER 子句
+func (o *dumpOption) applyDefiner(createSQL string) string {
+	if o.replaceDefiner != "" {
+		return rewriteDefiner(createSQL, o.replaceDefiner)
+	}
+	if o.isStripDefiner {
+		return rewriteDefiner(createSQL, "")
+	}
+	return createSQL
+}
+
+func getAllRoutines(ctx context.Context, db queryer, dbName string) ([]routine, error) {
+	var routines []routine
+	rows, err := db.QueryContext(ctx, "SELECT ROUTINE_NAME, ROUTINE_TYPE FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? ORDER BY ROUTINE_TYPE, ROUTINE_NAME", dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r routine
+		err = rows.Scan(&r.name, &r.routineType)
+		if err != nil {
+			return nil, err
+		}
+		routines = append(routines, r)
+	}
+	return routines, rows.Err()
+}
+
+// getShowCreateSQL 执行 SHOW CREATE <objectType>, 返回第 column 列的定义
+func getShowCreateSQL(ctx context.Context, db queryer, objectType, dbName, name string, column int) (string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SHOW CREATE %s %s", objectType, qualifiedName(dbName, name)))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	} else if len(columns) <= column {
+		return "", fmt.Errorf("less then %d columns found on querying %s %s", column+1, objectType, name)
+	}
+	if !rows.Next() {
+		return "", fmt.Errorf("%s %s not found", objectType, name)
+	}
+	var createSQL sql.NullString
+	extras := make([]any, len(columns))
+	var notNeededData sql.NullString
+	for i := range extras {
+		extras[i] = &notNeededData
+	}
+	extras[column] = &createSQL
+	err = rows.Scan(extras...)
+	if err != nil {
+		return "", err
+	}
+	// 没有权限时 SHOW CREATE 返回 NULL
+	if !createSQL.Valid {
+		return "", fmt.Errorf("no privileges to read definition of %s %s", objectType, name)
+	}
+	return createSQL.String, nil
+}
+
+// writeStoredProgram 写入 DROP 语句和用 DELIMITER 包裹的 CREATE 语句
+func writeStoredProgram(objectType, name, createSQL string, buf *bufio.Writer, o *dumpOption) {
+	writeComment(buf, o, fmt.Sprintf("%s structure for %s", objectType, name))
+	_, _ = buf.WriteString(fmt.Sprintf("DROP %s IF EXISTS %s%s\n", objectType, quoteIdentifier(name), o.terminator))
+	delimiter := "$$"
+	if o.terminator == delimiter {
+		delimiter = ";;"
+	}
+	_, _ = buf.WriteString("DELIMITER " + delimiter + "\n")
+	_, _ = buf.WriteString(o.rewriteStatement(createSQL) + delimiter + "\n")
+	_, _ = buf.WriteString("DELIMITER " + o.terminator + "\n\n")
+}
+
+func writeRoutines(ctx context.Context, db queryer, dbName string, buf *bufio.Writer, o *dumpOption) error {
+	routines, err := getAllRoutines(ctx, db, dbName)
+	if err != nil {
+		return err
+	}
+	for _, r := range routines {
+		createSQL, err := getShowCreateSQL(ctx, db, r.routineType, dbName, r.name, 2)
+		if err != nil {
+			return err
+		}
+		createSQL = o.renameQualifiers(o.applyDefiner(createSQL), dbName)
+		writeStoredProgram(r.routineType, r.name, createSQL, buf, o)
+	}
+	return nil
+}
+
+// getTableTriggers 按执行顺序返回表上的触发器
+func getTableTriggers(ctx context.Context, db queryer, dbName, table string) ([]string, error) {
+	var triggers []string
+	rows, err := db.QueryContext(ctx, "SELECT TRIGGER_NAME FROM information_schema.TRIGGERS WHERE EVENT_OBJECT_SCHEMA = ? AND EVENT_OBJECT_TABLE = ? ORDER BY EVENT_MANIPULATION, ACTION_TIMING, ACTION_ORDER", dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var trigger string
+		err = rows.Scan(&trigger)
+		if err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, trigger)
+	}
+	return triggers, rows.Err()
+}
+
+// writeTableTriggers 写入表上的触发器, 需在表数据之后调用, 避免导入时触发器重复处理数据
+func writeTableTriggers(ctx context.Context, db queryer, dbName, table string, buf *bufio.Writer, o *dumpOption) error {
+	triggers, err := getTableTriggers(ctx, db, dbName, table)
+	if err != nil {
+		return err
+	}
+	for _, trigger := range triggers {
+		createSQL, err := getShowCreateSQL(ctx, db, "TRIGGER", dbName, trigger, 2)
+		if err != nil {
+			return err
+		}
+		createSQL = o.renameQualifiers(o.applyDefiner(createSQL), dbName)
+		writeStoredProgram("TRIGGER", trigger, createSQL, buf, o)
+	}
+	return nil
+}
+
+// eventStatusRegexp 匹配 SHOW CREATE EVENT 输出中 ON COMPLETION 之后的状态
+var eventStatusRegexp = regexp.MustCompile(`(?s)^(.*?\bON SCHEDULE\b.*?\bON COMPLETION (?:NOT )?PRESERVE )(?:ENABLE|DISABLE ON SLAVE|DISABLE ON REPLICA|DISABLE)\b`)
+
+// setEventStatus 将 CREATE EVENT 语句的状态改为 ENABLE 或 DISABLE
+func setEventStatus(createSQL string, enabled bool) string {
+	status := "DISABLE"
+	if enabled {
+		status = "ENABLE"
+	}
+	return eventStatusRegexp.ReplaceAllString(createSQL, "${1}"+status)
+}
+
+func getAllEvents(ctx context.Context, db queryer, dbName string) ([]string, error) {
+	var events []string
+	rows, err := db.QueryContext(ctx, "SELECT EVENT_NAME FROM information_schema.EVENTS WHERE EVENT_SCHEMA = ? ORDER BY EVENT_NAME", dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event string
+		err = rows.Scan(&event)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func writeEvents(ctx context.Context, db queryer, dbName string, buf *bufio.Writer, o *dumpOption) error {
+	events, err := getAllEvents(ctx, db, dbName)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		createSQL, err := getShowCreateSQL(ctx, db, "EVENT", dbName, event, 3)
+		if err != nil {
+			return err
+		}
+		createSQL = o.renameQualifiers(o.applyDefiner(createSQL), dbName)
+		if o.eventStatus != nil {
+			createSQL = setEventStatus(createSQL, *o.eventStatus)
+		}
+		writeStoredProgram("EVENT", event, createSQL, buf, o)
+	}
+	return nil
+}
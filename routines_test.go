@@ -0,0 +1,108 @@
+package mysqldump
+
+import "testing"
+
+func Test_rewriteDefiner(t *testing.T) {
+	type args struct {
+		createSQL string
+		definer   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "procedure",
+			args: args{createSQL: "CREATE DEFINER=`root`@`localhost` PROCEDURE `p`()\nBEGIN\n  SELECT 1;\nEND"},
+			want: "CREATE PROCEDURE `p`()\nBEGIN\n  SELECT 1;\nEND",
+		},
+		{
+			name: "function with host wildcard",
+			args: args{createSQL: "CREATE DEFINER=`app`@`%` FUNCTION `f`() RETURNS int\n    DETERMINISTIC\nRETURN 1"},
+			want: "CREATE FUNCTION `f`() RETURNS int\n    DETERMINISTIC\nRETURN 1",
+		},
+		{
+			name: "no definer",
+			args: args{createSQL: "CREATE PROCEDURE `p`() SELECT 1"},
+			want: "CREATE PROCEDURE `p`() SELECT 1",
+		},
+		{
+			name: "view sql security definer",
+			args: args{createSQL: "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`localhost` SQL SECURITY DEFINER VIEW `v` AS select 1 AS `1`"},
+			want: "CREATE ALGORITHM=UNDEFINED SQL SECURITY DEFINER VIEW `v` AS select 1 AS `1`",
+		},
+		{
+			name: "view sql security invoker",
+			args: args{createSQL: "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`localhost` SQL SECURITY INVOKER VIEW `v` AS select 1 AS `1`"},
+			want: "CREATE ALGORITHM=UNDEFINED SQL SECURITY INVOKER VIEW `v` AS select 1 AS `1`",
+		},
+		{
+			name: "replace view sql security definer",
+			args: args{
+				createSQL: "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`localhost` SQL SECURITY DEFINER VIEW `v` AS select 1 AS `1`",
+				definer:   "app@%",
+			},
+			want: "CREATE ALGORITHM=UNDEFINED DEFINER=`app`@`%` SQL SECURITY DEFINER VIEW `v` AS select 1 AS `1`",
+		},
+		{
+			name: "replace view sql security invoker",
+			args: args{
+				createSQL: "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`localhost` SQL SECURITY INVOKER VIEW `v` AS select 1 AS `1`",
+				definer:   "CURRENT_USER",
+			},
+			want: "CREATE ALGORITHM=UNDEFINED DEFINER=CURRENT_USER SQL SECURITY INVOKER VIEW `v` AS select 1 AS `1`",
+		},
+		{
+			name: "replace with quoted definer",
+			args: args{
+				createSQL: "CREATE DEFINER=`root`@`localhost` TRIGGER `t` BEFORE INSERT ON `a` FOR EACH ROW SET NEW.x = 1",
+				definer:   "`app`@`10.0.0.1`",
+			},
+			want: "CREATE DEFINER=`app`@`10.0.0.1` TRIGGER `t` BEFORE INSERT ON `a` FOR EACH ROW SET NEW.x = 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteDefiner(tt.args.createSQL, tt.args.definer); got != tt.want {
+				t.Errorf("rewriteDefiner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setEventStatus(t *testing.T) {
+	type args struct {
+		createSQL string
+		enabled   bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "enable to disable",
+			args: args{
+				createSQL: "CREATE DEFINER=`root`@`%` EVENT `ENABLE` ON SCHEDULE EVERY 1 DAY STARTS '2024-01-01 00:00:00' ON COMPLETION NOT PRESERVE ENABLE DO DELETE FROM t",
+				enabled:   false,
+			},
+			want: "CREATE DEFINER=`root`@`%` EVENT `ENABLE` ON SCHEDULE EVERY 1 DAY STARTS '2024-01-01 00:00:00' ON COMPLETION NOT PRESERVE DISABLE DO DELETE FROM t",
+		},
+		{
+			name: "disable on slave to enable",
+			args: args{
+				createSQL: "CREATE EVENT `e` ON SCHEDULE AT '2024-01-01 00:00:00' ON COMPLETION PRESERVE DISABLE ON SLAVE COMMENT 'x' DO SELECT 1",
+				enabled:   true,
+			},
+			want: "CREATE EVENT `e` ON SCHEDULE AT '2024-01-01 00:00:00' ON COMPLETION PRESERVE ENABLE COMMENT 'x' DO SELECT 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setEventStatus(tt.args.createSQL, tt.args.enabled); got != tt.want {
+				t.Errorf("setEventStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package mysqldump
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tableRows 逐行读取一个表的数据, 跳过生成列, 应用 WithWhere 和 WithRowRewriter, 并调用进度回调.
+// 各种输出格式共用; 每行的值在各行之间复用, 只在下一次调用 next 之前有效
+type tableRows struct {
+	table   string
+	rows    *sql.Rows
+	columns []string
+	types   []*sql.ColumnType
+	// 是否跳过了生成列或包含不可见列, 此时 INSERT 必须写列名
+	explicitColumns bool
+	// TINYINT(1) 列
+	boolean []bool
+	// 空间类型列
+	spatial []bool
+	// WithCharsetIntroducers 时读取原始字节的列的字符集, 其它列为空; 没有这样的列时为 nil
+	introducers []string
+
+	data []sql.RawBytes
+	ptrs []any
+	// DATE, DATETIME 和 TIMESTAMP 列, 其它列为 nil
+	temporal []*temporalValue
+	// WithRowRewriter 修改后的值
+	rewritten      []sql.NullString
+	rewrittenBytes [][]byte
+
+	// WithKeyRangeChunking 时分段读取, 否则为 nil
+	chunks *chunkedQuery
+	// WithIncremental 时跟踪增量列的最大值, 否则为 nil
+	watermark *watermarkColumn
+
+	o     *dumpOption
+	count uint64
+	err   error
+}
+
+// keyRangeChunk WithKeyRangeChunking 的设置
+type keyRangeChunk struct {
+	column string
+	size   int
+}
+
+// chunkedQuery 按 column 的值分段查询一个表, 每段最多 size 行
+type chunkedQuery struct {
+	ctx context.Context
+	db  queryer
+	// SELECT 列表和表名, WithWhere 的条件
+	selectList string
+	from       string
+	condition  string
+	column     string
+	// 上一段最后的键写入语句的方式; 不使用 ? 参数, 否则除第一段外都经预处理语句的二进制协议读取,
+	// FLOAT, DOUBLE 和时间类型的值与文本协议的格式不同
+	kind valueKind
+	size int
+	// 总行数限制, 0 表示不限制
+	limit int
+	// column 在结果集中的位置
+	index int
+	// 上一段最后一行的键, 第一段之前 hasLast 为 false
+	last    []byte
+	hasLast bool
+	// 当前段已读取的行数
+	rows int
+}
+
+// statement 返回 read 行之后下一段的查询语句
+func (c *chunkedQuery) statement(read uint64) string {
+	var conditions []string
+	if c.condition != "" {
+		conditions = append(conditions, "("+c.condition+")")
+	}
+	if c.hasLast {
+		kind := c.kind
+		if kind == valueKindNumeric && !isInteger(c.last) {
+			kind = valueKindString
+		}
+		conditions = append(conditions, quoteIdentifier(c.column)+" > "+string(appendValue(nil, c.last, kind)))
+	}
+	var where string
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	size := c.size
+	if c.limit > 0 {
+		size = min(size, c.limit-int(read))
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s%s LIMIT %d", c.selectList, c.from, where, orderByClause([]string{c.column}), size)
+}
+
+// nextChunk 查询下一段, 上一段不满 size 行或已达到总行数限制时返回 nil
+func (c *chunkedQuery) nextChunk(read uint64) (*sql.Rows, error) {
+	if c.rows < c.size || c.limit > 0 && read >= uint64(c.limit) {
+		return nil, nil
+	}
+	c.rows = 0
+	return c.db.QueryContext(c.ctx, c.statement(read))
+}
+
+// hasUniqueKey 判断 column 是否单独构成一个唯一索引且不为 NULL; 否则分段边界上值相同的行会丢失
+func hasUniqueKey(ctx context.Context, db queryer, dbName, table, column string) (bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT INDEX_NAME, COLUMN_NAME, NULLABLE FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND NON_UNIQUE = 0", dbName, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	// 每个唯一索引的列数, 以及是否只有 column 一列且不为 NULL
+	counts := make(map[string]int)
+	matches := make(map[string]bool)
+	for rows.Next() {
+		var index, name, nullable string
+		if err = rows.Scan(&index, &name, &nullable); err != nil {
+			return false, err
+		}
+		counts[index]++
+		matches[index] = name == column && nullable != "YES"
+	}
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+	for index, match := range matches {
+		if match && counts[index] == 1 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// queryTableRows 查询表的数据, tableColumns 为 getTableColumns 返回的列
+func queryTableRows(ctx context.Context, db queryer, dbName, table string, tableColumns []tableColumn, o *dumpOption) (*tableRows, error) {
+	var where string
+	if condition := o.dataCondition(table); condition != "" {
+		where = " WHERE " + condition
+	}
+
+	// 生成列的值不能 INSERT, 不导出
+	selectList, explicitColumns := selectColumnList(tableColumns)
+	var err error
+	var introducers []string
+	if o.isCharsetIntroducers && o.format == FormatSQL {
+		dumpCharset := o.dumpCharset
+		if dumpCharset == "" {
+			dumpCharset, err = getConnectionCharset(ctx, db)
+			if err != nil {
+				return nil, err
+			}
+		}
+		charsets := make([]string, len(tableColumns))
+		found := false
+		for i, column := range tableColumns {
+			charsets[i] = column.needsIntroducer(dumpCharset)
+			found = found || charsets[i] != ""
+		}
+		if found {
+			selectList = introducerColumnList(tableColumns, charsets)
+			for i, column := range tableColumns {
+				if !column.isGenerated() {
+					introducers = append(introducers, charsets[i])
+				}
+			}
+		}
+	}
+
+	var orderBy string
+	if o.isOrderByPrimaryKey {
+		primaryKeys, err := getPrimaryKeyColumns(ctx, db, dbName, table)
+		if err != nil {
+			return nil, err
+		}
+		orderBy = orderByClause(primaryKeys)
+	}
+	if limit := o.rowLimitOf(table); limit > 0 {
+		orderBy += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	// 大表的查询可能很久才返回第一行, 开始前先报告一次
+	if o.dumpProgress != nil {
+		o.dumpProgress(table, 0)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s%s%s", selectList, qualifiedName(dbName, table), where, orderBy)
+	var chunks *chunkedQuery
+	if chunk, ok := o.keyRangeChunks[table]; ok {
+		chunks = &chunkedQuery{ctx: ctx, db: db, selectList: selectList, from: qualifiedName(dbName, table),
+			condition: o.dataCondition(table), column: chunk.column, size: chunk.size, limit: o.rowLimitOf(table)}
+		found := false
+		for _, column := range tableColumns {
+			if column.name == chunk.column && !column.isGenerated() {
+				chunks.kind = valueKindString
+				if column.isInteger() {
+					chunks.kind = valueKindNumeric
+				} else if columnKind(column.dataType(), false) == valueKindBinary {
+					chunks.kind = valueKindBinary
+				}
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("key range chunking column %s not found in table %s", chunk.column, table)
+		}
+		unique, err := hasUniqueKey(ctx, db, dbName, table, chunk.column)
+		if err != nil {
+			return nil, err
+		}
+		if !unique {
+			return nil, fmt.Errorf("key range chunking column %s of table %s must have a unique NOT NULL index", chunk.column, table)
+		}
+		query = chunks.statement(0)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	r := &tableRows{table: table, rows: rows, explicitColumns: explicitColumns, introducers: introducers, chunks: chunks, o: o}
+	r.columns, err = rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if inc, ok := o.incrementals[table]; ok && o.watermarks != nil {
+		r.watermark = &watermarkColumn{inc: inc, index: slices.Index(r.columns, inc.column)}
+		if r.watermark.index < 0 {
+			rows.Close()
+			return nil, fmt.Errorf("incremental column %s not found in table %s", inc.column, table)
+		}
+	}
+	if chunks != nil {
+		chunks.index = slices.Index(r.columns, chunks.column)
+		if chunks.index < 0 {
+			rows.Close()
+			return nil, fmt.Errorf("key range chunking column %s not found in table %s", chunks.column, table)
+		}
+	}
+	r.types, err = rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	r.boolean = make([]bool, len(r.columns))
+	r.spatial = make([]bool, len(r.columns))
+	for i, name := range r.columns {
+		for _, column := range tableColumns {
+			if column.name == name {
+				r.boolean[i] = column.isBoolean()
+				r.spatial[i] = column.isSpatial()
+				break
+			}
+		}
+	}
+
+	// data 在各行之间复用, 避免每行分配内存
+	r.data = make([]sql.RawBytes, len(r.columns))
+	r.ptrs = make([]any, len(r.columns))
+	r.temporal = make([]*temporalValue, len(r.columns))
+	for i := range r.data {
+		r.ptrs[i] = &r.data[i]
+		switch typeName := r.types[i].DatabaseTypeName(); typeName {
+		case "DATE", "DATETIME", "TIMESTAMP":
+			_, fsp, _ := r.types[i].DecimalSize()
+			r.temporal[i] = newTemporalValue(typeName, int(fsp))
+			if o.isZeroDateReplacement {
+				r.temporal[i].replaceZero = true
+				r.temporal[i].zeroReplacement = o.zeroDateReplacement
+			}
+			r.ptrs[i] = r.temporal[i]
+		}
+	}
+	if o.rowRewriter != nil {
+		r.rewritten = make([]sql.NullString, len(r.columns))
+		r.rewrittenBytes = make([][]byte, len(r.columns))
+		for i := range r.rewrittenBytes {
+			r.rewrittenBytes[i] = []byte{}
+		}
+	}
+	return r, nil
+}
+
+// orderByClause 返回按 columns 排序的 ORDER BY 子句, columns 为空时返回空字符串
+func orderByClause(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	return " ORDER BY " + strings.Join(quoted, ",")
+}
+
+// next 读取下一行, 没有更多行或出错时返回 false, 错误由 done 返回
+func (r *tableRows) next() bool {
+	for !r.rows.Next() {
+		if r.err = r.rows.Err(); r.err != nil || r.chunks == nil {
+			return false
+		}
+		// 当前段已读完, 查询下一段
+		rows, err := r.chunks.nextChunk(r.count)
+		if rows == nil {
+			r.err = err
+			return false
+		}
+		r.rows = rows
+	}
+	// Scan 把 NULL 设为 nil, 把空字符串追加到原切片上;
+	// 原切片为 nil 时空字符串也会变成 nil, 所以先换成非 nil 的空切片
+	for i := range r.data {
+		if r.data[i] == nil {
+			r.data[i] = sql.RawBytes{}
+		}
+	}
+	if err := r.rows.Scan(r.ptrs...); err != nil {
+		r.err = err
+		return false
+	}
+
+	if r.chunks != nil {
+		key := r.scanned(r.chunks.index)
+		if key == nil {
+			r.err = fmt.Errorf("key range chunking column %s of table %s is NULL", r.chunks.column, r.table)
+			return false
+		}
+		r.chunks.last = append(r.chunks.last[:0], key...)
+		r.chunks.hasLast = true
+		r.chunks.rows++
+	}
+
+	if r.watermark != nil {
+		r.watermark.observe(r.scanned(r.watermark.index))
+	}
+
+	if r.rewritten != nil {
+		for i := range r.data {
+			value := r.scanned(i)
+			r.rewritten[i] = sql.NullString{String: string(value), Valid: value != nil}
+		}
+		r.o.rowRewriter(r.table, r.columns, r.rewritten)
+	}
+
+	r.count++
+	if r.o.dumpProgress != nil && r.count%dumpProgressInterval == 0 {
+		r.o.dumpProgress(r.table, r.count)
+	}
+	return true
+}
+
+// scanned 返回当前行第 i 列读取到的值, NULL 为 nil
+func (r *tableRows) scanned(i int) []byte {
+	if r.temporal[i] != nil {
+		return r.temporal[i].value
+	}
+	return r.data[i]
+}
+
+// value 返回当前行第 i 列的值, 即 WithRowRewriter 改写后的值, NULL 为 nil
+func (r *tableRows) value(i int) []byte {
+	if r.rewritten == nil {
+		return r.scanned(i)
+	}
+	if !r.rewritten[i].Valid {
+		return nil
+	}
+	r.rewrittenBytes[i] = append(r.rewrittenBytes[i][:0], r.rewritten[i].String...)
+	return r.rewrittenBytes[i]
+}
+
+// done 关闭结果集, 调用最后一次进度回调, 返回读取中的错误
+func (r *tableRows) done() error {
+	r.rows.Close()
+	if r.err != nil {
+		return r.err
+	}
+	if r.watermark != nil {
+		t, err := r.watermark.watermark()
+		if err != nil {
+			return err
+		}
+		r.o.watermarks.add(r.table, t)
+	}
+	if r.o.dumpProgress != nil {
+		r.o.dumpProgress(r.table, r.count)
+	}
+	return nil
+}
+
+// close 提前结束读取时释放结果集
+func (r *tableRows) close() {
+	r.rows.Close()
+}
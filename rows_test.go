@@ -0,0 +1,545 @@
+package mysqldump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_orderByPrimaryKey(t *testing.T) {
+	data := [][]driver.Value{{"1", "a"}, {"2", "b"}, {"3", "c"}}
+	// 不排序时每次查询返回的行顺序不同
+	selects := 0
+	fixture := &dumpFixture{
+		columns: [][]driver.Value{{"id", "", "int", "", nil}, {"name", "", "varchar(10)", "", "utf8mb4"}},
+		data: func(query string) ([]string, [][]driver.Value) {
+			rows := slices.Clone(data)
+			if !strings.HasSuffix(query, " ORDER BY `id`") {
+				selects++
+				if selects%2 == 0 {
+					slices.Reverse(rows)
+				}
+			}
+			return []string{"id", "name"}, rows
+		},
+		query: primaryKeyQuery("id"),
+	}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	dump := func(o *dumpOption) string {
+		var sb strings.Builder
+		buf := bufio.NewWriter(&sb)
+		if _, err := writeTableData(context.Background(), db, "test", "t", testTableColumns(t, db, "t"), buf, o); err != nil {
+			t.Fatal(err)
+		}
+		_ = buf.Flush()
+		return sb.String()
+	}
+
+	o := newDumpOption([]DumpOption{WithNoComments()})
+	if dump(&o) == dump(&o) {
+		t.Fatal("unordered dumps are identical, the fake does not reorder rows")
+	}
+	o = newDumpOption([]DumpOption{WithNoComments(), WithOrderByPrimaryKey()})
+	first, second := dump(&o), dump(&o)
+	if first != second {
+		t.Errorf("dumps differ:\n%s\n%s", first, second)
+	}
+	if !strings.Contains(first, "('1','a'),('2','b'),('3','c')") {
+		t.Errorf("rows are not in primary key order:\n%s", first)
+	}
+}
+
+func Test_orderByClause(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		want    string
+	}{
+		{name: "no primary key", columns: nil, want: ""},
+		{name: "single column", columns: []string{"id"}, want: " ORDER BY `id`"},
+		{name: "composite key", columns: []string{"tenant_id", "id`x"}, want: " ORDER BY `tenant_id`,`id``x`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := orderByClause(tt.columns); got != tt.want {
+				t.Errorf("orderByClause() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_approximateRowCount(t *testing.T) {
+	var queries []string
+	fixture := &dumpFixture{query: func(query string) ([]string, [][]driver.Value, bool) {
+		queries = append(queries, query)
+		if strings.Contains(query, "information_schema.TABLES") {
+			return []string{"TABLE_ROWS"}, [][]driver.Value{{int64(1200000000)}}, true
+		}
+		return nil, nil, false
+	}}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	o := newDumpOption([]DumpOption{WithApproximateRowCount()})
+	var sb strings.Builder
+	buf := bufio.NewWriter(&sb)
+	if _, err := writeTableData(context.Background(), db, "test", "huge", testTableColumns(t, db, "huge"), buf, &o); err != nil {
+		t.Fatal(err)
+	}
+	_ = buf.Flush()
+	if !strings.Contains(sb.String(), "-- Records of huge (approximately 1200000000 rows)\n") {
+		t.Errorf("comment does not contain the estimate:\n%s", sb.String())
+	}
+	for _, query := range queries {
+		if strings.Contains(strings.ToUpper(query), "COUNT(") {
+			t.Errorf("issued a COUNT query: %s", query)
+		}
+	}
+}
+
+func Test_charsetIntroducers(t *testing.T) {
+	var dataQuery string
+	fixture := &dumpFixture{
+		columns: [][]driver.Value{
+			{"id", "", "int", "", nil},
+			{"name", "", "varchar(20)", "", "latin1"},
+			{"title", "", "varchar(20)", "", "utf8mb4"},
+		},
+		data: func(query string) ([]string, [][]driver.Value) {
+			dataQuery = query
+			// name 列读取的是 latin1 的原始字节
+			return []string{"id", "name", "title"}, [][]driver.Value{{"1", []byte("caf\xe9 \xc0 l'\xe9t\xe9"), "café"}, {"2", nil, ""}}
+		},
+	}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	o := newDumpOption([]DumpOption{WithNoComments(), WithCharsetIntroducers()})
+	o.dumpCharset = "utf8mb4"
+	var sb strings.Builder
+	buf := bufio.NewWriter(&sb)
+	if _, err := writeTableData(context.Background(), db, "test", "t", testTableColumns(t, db, "t"), buf, &o); err != nil {
+		t.Fatal(err)
+	}
+	_ = buf.Flush()
+
+	if want := "SELECT `id`,CAST(`name` AS BINARY) AS `name`,`title` FROM `test`.`t`"; dataQuery != want {
+		t.Errorf("query = %s, want %s", dataQuery, want)
+	}
+	if want := "('1',_latin1'caf\xe9 \xc0 l\\'\xe9t\xe9','café'),('2',NULL,'')"; !strings.Contains(sb.String(), want) {
+		t.Errorf("dump does not contain %q:\n%q", want, sb.String())
+	}
+}
+
+func Test_needsIntroducer(t *testing.T) {
+	tests := []struct {
+		name        string
+		column      tableColumn
+		dumpCharset string
+		want        string
+	}{
+		{name: "latin1 in utf8mb4 dump", column: tableColumn{columnType: "varchar(10)", charset: "latin1"}, dumpCharset: "utf8mb4", want: "latin1"},
+		{name: "same charset", column: tableColumn{columnType: "text", charset: "utf8mb4"}, dumpCharset: "UTF8MB4"},
+		{name: "utf8 alias", column: tableColumn{columnType: "text", charset: "utf8mb3"}, dumpCharset: "utf8"},
+		{name: "not a string column", column: tableColumn{columnType: "int"}, dumpCharset: "utf8mb4"},
+		{name: "generated column", column: tableColumn{columnType: "varchar(10)", charset: "latin1", extra: "VIRTUAL GENERATED"}, dumpCharset: "utf8mb4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.column.needsIntroducer(tt.dumpCharset); got != tt.want {
+				t.Errorf("needsIntroducer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendIntroduced(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   []byte
+		charset string
+		want    string
+	}{
+		{name: "latin1 accented", value: []byte("caf\xe9"), charset: "latin1", want: "_latin1'caf\xe9'"},
+		{name: "null", value: nil, charset: "latin1", want: "NULL"},
+		// 0x955C 是 sjis 的一个字符, 尾字节为反斜杠
+		{name: "sjis as hex", value: []byte{0x95, 0x5c}, charset: "sjis", want: "_sjis 0x955C"},
+		{name: "sjis empty", value: []byte{}, charset: "sjis", want: "_sjis ''"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(appendIntroduced(nil, tt.value, tt.charset)); got != tt.want {
+				t.Errorf("appendIntroduced() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rowLimit(t *testing.T) {
+	data := make([][]driver.Value, 1000)
+	for i := range data {
+		data[i] = []driver.Value{strconv.Itoa(i + 1)}
+	}
+	var dataQueries []string
+	fixture := &dumpFixture{
+		data: func(query string) ([]string, [][]driver.Value) {
+			dataQueries = append(dataQueries, query)
+			rows := data
+			if _, limit, ok := strings.Cut(query, " LIMIT "); ok {
+				n, _ := strconv.Atoi(limit)
+				rows = rows[:n]
+			}
+			return []string{"id"}, rows
+		},
+		query: primaryKeyQuery("id"),
+	}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	tests := []struct {
+		name      string
+		opts      []DumpOption
+		table     string
+		wantQuery string
+		wantRows  uint64
+	}{
+		{name: "global limit", opts: []DumpOption{WithRowLimit(10), WithOrderByPrimaryKey()}, table: "t", wantQuery: "SELECT * FROM `test`.`t` ORDER BY `id` LIMIT 10", wantRows: 10},
+		{name: "table limit overrides", opts: []DumpOption{WithRowLimit(10), WithTableRowLimit("t", 3)}, table: "t", wantQuery: "SELECT * FROM `test`.`t` LIMIT 3", wantRows: 3},
+		{name: "other table uses global", opts: []DumpOption{WithRowLimit(10), WithTableRowLimit("t", 3)}, table: "u", wantQuery: "SELECT * FROM `test`.`u` LIMIT 10", wantRows: 10},
+		{name: "table without limit", opts: []DumpOption{WithRowLimit(10), WithTableRowLimit("t", 0)}, table: "t", wantQuery: "SELECT * FROM `test`.`t`", wantRows: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataQueries = nil
+			o := newDumpOption(append(tt.opts, WithInsertBatchSize(1000)))
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			rows, err := writeTableData(context.Background(), db, "test", tt.table, testTableColumns(t, db, tt.table), buf, &o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = buf.Flush()
+			if len(dataQueries) != 1 || dataQueries[0] != tt.wantQuery {
+				t.Errorf("queries = %q, want %q", dataQueries, tt.wantQuery)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("rows = %d, want %d", rows, tt.wantRows)
+			}
+			if tuples := uint64(strings.Count(sb.String(), "('")); tuples != tt.wantRows {
+				t.Errorf("dump has %d value tuples, want %d", tuples, tt.wantRows)
+			}
+		})
+	}
+}
+
+func Test_rowsReadError(t *testing.T) {
+	errRead := errors.New("connection lost")
+	fixture := &dumpFixture{
+		data: func(string) ([]string, [][]driver.Value) {
+			return []string{"id"}, [][]driver.Value{{"1"}, {"2"}, {errRead}}
+		},
+	}
+	db := sql.OpenDB(fixture.connector())
+	defer db.Close()
+
+	tests := []struct {
+		name  string
+		write func(ctx context.Context, db queryer, dbName, table string, columns []tableColumn, buf *bufio.Writer, o *dumpOption) (uint64, error)
+	}{
+		{name: "sql", write: writeTableData},
+		{name: "csv", write: writeTableCSV},
+		{name: "jsonl", write: writeTableJSONL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newDumpOption(nil)
+			buf := bufio.NewWriter(io.Discard)
+			rows, err := tt.write(context.Background(), db, "test", "t", testTableColumns(t, db, "t"), buf, &o)
+			if !errors.Is(err, errRead) {
+				t.Fatalf("error = %v, want %v", err, errRead)
+			}
+			// 出错前已写出的行仍计入
+			if rows != 2 {
+				t.Errorf("rows = %d, want 2", rows)
+			}
+		})
+	}
+}
+
+func Test_identifierQuote(t *testing.T) {
+	db := sql.OpenDB((&dumpFixture{
+		columns: [][]driver.Value{{"id", "", "int", "", nil}, {`say "hi"`, "", "text", "", "utf8mb4"}},
+		data: func(string) ([]string, [][]driver.Value) {
+			return []string{"id", `say "hi"`}, [][]driver.Value{{"1", "a"}}
+		},
+	}).connector())
+	defer db.Close()
+
+	tests := []struct {
+		name  string
+		style IdentifierQuote
+		want  string
+	}{
+		{name: "backtick", style: IdentifierQuoteBacktick, want: "INSERT INTO `order` (`id`,`say \"hi\"`) VALUES ('1','a');\n"},
+		{name: "none", style: IdentifierQuoteNone, want: "INSERT INTO order (id,say \"hi\") VALUES ('1','a');\n"},
+		{name: "double quote", style: IdentifierQuoteDoubleQuote, want: "INSERT INTO \"order\" (\"id\",\"say \"\"hi\"\"\") VALUES ('1','a');\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newDumpOption([]DumpOption{WithNoComments(), WithIdentifierQuote(tt.style)})
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			if _, err := writeTableData(context.Background(), db, "test", "order", testTableColumns(t, db, "order"), buf, &o); err != nil {
+				t.Fatal(err)
+			}
+			_ = buf.Flush()
+			if got := sb.String(); got != tt.want+"\n" {
+				t.Errorf("writeTableData() = %q, want %q", got, tt.want+"\n")
+			}
+		})
+	}
+}
+
+func Test_keyRangeChunking(t *testing.T) {
+	// id 1..10, code 'k01'..'k10'
+	var data [][]driver.Value
+	for i := 1; i <= 10; i++ {
+		data = append(data, []driver.Value{strconv.Itoa(i), fmt.Sprintf("k%02d", i)})
+	}
+	keyPattern := regexp.MustCompile("`(id|code)` > (\\d+|'k\\d+')")
+	limitPattern := regexp.MustCompile(` LIMIT (\d+)$`)
+
+	tests := []struct {
+		name   string
+		column string
+		opts   []DumpOption
+		// information_schema.STATISTICS 中的唯一索引, 为 nil 时 id 和 code 各有一个
+		indexes [][]driver.Value
+		wantErr bool
+		// 期望导出的 id
+		wantIDs     []int
+		wantSelects []string
+	}{
+		{
+			name:    "integer key",
+			column:  "id",
+			wantIDs: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			wantSelects: []string{
+				"SELECT * FROM `test`.`t` ORDER BY `id` LIMIT 3",
+				"SELECT * FROM `test`.`t` WHERE `id` > 3 ORDER BY `id` LIMIT 3",
+				"SELECT * FROM `test`.`t` WHERE `id` > 6 ORDER BY `id` LIMIT 3",
+				"SELECT * FROM `test`.`t` WHERE `id` > 9 ORDER BY `id` LIMIT 3",
+			},
+		},
+		{
+			name:    "string key with where and row limit",
+			column:  "code",
+			opts:    []DumpOption{WithWhere("t", "id > 2"), WithTableRowLimit("t", 5)},
+			wantIDs: []int{3, 4, 5, 6, 7},
+			wantSelects: []string{
+				"SELECT * FROM `test`.`t` WHERE (id > 2) ORDER BY `code` LIMIT 3",
+				"SELECT * FROM `test`.`t` WHERE (id > 2) AND `code` > 'k05' ORDER BY `code` LIMIT 2",
+			},
+		},
+		{
+			name:    "non-unique key",
+			column:  "code",
+			indexes: [][]driver.Value{{"PRIMARY", "id", ""}, {"ix_id_code", "id", ""}, {"ix_id_code", "code", ""}},
+			wantErr: true,
+		},
+		{
+			name:    "nullable unique key",
+			column:  "code",
+			indexes: [][]driver.Value{{"uq_code", "code", "YES"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var selects []string
+			indexes := tt.indexes
+			if indexes == nil {
+				indexes = [][]driver.Value{{"PRIMARY", "id", ""}, {"uq_code", "code", ""}}
+			}
+			fixture := &dumpFixture{
+				columns: [][]driver.Value{{"id", "", "int", "", nil}, {"code", "", "char(3)", "", "utf8mb4"}},
+				query: func(query string) ([]string, [][]driver.Value, bool) {
+					if !strings.Contains(query, "information_schema.STATISTICS") {
+						return nil, nil, false
+					}
+					return []string{"INDEX_NAME", "COLUMN_NAME", "NULLABLE"}, indexes, true
+				},
+			}
+			fixture.data = func(query string) ([]string, [][]driver.Value) {
+				selects = append(selects, query)
+				// 模拟服务器执行 WHERE, ORDER BY 和 LIMIT
+				var rows [][]driver.Value
+				for _, row := range data {
+					id, _ := strconv.Atoi(row[0].(string))
+					if strings.Contains(query, "(id > 2)") && id <= 2 {
+						continue
+					}
+					if m := keyPattern.FindStringSubmatch(query); m != nil {
+						if strings.HasPrefix(m[2], "'") {
+							if row[1].(string) <= strings.Trim(m[2], "'") {
+								continue
+							}
+						} else if last, _ := strconv.Atoi(m[2]); id <= last {
+							continue
+						}
+					}
+					rows = append(rows, row)
+				}
+				if m := limitPattern.FindStringSubmatch(query); m != nil {
+					limit, _ := strconv.Atoi(m[1])
+					rows = rows[:min(limit, len(rows))]
+				}
+				return []string{"id", "code"}, rows
+			}
+			db := sql.OpenDB(fixture.connector())
+			defer db.Close()
+
+			o := newDumpOption(append(tt.opts, WithNoComments(), WithKeyRangeChunking("t", tt.column, 3)))
+			var sb strings.Builder
+			buf := bufio.NewWriter(&sb)
+			count, err := writeTableData(context.Background(), db, "test", "t", testTableColumns(t, db, "t"), buf, &o)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("writeTableData() error = nil, want an error for a column without a unique NOT NULL index")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = buf.Flush()
+			got := sb.String()
+
+			if count != uint64(len(tt.wantIDs)) {
+				t.Errorf("count = %d, want %d", count, len(tt.wantIDs))
+			}
+			for _, id := range tt.wantIDs {
+				value := fmt.Sprintf("('%d','k%02d')", id, id)
+				if n := strings.Count(got, value); n != 1 {
+					t.Errorf("%s written %d times, want once:\n%s", value, n, got)
+				}
+			}
+			if !slices.Equal(selects, tt.wantSelects) {
+				t.Errorf("selects = %q, want %q", selects, tt.wantSelects)
+			}
+		})
+	}
+}
+
+func Test_invisibleColumns(t *testing.T) {
+	var selects []string
+	fixture := &dumpFixture{
+		tables:      []string{"t"},
+		createTable: "CREATE TABLE `t` (\n  `id` int NOT NULL,\n  `secret` varchar(10) DEFAULT NULL /*!80023 INVISIBLE */\n) ENGINE=InnoDB",
+		columns:     [][]driver.Value{{"id", "", "int", "", nil}, {"secret", "INVISIBLE", "varchar(10)", "", "utf8mb4"}},
+		data: func(query string) ([]string, [][]driver.Value) {
+			selects = append(selects, query)
+			// SELECT * 不返回不可见列
+			if strings.HasPrefix(query, "SELECT * ") {
+				return []string{"id"}, [][]driver.Value{{"1"}}
+			}
+			return []string{"id", "secret"}, [][]driver.Value{{"1", "s1"}}
+		},
+	}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var b strings.Builder
+	err := Dump(db, "test", WithData(), WithCompleteInsert(false), WithWriter(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SELECT `id`,`secret` FROM `test`.`t`"}; !slices.Equal(selects, want) {
+		t.Errorf("selects = %q, want %q", selects, want)
+	}
+
+	// 导入时不可见列的值同样写入
+	target := &fakeConnector{}
+	targetDB := sql.OpenDB(target)
+	defer targetDB.Close()
+	err = Source(targetDB, "test", strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO `t` (`id`,`secret`) VALUES ('1','s1')"
+	if !slices.Contains(target.committed, want) {
+		t.Errorf("executed %q, want to contain %q", target.committed, want)
+	}
+}
+
+func Test_incremental(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var selects []string
+	fixture := &dumpFixture{
+		tables:  []string{"orders", "audit", "countries"},
+		columns: [][]driver.Value{{"id", "", "int", "", nil}, {"updated_at", "", "datetime(3)", "", nil}},
+		data: func(query string) ([]string, [][]driver.Value) {
+			selects = append(selects, query)
+			// 模拟服务器执行 WHERE: 只有 orders 有晚于 since 的行
+			if strings.Contains(query, "`orders`") {
+				return []string{"id", "updated_at"}, [][]driver.Value{{"2", "2024-05-03 09:30:00.250"}, {"3", "2024-05-02 08:00:00.000"}}
+			}
+			if strings.Contains(query, "`audit`") {
+				return []string{"id", "updated_at"}, nil
+			}
+			return []string{"id", "updated_at"}, [][]driver.Value{{"1", "2020-01-01 00:00:00.000"}}
+		},
+	}
+	connector := fixture.connector()
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var b strings.Builder
+	result, err := DumpWithResult(db, "test", WithData(), WithWriter(&b),
+		WithIncremental("orders", "updated_at", since),
+		WithIncremental("audit", "updated_at", since), WithWhere("audit", "id > 10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSelects := []string{
+		"SELECT * FROM `test`.`orders` WHERE `updated_at` > '2024-05-01 00:00:00'",
+		"SELECT * FROM `test`.`audit` WHERE (id > 10) AND `updated_at` > '2024-05-01 00:00:00'",
+		"SELECT * FROM `test`.`countries`",
+	}
+	if !slices.Equal(selects, wantSelects) {
+		t.Errorf("selects = %q, want %q", selects, wantSelects)
+	}
+	wantWatermarks := map[string]time.Time{
+		"orders": time.Date(2024, 5, 3, 9, 30, 0, 250e6, time.UTC),
+		// 没有新的行时为 since
+		"audit": since,
+	}
+	if len(result.Watermarks) != len(wantWatermarks) {
+		t.Fatalf("Watermarks = %v, want %v", result.Watermarks, wantWatermarks)
+	}
+	for table, want := range wantWatermarks {
+		if got := result.Watermarks[table]; !got.Equal(want) {
+			t.Errorf("Watermarks[%s] = %v, want %v", table, got, want)
+		}
+	}
+	if !strings.Contains(b.String(), "('2','2024-05-03 09:30:00.250'),('3','2024-05-02 08:00:00.000')") {
+		t.Errorf("dump does not contain the changed rows:\n%s", b.String())
+	}
+}
@@ -2,18 +2,43 @@ package mysqldump
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
+	"time"
 )
 
 type sourceOption struct {
 	dryRun      bool
 	mergeInsert int
 	debug       bool
+	// 语句出错后继续执行
+	forceContinue bool
+	// 进度回调
+	progress func(stmtIndex int, bytesRead int64)
+	// reader 内容的 SHA-256, 十六进制
+	expectedChecksum string
+	// 在一个事务中执行全部语句
+	transaction bool
+	// 超过该字节数的多行 INSERT 拆分后执行, 0 表示不拆分
+	splitSize int
+	// 诊断信息的输出, 默认为 nopLogger, WithDebug 时为 stdLogger
+	logger Logger
+	// 并发导入使用的连接数
+	parallelism int
 }
+
+// sourceProgressInterval 每执行多少条语句调用一次进度回调
+const sourceProgressInterval = 100
+
 type SourceOption func(*sourceOption)
 
 func WithDryRun() SourceOption {
@@ -28,138 +53,525 @@ func WithMergeInsert(size int) SourceOption {
 	}
 }
 
-// WithDebug 打印执行的 SQL
+// WithDebug 打印执行的 SQL 和出错的语句 (过长时截断), 使用 WithSourceLogger 时由 Logger 决定是否输出
 func WithDebug() SourceOption {
 	return func(o *sourceOption) {
 		o.debug = true
 	}
 }
 
+// WithSourceLogger 执行的 SQL (Debugf), 跳过的语句和出错的语句 (Errorf, 过长时截断) 写入 l, 不需要 WithDebug
+func WithSourceLogger(l Logger) SourceOption {
+	return func(o *sourceOption) {
+		o.logger = l
+	}
+}
+
+// WithForceContinue 语句执行失败时继续执行后面的语句, 类似 mysql --force;
+// 全部执行完后返回所有失败语句的错误 (*StatementError, 由 errors.Join 合并)
+func WithForceContinue() SourceOption {
+	return func(o *sourceOption) {
+		o.forceContinue = true
+	}
+}
+
+// WithProgress 每执行 100 条语句以及全部执行完后调用 fn, stmtIndex 为已执行的语句数,
+// bytesRead 为已读取的 SQL 字节数 (gzip 输入时为解压后); fn 在调用 Source 的 goroutine 中执行
+func WithProgress(fn func(stmtIndex int, bytesRead int64)) SourceOption {
+	return func(o *sourceOption) {
+		o.progress = fn
+	}
+}
+
+// WithExpectedChecksum 计算从 reader 读取的全部字节的 SHA-256, 与 checksum (WithChecksum 清单中的十六进制值) 不一致时
+// 不提交事务并返回 *ChecksumError; 执行过的 DDL 等会隐式提交的语句无法回滚
+func WithExpectedChecksum(checksum string) SourceOption {
+	return func(o *sourceOption) {
+		o.expectedChecksum = strings.ToLower(strings.TrimSpace(checksum))
+	}
+}
+
+// WithSourceTransaction 在一个 *sql.Tx 中执行全部语句, 没有错误时提交, 否则回滚, 失败的导入不留下部分数据.
+// MySQL 中 DDL (CREATE TABLE, DROP TABLE 等) 会隐式提交, 只适用于只有数据的 dump (WithData 且 WithNoCreateInfo);
+// dump 中的 START TRANSACTION, COMMIT, SET AUTOCOMMIT 和 LOCK TABLES / UNLOCK TABLES 也会结束事务, 这些语句被跳过.
+// 与 WithForceContinue 同时使用时, 有语句失败也会回滚
+func WithSourceTransaction() SourceOption {
+	return func(o *sourceOption) {
+		o.transaction = true
+	}
+}
+
+// WithSplitLargeStatements 将超过 maxBytes 字节的多行 INSERT / REPLACE 按行拆成多条不超过 maxBytes 的语句再执行,
+// 用于导入其它工具生成的超过服务器 max_allowed_packet 的 INSERT; maxBytes 应小于 max_allowed_packet.
+// 每条拆分后的语句单独计入 SourceResult; 单行本身超过 maxBytes 时仍按原样执行
+func WithSplitLargeStatements(maxBytes int) SourceOption {
+	return func(o *sourceOption) {
+		o.splitSize = maxBytes
+	}
+}
+
+// WithSourceParallelism 使用 n 个连接并发导入: 同一个表的 INSERT / REPLACE 在同一个连接上按原顺序执行,
+// 不同表的 INSERT 并发执行; 其它语句 (CREATE, ALTER, SET 等) 等之前的语句全部执行完后再执行, SET 和 USE 在每个连接上执行.
+// 适用于 Dump 生成的, 各表数据相互独立的 dump. 每个连接都 SET FOREIGN_KEY_CHECKS=0, 不同表的行不再按 dump 中的顺序写入;
+// 触发器或 INSERT ... SELECT 这样依赖其它表数据的语句结果可能不同. 每个连接分别提交, 其它语句执行前先提交各连接已执行的 INSERT; 失败时只回滚各连接未提交的部分.
+// 不能与 WithSourceTransaction 一起使用, WithDryRun 时忽略
+func WithSourceParallelism(n int) SourceOption {
+	return func(o *sourceOption) {
+		o.parallelism = n
+	}
+}
+
+// ChecksumError 导入的内容与 WithExpectedChecksum 不一致, dump 可能损坏或不完整
+type ChecksumError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// SourceResult 导入结果统计
+type SourceResult struct {
+	// 执行成功的语句数, 合并后的 INSERT 计为一条
+	Succeeded int
+	// 执行失败的语句数, 只在 WithForceContinue 时可能大于 1
+	Failed int
+	// 执行成功的 DDL (CREATE, ALTER, DROP 等), DML (INSERT, UPDATE, DELETE 等) 和其它语句 (SET 等) 数
+	DDL   int
+	DML   int
+	Other int
+	// 全部成功语句的 RowsAffected 之和
+	RowsAffected int64
+	// 导入耗时
+	Duration time.Duration
+}
+
+// count 统计一条执行成功的语句, WithDryRun 时 res 为 nil
+func (r *SourceResult) count(stmt string, res sql.Result) {
+	switch classifyStatement(stmt) {
+	case statementDDL:
+		r.DDL++
+	case statementDML:
+		r.DML++
+	default:
+		r.Other++
+	}
+	if res != nil {
+		if n, err := res.RowsAffected(); err == nil {
+			r.RowsAffected += n
+		}
+	}
+}
+
+// 语句类型
+const (
+	statementOther = iota
+	statementDDL
+	statementDML
+)
+
+var (
+	ddlKeywords = []string{"CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME"}
+	dmlKeywords = []string{"INSERT", "REPLACE", "UPDATE", "DELETE", "LOAD"}
+)
+
+// classifyStatement 按第一个关键字判断语句类型, /*! */ 条件注释中的语句为其它语句
+func classifyStatement(stmt string) int {
+	end := 0
+	for end < len(stmt) && isIdentifierByte(stmt[end]) {
+		end++
+	}
+	keyword := strings.ToUpper(stmt[:end])
+	switch {
+	case slices.Contains(ddlKeywords, keyword):
+		return statementDDL
+	case slices.Contains(dmlKeywords, keyword):
+		return statementDML
+	}
+	return statementOther
+}
+
+// StatementError 导入时某条语句执行失败
+type StatementError struct {
+	// 语句序号, 从 1 开始
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement #%d failed: %v", e.Index, e.Err)
+}
+
+// maxLoggedStatement 写入 Errorf 的出错语句的最大字节数, 更长的语句 (如多 MB 的 INSERT) 只记录开头
+const maxLoggedStatement = 1024
+
+// logStatementError 把 e 和出错的语句写入 l.Errorf, 语句超过 maxLoggedStatement 时截断
+func logStatementError(l Logger, e *StatementError) {
+	stmt := e.Statement
+	if len(stmt) > maxLoggedStatement {
+		stmt = fmt.Sprintf("%s... (%d bytes)", strings.ToValidUTF8(stmt[:maxLoggedStatement], ""), len(stmt))
+	}
+	l.Errorf("%v: %s", e, stmt)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// execer 执行导入语句, *sql.DB 和 *sql.Tx 都满足
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 type dbWrapper struct {
-	DB     *sql.DB
-	debug  bool
+	DB     execer
+	logger Logger
 	dryRun bool
 }
 
-func newDBWrapper(db *sql.DB, dryRun, debug bool) *dbWrapper {
+func newDBWrapper(db execer, dryRun bool, logger Logger) *dbWrapper {
 
 	return &dbWrapper{
 		DB:     db,
 		dryRun: dryRun,
-		debug:  debug,
+		logger: logger,
 	}
 }
 
-func (db *dbWrapper) Exec(query string, args ...interface{}) (sql.Result, error) {
+func (db *dbWrapper) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db.logger.Debugf("[sql] %s", query)
 	if db.dryRun {
 		return nil, nil
 	}
-	return db.DB.Exec(query, args...)
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+// Source 加载, gzip 压缩的 dump 自动解压
+func Source(db *sql.DB, dbName string, reader io.Reader, opts ...SourceOption) error {
+	return SourceContext(context.Background(), db, dbName, reader, opts...)
+}
+
+// SourceContext 与 Source 相同, 但所有语句都使用 ctx 执行
+func SourceContext(ctx context.Context, db *sql.DB, dbName string, reader io.Reader, opts ...SourceOption) error {
+	_, err := source(ctx, db, dbName, reader, opts...)
+	return err
+}
+
+// SourceWithResult 与 Source 相同, 并返回成功和失败的语句数
+func SourceWithResult(db *sql.DB, dbName string, reader io.Reader, opts ...SourceOption) (*SourceResult, error) {
+	return source(context.Background(), db, dbName, reader, opts...)
 }
 
-// Source 加载
+// SourceWithResultContext 与 SourceWithResult 相同, 但所有语句都使用 ctx 执行
+func SourceWithResultContext(ctx context.Context, db *sql.DB, dbName string, reader io.Reader, opts ...SourceOption) (*SourceResult, error) {
+	return source(ctx, db, dbName, reader, opts...)
+}
+
+// source 导入 SQL, 是所有 Source 函数的实现; 出错时也返回已统计的结果
 // 禁止 golangci-lint 检查
 // nolint: gocyclo
-func Source(db *sql.DB, dbName string, reader io.Reader, opts ...SourceOption) error {
+func source(ctx context.Context, db *sql.DB, dbName string, reader io.Reader, opts ...SourceOption) (*SourceResult, error) {
 	// 打印开始
+	start := time.Now()
+	result := &SourceResult{}
+	// 出错返回时也记录耗时
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+	// WithForceContinue 时收集的错误
+	var stmtErrs []error
 	var err error
 	var o sourceOption
 	for _, opt := range opts {
 		opt(&o)
 	}
+	if o.logger == nil {
+		o.logger = nopLogger{}
+		if o.debug {
+			o.logger = stdLogger{}
+		}
+	}
+
+	if o.parallelism > 1 && o.transaction {
+		return result, errors.New("WithSourceParallelism cannot be used with WithSourceTransaction")
+	}
+	var pool *sourcePool
+	if o.parallelism > 1 && !o.dryRun {
+		pool, err = newSourcePool(ctx, db, dbName, &o, result)
+		if err != nil {
+			return result, err
+		}
+		// 正常结束时已由 finish 释放
+		defer pool.abort()
+	}
 
 	// DB Wrapper
-	dbWrapper := newDBWrapper(db, o.dryRun, o.debug)
+	var target execer = db
+	var tx *sql.Tx
+	if o.transaction && !o.dryRun {
+		tx, err = db.BeginTx(ctx, nil)
+		if err != nil {
+			return result, err
+		}
+		// 已提交时 Rollback 不做任何事
+		defer tx.Rollback()
+		target = tx
+	}
+	dbWrapper := newDBWrapper(target, o.dryRun, o.logger)
 
 	// Use database
-	_, err = dbWrapper.Exec(fmt.Sprintf("USE `%s`", dbName))
-	if err != nil {
-		return err
+	if pool == nil {
+		_, err = dbWrapper.ExecContext(ctx, "USE "+quoteIdentifier(dbName))
+		if err != nil {
+			return result, err
+		}
 	}
 
 	// 设置超时时间1小时
 	db.SetConnMaxLifetime(3600)
 
 	// 一句一句执行
-	r := bufio.NewReader(reader)
-	// 关闭事务
-	_, err = dbWrapper.Exec("SET autocommit=0;")
+	checksum := sha256.New()
+	if o.expectedChecksum != "" {
+		// 校验和按压缩后的原始字节计算, 与 WithChecksum 一致
+		reader = io.TeeReader(reader, checksum)
+	}
+	reader, err = decompressReader(reader)
 	if err != nil {
-		return err
+		return result, err
+	}
+	completion := &completionReader{r: reader}
+	r := newStatementReader(completion)
+	// 关闭事务
+	if !o.transaction && pool == nil {
+		_, err = dbWrapper.ExecContext(ctx, "SET autocommit=0;")
+		if err != nil {
+			return result, err
+		}
 	}
 
 	for {
-		line, err := r.ReadString(';')
+		ssql, err := r.next()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return err
-		}
-
-		ssql := string(line)
-
-		// 删除末尾的换行符
-		ssql = trim(ssql)
-		if err != nil {
-			return err
+			return result, err
 		}
 
 		// 如果 INSERT 开始, 并且 mergeInsert 为 true, 则合并 INSERT
-		if o.mergeInsert > 1 && strings.HasPrefix(ssql, "INSERT INTO") {
+		if prefix := mergeableInsertPrefix(ssql); o.mergeInsert > 1 && prefix != "" {
 			var insertSQLs []string
 			insertSQLs = append(insertSQLs, ssql)
 			for i := 0; i < o.mergeInsert-1; i++ {
-				line, err := r.ReadString(';')
+				ssql2, err := r.next()
 				if err != nil {
 					if err == io.EOF {
 						break
 					}
-					return err
+					return result, err
 				}
 
-				ssql2 := string(line)
-				ssql2 = trim(ssql2)
-				if err != nil {
-					return err
-				}
-				if strings.HasPrefix(ssql2, "INSERT INTO") {
+				if mergeableInsertPrefix(ssql2) == prefix {
 					insertSQLs = append(insertSQLs, ssql2)
 					continue
 				}
 
+				// 不能合并 (如紧接着的是另一张表的 INSERT), 留给下一轮执行
+				r.unread(ssql2)
 				break
 			}
 			// 合并 INSERT
 			ssql, err = mergeInsert(insertSQLs)
 			if err != nil {
-				return err
+				return result, err
 			}
 		}
 
-		_, err = dbWrapper.Exec(ssql)
-		if err != nil {
-			return err
+		if (o.transaction || pool != nil) && isTransactionControl(ssql) {
+			// 会结束 WithSourceTransaction 的事务, 并发导入时由每个连接分别提交
+			o.logger.Debugf("[skip] %s", ssql)
+			continue
+		}
+
+		stmts := []string{ssql}
+		if o.splitSize > 0 && len(ssql) > o.splitSize {
+			if split := splitInsert(ssql, o.splitSize); split != nil {
+				stmts = split
+			}
+		}
+		for _, ssql := range stmts {
+			if pool != nil {
+				if err := pool.dispatch(ssql); err != nil {
+					return result, err
+				}
+				if o.progress != nil && pool.dispatched%sourceProgressInterval == 0 {
+					o.progress(pool.executed(), r.offset)
+				}
+				continue
+			}
+			res, err := dbWrapper.ExecContext(ctx, ssql)
+			if err != nil {
+				stmtErr := &StatementError{Index: result.Succeeded + result.Failed + 1, Statement: ssql, Err: err}
+				result.Failed++
+				logStatementError(o.logger, stmtErr)
+				// ctx 取消后继续执行也只会失败
+				if !o.forceContinue || ctx.Err() != nil {
+					return result, stmtErr
+				}
+				stmtErrs = append(stmtErrs, stmtErr)
+			} else {
+				result.Succeeded++
+				result.count(ssql, res)
+			}
+			if executed := result.Succeeded + result.Failed; o.progress != nil && executed%sourceProgressInterval == 0 {
+				o.progress(executed, r.offset)
+			}
+		}
+	}
+	if pool != nil {
+		if err := pool.wait(); err != nil {
+			return result, err
+		}
+	}
+	if completion.truncated() {
+		o.logger.Warnf("dump of %s does not end with %q, it may be truncated", dbName, dumpCompletedComment)
+	}
+	if o.progress != nil {
+		o.progress(result.Succeeded+result.Failed, r.offset)
+	}
+	o.logger.Infof("sourced %s: %d statements succeeded, %d failed", dbName, result.Succeeded, result.Failed)
+
+	if o.expectedChecksum != "" {
+		if actual := hex.EncodeToString(checksum.Sum(nil)); actual != o.expectedChecksum {
+			if pool != nil {
+				pool.abort()
+			} else if !o.transaction {
+				_, _ = dbWrapper.ExecContext(ctx, "ROLLBACK;")
+			}
+			return result, &ChecksumError{Expected: o.expectedChecksum, Actual: actual}
+		}
+	}
+
+	if pool != nil {
+		return result, pool.finish()
+	}
+
+	if o.transaction {
+		if err := errors.Join(stmtErrs...); err != nil {
+			return result, err
 		}
+		if tx != nil {
+			err = tx.Commit()
+			if err != nil {
+				return result, err
+			}
+		}
+		return result, nil
 	}
 
 	// 提交事务
-	_, err = dbWrapper.Exec("COMMIT;")
+	_, err = dbWrapper.ExecContext(ctx, "COMMIT;")
 	if err != nil {
-		return err
+		return result, err
 	}
 
 	// 开启事务
-	_, err = dbWrapper.Exec("SET autocommit=1;")
+	_, err = dbWrapper.ExecContext(ctx, "SET autocommit=1;")
 	if err != nil {
-		return err
+		return result, err
+	}
+
+	return result, errors.Join(stmtErrs...)
+}
+
+// decompressReader 以 gzip 魔数 0x1f 0x8b 开头时返回解压的 reader, 否则返回不丢失已预读字节的原始内容
+func decompressReader(reader io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(reader)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// completionReaderHead 检查开头注释时保留的字节数
+const completionReaderHead = 256
+
+// completionReader 保留读取内容的开头和结尾, 用于判断 Dump 生成的 dump 是否完整
+type completionReader struct {
+	r    io.Reader
+	head []byte
+	tail []byte
+}
+
+func (c *completionReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	data := p[:n]
+	if free := completionReaderHead - len(c.head); free > 0 {
+		c.head = append(c.head, data[:min(free, n)]...)
+	}
+	// 结尾多保留几个字节, 容纳注释后的换行
+	keep := len(dumpCompletedComment) + 8
+	if n >= keep {
+		c.tail = append(c.tail[:0], data[n-keep:]...)
+	} else {
+		c.tail = append(c.tail, data...)
+		if len(c.tail) > keep {
+			c.tail = append(c.tail[:0], c.tail[len(c.tail)-keep:]...)
+		}
 	}
+	return n, err
+}
 
-	return nil
+// truncated 开头有 Dump 的开头注释, 结尾却没有 dumpCompletedComment 时返回 true;
+// WithNoComments 生成的 dump 和其它工具生成的 SQL 没有开头注释, 无法判断, 返回 false
+func (c *completionReader) truncated() bool {
+	if !bytes.Contains(c.head, []byte(dumpHeaderComment)) {
+		return false
+	}
+	return !bytes.HasSuffix(bytes.TrimRight(c.tail, " \t\r\n"), []byte(dumpCompletedComment))
+}
+
+// transactionControlPrefixes 会提交或开始事务的语句
+var transactionControlPrefixes = []string{"BEGIN", "COMMIT", "ROLLBACK", "START TRANSACTION", "SET AUTOCOMMIT", "LOCK TABLES", "UNLOCK TABLES"}
+
+// isTransactionControl 判断 stmt 是否为会结束当前事务的事务控制或表锁语句
+func isTransactionControl(stmt string) bool {
+	upper := strings.ToUpper(stmt)
+	for _, prefix := range transactionControlPrefixes {
+		if !strings.HasPrefix(upper, prefix) {
+			continue
+		}
+		// 前缀后必须是结束, 空白或 =, 不匹配 BEGIN_xxx 之类的标识符
+		rest := upper[len(prefix):]
+		if rest == "" || isSpaceByte(rest[0]) || rest[0] == '=' || rest[0] == ';' {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeableInsertPrefix 返回 ssql 中到 VALUES 关键字为止的部分, 只有该部分完全相同的 INSERT 才能合并;
+// ssql 不能合并时返回 "". 带 ON DUPLICATE KEY UPDATE 的语句合并后 VALUES 会接在 UPDATE 子句之后, 因此不合并
+func mergeableInsertPrefix(ssql string) string {
+	if !strings.HasPrefix(ssql, "INSERT INTO") || strings.Contains(ssql, " ON DUPLICATE KEY UPDATE ") {
+		return ""
+	}
+	end := findValuesKeyword(ssql)
+	if end < 0 {
+		return ""
+	}
+	return ssql[:end]
 }
 
 /*
-将多个 INSERT 合并为一个
+将多个 INSERT 合并为一个, 各语句到 VALUES 为止的部分必须相同
 输入:
 INSERT INTO `test` VALUES (1, 'a');
 INSERT INTO `test` VALUES (2, 'b');
@@ -172,22 +584,20 @@ func mergeInsert(insertSQLs []string) (string, error) {
 	}
 	builder := strings.Builder{}
 	sql1 := insertSQLs[0]
+	prefix := mergeableInsertPrefix(sql1)
+	if prefix == "" {
+		return "", errors.New("invalid SQL: missing VALUES keyword")
+	}
 	sql1 = strings.TrimSuffix(sql1, ";")
 	builder.WriteString(sql1)
-	for i, insertSQL := range insertSQLs[1:] {
-		if i < len(insertSQLs)-1 {
-			builder.WriteString(",")
-		}
-
-		valuesIdx := strings.Index(insertSQL, "VALUES")
-		if valuesIdx == -1 {
-			return "", errors.New("invalid SQL: missing VALUES keyword")
+	for _, insertSQL := range insertSQLs[1:] {
+		if mergeableInsertPrefix(insertSQL) != prefix {
+			return "", errors.New("invalid SQL: INSERT statements do not share the same target")
 		}
-		sqln := insertSQL[valuesIdx:]
-		sqln = strings.TrimPrefix(sqln, "VALUES")
+		builder.WriteString(",")
+		sqln := insertSQL[len(prefix):]
 		sqln = strings.TrimSuffix(sqln, ";")
 		builder.WriteString(sqln)
-
 	}
 	builder.WriteString(";")
 
@@ -0,0 +1,295 @@
+package mysqldump
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// sourcePool WithSourceParallelism 的并发导入: 每个 worker 使用一个专用连接,
+// 同一个表的 INSERT / REPLACE 总是交给同一个 worker 按顺序执行, 不同的表并发执行;
+// 其它语句 (DDL, SET, UPDATE 等) 是屏障, 等全部 worker 执行完并提交之前的语句后再执行
+type sourcePool struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	o      *sourceOption
+	conns  []*sql.Conn
+	dbs    []*dbWrapper
+	jobs   []chan sourceJob
+	// 表分配到的 worker
+	tables map[string]int
+	// 已分发的语句数, 即下一条语句的序号
+	dispatched int
+	// 是否有已分发但未提交的 INSERT
+	uncommitted bool
+	// 已分发未执行完的语句
+	pending sync.WaitGroup
+	workers sync.WaitGroup
+	closed  bool
+
+	mu     sync.Mutex
+	result *SourceResult
+	// WithForceContinue 时收集的错误
+	stmtErrs []error
+	// 使导入停止的错误
+	err error
+}
+
+type sourceJob struct {
+	index int
+	stmt  string
+}
+
+// sourceJobQueue 每个 worker 排队等待执行的语句数
+const sourceJobQueue = 16
+
+// sessionSetupStatements 每个 worker 连接在导入前执行的语句; 各连接的语句交错执行, 外键检查必须关闭
+var sessionSetupStatements = []string{"SET FOREIGN_KEY_CHECKS=0", "SET autocommit=0"}
+
+func newSourcePool(ctx context.Context, db *sql.DB, dbName string, o *sourceOption, result *SourceResult) (*sourcePool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &sourcePool{ctx: ctx, cancel: cancel, o: o, tables: make(map[string]int), result: result}
+	for i := 0; i < o.parallelism; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			p.abort()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+		p.dbs = append(p.dbs, newDBWrapper(conn, false, o.logger))
+		for _, stmt := range append([]string{"USE " + quoteIdentifier(dbName)}, sessionSetupStatements...) {
+			if _, err := p.dbs[i].ExecContext(ctx, stmt); err != nil {
+				p.abort()
+				return nil, err
+			}
+		}
+	}
+	for i := range p.conns {
+		jobs := make(chan sourceJob, sourceJobQueue)
+		p.jobs = append(p.jobs, jobs)
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range jobs {
+				if p.failed() == nil {
+					p.exec(i, job)
+				}
+				p.pending.Done()
+			}
+		}()
+	}
+	return p, nil
+}
+
+func (p *sourcePool) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// exec 在第 i 个连接上执行一条语句并统计结果
+func (p *sourcePool) exec(i int, job sourceJob) {
+	res, err := p.dbs[i].ExecContext(p.ctx, job.stmt)
+	p.record(job, res, err)
+}
+
+func (p *sourcePool) record(job sourceJob, res sql.Result, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.result.Succeeded++
+		p.result.count(job.stmt, res)
+		return
+	}
+	stmtErr := &StatementError{Index: job.index, Statement: job.stmt, Err: err}
+	p.result.Failed++
+	logStatementError(p.o.logger, stmtErr)
+	// ctx 取消后继续执行也只会失败
+	if !p.o.forceContinue || p.ctx.Err() != nil {
+		if p.err == nil {
+			p.err = stmtErr
+			p.cancel()
+		}
+		return
+	}
+	p.stmtErrs = append(p.stmtErrs, stmtErr)
+}
+
+// executed 返回已执行完的语句数
+func (p *sourcePool) executed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.result.Succeeded + p.result.Failed
+}
+
+// dispatch 分发一条语句; 已有语句失败 (未使用 WithForceContinue) 时返回该错误
+func (p *sourcePool) dispatch(stmt string) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	p.dispatched++
+	job := sourceJob{index: p.dispatched, stmt: stmt}
+	table, ok := insertTable(stmt)
+	if !ok {
+		// 屏障: 之前的语句全部执行完后在调用方的 goroutine 中执行
+		p.pending.Wait()
+		if err := p.failed(); err != nil {
+			return err
+		}
+		if !isSessionStatement(stmt) {
+			if err := p.commit(); err != nil {
+				return err
+			}
+			p.exec(0, job)
+			return p.failed()
+		}
+		// 会话变量在每个连接上设置, 只统计一次
+		for i := range p.dbs {
+			res, err := p.dbs[i].ExecContext(p.ctx, stmt)
+			if err != nil || i == len(p.dbs)-1 {
+				p.record(job, res, err)
+				break
+			}
+		}
+		return p.failed()
+	}
+	worker, ok := p.tables[table]
+	if !ok {
+		worker = len(p.tables) % len(p.jobs)
+		p.tables[table] = worker
+	}
+	p.uncommitted = true
+	p.pending.Add(1)
+	p.jobs[worker] <- job
+	return nil
+}
+
+// commit 在每个连接上提交已执行的 INSERT, 释放表上的元数据锁; 否则连接 0 上的 ALTER TABLE, CREATE TRIGGER 等
+// 会一直等待其它连接的事务持有的锁, 直到 lock_wait_timeout
+func (p *sourcePool) commit() error {
+	if !p.uncommitted {
+		return nil
+	}
+	p.uncommitted = false
+	for _, db := range p.dbs {
+		if _, err := db.ExecContext(p.ctx, "COMMIT"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait 等待已分发的语句全部执行完, 返回使导入停止的错误
+func (p *sourcePool) wait() error {
+	p.pending.Wait()
+	return p.failed()
+}
+
+// finish 在每个连接上提交并恢复 autocommit, 然后释放连接; 返回 WithForceContinue 时收集的错误
+func (p *sourcePool) finish() error {
+	if err := p.wait(); err != nil {
+		p.abort()
+		return err
+	}
+	p.stop()
+	for _, db := range p.dbs {
+		for _, stmt := range []string{"COMMIT", "SET autocommit=1"} {
+			if _, err := db.ExecContext(p.ctx, stmt); err != nil {
+				p.abort()
+				return err
+			}
+		}
+	}
+	p.release()
+	return errors.Join(p.stmtErrs...)
+}
+
+// abort 回滚每个连接上未提交的语句并释放连接, 可重复调用; 屏障语句 (DDL) 已隐式提交的部分不会回滚
+func (p *sourcePool) abort() {
+	p.cancel()
+	p.stop()
+	for _, db := range p.dbs {
+		// ctx 已取消, 回滚不使用 ctx
+		_, _ = db.ExecContext(context.Background(), "ROLLBACK")
+		_, _ = db.ExecContext(context.Background(), "SET autocommit=1")
+	}
+	p.release()
+}
+
+// stop 结束 worker goroutine
+func (p *sourcePool) stop() {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for _, jobs := range p.jobs {
+		close(jobs)
+	}
+	p.workers.Wait()
+}
+
+func (p *sourcePool) release() {
+	for _, conn := range p.conns {
+		_ = conn.Close()
+	}
+	p.conns, p.dbs = nil, nil
+	p.cancel()
+}
+
+// insertTable 返回 INSERT / REPLACE 语句的表名 (原样, 可能带库名), 其它语句返回 false
+func insertTable(stmt string) (string, bool) {
+	i := 0
+	word := func() string {
+		i = skipSpaces(stmt, i)
+		start := i
+		for i < len(stmt) && isIdentifierByte(stmt[i]) {
+			i++
+		}
+		return strings.ToUpper(stmt[start:i])
+	}
+	if keyword := word(); keyword != "INSERT" && keyword != "REPLACE" {
+		return "", false
+	}
+	keyword := word()
+	for keyword == "LOW_PRIORITY" || keyword == "DELAYED" || keyword == "HIGH_PRIORITY" || keyword == "IGNORE" {
+		keyword = word()
+	}
+	if keyword != "INTO" {
+		return "", false
+	}
+	i = skipSpaces(stmt, i)
+	start := i
+	for i < len(stmt) {
+		switch c := stmt[i]; {
+		case c == '`':
+			end := quotedEnd(stmt, i)
+			if end == 0 {
+				return "", false
+			}
+			i = end
+		case c == '.' || isIdentifierByte(c):
+			i++
+		default:
+			return stmt[start:i], i > start
+		}
+	}
+	return "", false
+}
+
+// isSessionStatement 是否为 SET 或 USE 这样只影响当前会话的语句, 包括 /*!40101 SET ... */ 条件注释
+func isSessionStatement(stmt string) bool {
+	s := stmt
+	if strings.HasPrefix(s, "/*!") {
+		s = strings.TrimLeft(s[len("/*!"):], "0123456789")
+		s = s[skipSpaces(s, 0):]
+	}
+	upper := strings.ToUpper(s)
+	for _, keyword := range []string{"SET", "USE"} {
+		if strings.HasPrefix(upper, keyword) && len(upper) > len(keyword) && isSpaceByte(upper[len(keyword)]) {
+			return true
+		}
+	}
+	return false
+}
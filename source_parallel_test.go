@@ -0,0 +1,196 @@
+package mysqldump
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_insertTable(t *testing.T) {
+	tests := []struct {
+		stmt   string
+		want   string
+		wantOK bool
+	}{
+		{stmt: "INSERT INTO `t` VALUES (1)", want: "`t`", wantOK: true},
+		{stmt: "insert ignore into `a b` (`id`) VALUES (1)", want: "`a b`", wantOK: true},
+		{stmt: "REPLACE LOW_PRIORITY INTO `db`.`t``x` VALUES (1)", want: "`db`.`t``x`", wantOK: true},
+		{stmt: "INSERT INTO users(id) VALUES (1)", want: "users", wantOK: true},
+		{stmt: "UPDATE `t` SET a = 1"},
+		{stmt: "INSERT `t` VALUES (1)"},
+		{stmt: "CREATE TABLE `t` (`id` int)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			got, ok := insertTable(tt.stmt)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("insertTable() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func Test_isSessionStatement(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want bool
+	}{
+		{stmt: "SET NAMES utf8mb4", want: true},
+		{stmt: "set\tFOREIGN_KEY_CHECKS=0", want: true},
+		{stmt: "/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE */", want: true},
+		{stmt: "USE `test`", want: true},
+		{stmt: "SETTINGS"},
+		{stmt: "CREATE TABLE `t` (`id` int)"},
+		{stmt: "/*!50003 CREATE PROCEDURE p() BEGIN END */"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			if got := isSessionStatement(tt.stmt); got != tt.want {
+				t.Errorf("isSessionStatement() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// parallelDump 返回 tables 个表, 每个表 rows 条 INSERT 的 dump, 最后是一条 ALTER
+func parallelDump(tables, rows int) string {
+	var b strings.Builder
+	b.WriteString("SET NAMES utf8mb4;\nSET FOREIGN_KEY_CHECKS=0;\nSET AUTOCOMMIT=0;\n")
+	for i := 0; i < tables; i++ {
+		fmt.Fprintf(&b, "CREATE TABLE `t%d` (`id` int);\nLOCK TABLES `t%d` WRITE;\n", i, i)
+	}
+	for r := 0; r < rows; r++ {
+		for i := 0; i < tables; i++ {
+			fmt.Fprintf(&b, "INSERT INTO `t%d` VALUES (%d);\n", i, r)
+		}
+	}
+	// t1 的 INSERT 在第二个连接上执行
+	b.WriteString("UNLOCK TABLES;\nALTER TABLE `t0` ADD INDEX `i` (`id`);\nCREATE TRIGGER `t1_bi` BEFORE INSERT ON `t1` FOR EACH ROW SET @x = 1;\nCOMMIT;\n")
+	return b.String()
+}
+
+func Test_sourceParallel(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	result, err := SourceWithResult(db, "test", strings.NewReader(parallelDump(3, 20)), WithSourceParallelism(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DML != 60 || result.DDL != 5 {
+		t.Errorf("DML = %d, DDL = %d, want 60, 5", result.DML, result.DDL)
+	}
+	executed := connector.committed
+	count := func(stmt string) int {
+		n := 0
+		for _, s := range executed {
+			if s == stmt {
+				n++
+			}
+		}
+		return n
+	}
+	// 每个连接都设置会话变量并各自提交
+	for _, stmt := range []string{"USE `test`", "SET NAMES utf8mb4", "SET autocommit=1"} {
+		if n := count(stmt); n != 2 {
+			t.Errorf("%q executed %d times, want 2", stmt, n)
+		}
+	}
+	// 第一条 DDL 之前和结束时每个连接各提交一次, 其它连接的事务不再持有 t1 的元数据锁
+	if n := count("COMMIT"); n != 4 {
+		t.Errorf("COMMIT executed %d times, want 4", n)
+	}
+	for _, ddl := range []string{"ALTER TABLE `t0` ADD INDEX `i` (`id`)", "CREATE TRIGGER `t1_bi` BEFORE INSERT ON `t1` FOR EACH ROW SET @x = 1"} {
+		pos := slices.Index(executed, ddl)
+		if pos < 0 {
+			t.Fatalf("%q not executed", ddl)
+		}
+		if commits := slices.DeleteFunc(slices.Clone(executed[:pos]), func(s string) bool { return s != "COMMIT" }); len(commits) != 2 {
+			t.Errorf("%d COMMIT before %q, want 2", len(commits), ddl)
+		}
+	}
+	// 连接建立时和 dump 中各一次
+	if n := count("SET FOREIGN_KEY_CHECKS=0"); n != 4 {
+		t.Errorf("SET FOREIGN_KEY_CHECKS=0 executed %d times, want 4", n)
+	}
+	for _, stmt := range []string{"LOCK TABLES `t0` WRITE", "UNLOCK TABLES", "SET AUTOCOMMIT=0"} {
+		if n := count(stmt); n != 0 {
+			t.Errorf("%q executed %d times, want 0", stmt, n)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		create := slices.Index(executed, fmt.Sprintf("CREATE TABLE `t%d` (`id` int)", i))
+		alter := slices.Index(executed, "ALTER TABLE `t0` ADD INDEX `i` (`id`)")
+		last := create
+		for r := 0; r < 20; r++ {
+			pos := slices.Index(executed, fmt.Sprintf("INSERT INTO `t%d` VALUES (%d)", i, r))
+			if pos <= last {
+				t.Fatalf("INSERT %d of t%d at %d, want after %d", r, i, pos, last)
+			}
+			last = pos
+		}
+		if alter < last {
+			t.Errorf("ALTER at %d before the last INSERT of t%d at %d", alter, i, last)
+		}
+	}
+}
+
+func Test_sourceParallelErrors(t *testing.T) {
+	input := "CREATE TABLE `a` (`id` int);\nCREATE TABLE `b` (`id` int);\n" +
+		"INSERT INTO `a` VALUES (1);\nINSERT INTO `b` VALUES (boom);\nINSERT INTO `a` VALUES (2);\n"
+
+	t.Run("stops on error", func(t *testing.T) {
+		connector := &fakeConnector{}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+		_, err := SourceWithResult(db, "test", strings.NewReader(input), WithSourceParallelism(2))
+		var stmtErr *StatementError
+		if !errors.As(err, &stmtErr) || stmtErr.Index != 4 {
+			t.Fatalf("error = %v, want *StatementError for statement #4", err)
+		}
+		if slices.Contains(connector.committed, "COMMIT") {
+			t.Errorf("committed after error: %q", connector.committed)
+		}
+	})
+
+	t.Run("force continue", func(t *testing.T) {
+		connector := &fakeConnector{}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+		result, err := SourceWithResult(db, "test", strings.NewReader(input), WithSourceParallelism(2), WithForceContinue())
+		if err == nil || result.Failed != 1 || result.DML != 2 {
+			t.Errorf("got %+v, %v, want 1 failed and 2 DML", result, err)
+		}
+	})
+
+	t.Run("with transaction", func(t *testing.T) {
+		db := sql.OpenDB(&fakeConnector{})
+		defer db.Close()
+		if err := Source(db, "test", strings.NewReader(input), WithSourceParallelism(2), WithSourceTransaction()); err == nil {
+			t.Error("error = nil, want error")
+		}
+	})
+}
+
+func BenchmarkSource(b *testing.B) {
+	input := parallelDump(8, 50)
+	for _, parallelism := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism=%d", parallelism), func(b *testing.B) {
+			// 模拟每条语句 100µs 的服务器往返
+			connector := &fakeConnector{execDelay: 100 * time.Microsecond}
+			db := sql.OpenDB(connector)
+			defer db.Close()
+			for i := 0; i < b.N; i++ {
+				connector.committed = nil
+				if err := Source(db, "test", strings.NewReader(input), WithSourceParallelism(parallelism)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,20 @@
 package mysqldump
 
-import "testing"
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
 func Test_mergeInsert(t *testing.T) {
 	type args struct {
@@ -22,6 +36,26 @@ func Test_mergeInsert(t *testing.T) {
 			want:    "INSERT INTO `test` VALUES (1, 'a'), (2, 'b');",
 			wantErr: false,
 		},
+		{
+			name: "VALUES inside a name",
+			args: args{
+				insertSQLs: []string{
+					"INSERT INTO `ORDER_VALUES` (`VALUES`) VALUES (1);",
+					"INSERT INTO `ORDER_VALUES` (`VALUES`) VALUES (2);",
+				},
+			},
+			want: "INSERT INTO `ORDER_VALUES` (`VALUES`) VALUES (1), (2);",
+		},
+		{
+			name: "different tables",
+			args: args{
+				insertSQLs: []string{
+					"INSERT INTO `a` VALUES (1);",
+					"INSERT INTO `b` VALUES (2);",
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -36,3 +70,446 @@ func Test_mergeInsert(t *testing.T) {
 		})
 	}
 }
+
+func Test_statementReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "simple statements",
+			input: "SET FOREIGN_KEY_CHECKS=0;\n\nINSERT INTO `t` VALUES (1);\n",
+			want:  []string{"SET FOREIGN_KEY_CHECKS=0", "INSERT INTO `t` VALUES (1)"},
+		},
+		{
+			name:  "leading comments dropped",
+			input: "-- ----------------------------\n-- Records of t\n-- ----------------------------\nINSERT INTO `t` VALUES (1);",
+			want:  []string{"INSERT INTO `t` VALUES (1)"},
+		},
+		{
+			name:  "semicolons in strings and identifiers",
+			input: "INSERT INTO `a;b` VALUES ('x;y',\"p;q\",'it\\'s;');SELECT 'a''b;c';",
+			want:  []string{"INSERT INTO `a;b` VALUES ('x;y',\"p;q\",'it\\'s;')", "SELECT 'a''b;c'"},
+		},
+		{
+			name:  "comments containing semicolons and quotes",
+			input: "SELECT 1 /* ; ' */ FROM t -- it's; here\n WHERE a = 1; # done; '\nSELECT 2;",
+			want:  []string{"SELECT 1 /* ; ' */ FROM t -- it's; here\n WHERE a = 1", "SELECT 2"},
+		},
+		{
+			name:  "double dash without space is not a comment",
+			input: "SELECT 1--1;",
+			want:  []string{"SELECT 1--1"},
+		},
+		{
+			name:  "conditional comment is executed",
+			input: "/*!40101 SET NAMES utf8mb4 */;\n",
+			want:  []string{"/*!40101 SET NAMES utf8mb4 */"},
+		},
+		{
+			name: "procedure body with delimiter",
+			input: "DROP PROCEDURE IF EXISTS `p`;\n" +
+				"DELIMITER $$\n" +
+				"CREATE PROCEDURE `p`()\nBEGIN\n  DECLARE x INT DEFAULT 1;\n  SELECT ';' INTO @s;\n  SET x = x + 1;\nEND$$\n" +
+				"DELIMITER ;\n\n" +
+				"SELECT 1;\n",
+			want: []string{
+				"DROP PROCEDURE IF EXISTS `p`",
+				"CREATE PROCEDURE `p`()\nBEGIN\n  DECLARE x INT DEFAULT 1;\n  SELECT ';' INTO @s;\n  SET x = x + 1;\nEND",
+				"SELECT 1",
+			},
+		},
+		{
+			name:  "last statement without delimiter",
+			input: "SELECT 1;\nSELECT 2\n",
+			want:  []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:  "only comments and empty statements",
+			input: "-- nothing\n;;\n/* here */\n",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newStatementReader(strings.NewReader(tt.input))
+			var got []string
+			for {
+				stmt, err := r.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("statementReader.next() error = %v", err)
+				}
+				got = append(got, stmt)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statementReader.next() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeConnector 记录执行的语句, 事务提交后才写入 committed, 包含 "boom" 的语句执行失败;
+// 查询返回 rows 的结果, 并记录查询的参数和打开的连接数; 每条语句执行 execDelay, 模拟网络往返
+type fakeConnector struct {
+	committed []string
+	rows      func(query string) (columns []string, values [][]driver.Value)
+	queryArgs [][]any
+	connects  int
+	execDelay time.Duration
+	// 多个连接并发执行时保护以上字段
+	mu sync.Mutex
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connects++
+	return &fakeConn{connector: c, id: c.connects}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+	// 连接序号, 从 1 开始
+	id int
+	// 事务中未提交的语句
+	pending []string
+	inTx    bool
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.inTx = true
+	return c, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if strings.Contains(query, "boom") {
+		return nil, errors.New("syntax error near boom")
+	}
+	time.Sleep(c.connector.execDelay)
+	if c.inTx {
+		c.pending = append(c.pending, query)
+	} else {
+		c.connector.mu.Lock()
+		c.connector.committed = append(c.connector.committed, query)
+		c.connector.mu.Unlock()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.connector.rows == nil {
+		return nil, errors.New("no rows for " + query)
+	}
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	c.connector.mu.Lock()
+	c.connector.queryArgs = append(c.connector.queryArgs, values)
+	c.connector.mu.Unlock()
+	columns, rows := c.connector.rows(query)
+	return &fakeRows{columns: columns, values: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	// 第一个值为 error 的行在读取时返回该错误
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	if err, ok := r.values[0][0].(error); ok {
+		return err
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.connector.mu.Lock()
+	defer c.connector.mu.Unlock()
+	c.connector.committed = append(c.connector.committed, c.pending...)
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+func Test_sourceTransaction(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		wantErr       bool
+		wantCommitted []string
+	}{
+		{
+			name:    "failure mid-stream rolls back",
+			input:   "LOCK TABLES `t` WRITE;\nINSERT INTO `t` VALUES (1);\nINSERT INTO `t` VALUES (boom);\nINSERT INTO `t` VALUES (3);\nUNLOCK TABLES;\n",
+			wantErr: true,
+		},
+		{
+			name:          "success commits without transaction control statements",
+			input:         "SET AUTOCOMMIT=0;\nSTART TRANSACTION;\nLOCK TABLES `t` WRITE;\nINSERT INTO `t` VALUES (1);\nUNLOCK TABLES;\nCOMMIT;\n",
+			wantCommitted: []string{"USE `test`", "INSERT INTO `t` VALUES (1)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := &fakeConnector{}
+			db := sql.OpenDB(connector)
+			defer db.Close()
+			db.SetMaxOpenConns(1)
+
+			err := Source(db, "test", strings.NewReader(tt.input), WithSourceTransaction())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Source() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(connector.committed, tt.wantCommitted) {
+				t.Errorf("committed = %q, want %q", connector.committed, tt.wantCommitted)
+			}
+		})
+	}
+}
+
+func Test_sourceMergeUpsert(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []DumpOption
+		want []string
+	}{
+		{
+			name: "plain inserts are merged",
+			want: []string{"INSERT INTO `t` (`id`,`v`) VALUES ('1','a'), ('2','b'), ('3','c');"},
+		},
+		{
+			name: "upserts are not merged",
+			opts: []DumpOption{WithUpsert()},
+			want: []string{
+				"INSERT INTO `t` (`id`,`v`) VALUES ('1','a') ON DUPLICATE KEY UPDATE `v`=VALUES(`v`)",
+				"INSERT INTO `t` (`id`,`v`) VALUES ('2','b') ON DUPLICATE KEY UPDATE `v`=VALUES(`v`)",
+				"INSERT INTO `t` (`id`,`v`) VALUES ('3','c') ON DUPLICATE KEY UPDATE `v`=VALUES(`v`)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := &dumpFixture{
+				tables:  []string{"t"},
+				columns: [][]driver.Value{{"id", "", "int", "", nil}, {"v", "", "varchar(20)", "", "utf8mb4"}},
+				data: func(string) ([]string, [][]driver.Value) {
+					return []string{"id", "v"}, [][]driver.Value{{"1", "a"}, {"2", "b"}, {"3", "c"}}
+				},
+				query: primaryKeyQuery("id"),
+			}
+			db := sql.OpenDB(fixture.connector())
+			defer db.Close()
+			var b strings.Builder
+			opts := append([]DumpOption{WithData(), WithInsertBatchSize(1), WithWriter(&b)}, tt.opts...)
+			if err := Dump(db, "test", opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			target := &fakeConnector{}
+			targetDB := sql.OpenDB(target)
+			defer targetDB.Close()
+			if err := Source(targetDB, "test", strings.NewReader(b.String()), WithMergeInsert(10)); err != nil {
+				t.Fatal(err)
+			}
+			got := slices.DeleteFunc(slices.Clone(target.committed), func(stmt string) bool {
+				return !strings.HasPrefix(stmt, "INSERT INTO")
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("executed inserts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sourceMergeAdjacentTables(t *testing.T) {
+	db := sql.OpenDB(tableDumpConnector(testRows(2), nil))
+	defer db.Close()
+	var b strings.Builder
+	// 没有 LOCK TABLES, 建表语句和注释时各表的 INSERT 紧挨在一起
+	err := Dump(db, "test", WithAllTable(), WithData(), WithNoCreateInfo(), WithoutLockTables(), WithNoComments(),
+		WithInsertBatchSize(1), WithWriter(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := &fakeConnector{}
+	targetDB := sql.OpenDB(target)
+	defer targetDB.Close()
+	if err := Source(targetDB, "test", strings.NewReader(b.String()), WithMergeInsert(10)); err != nil {
+		t.Fatal(err)
+	}
+	got := slices.DeleteFunc(slices.Clone(target.committed), func(stmt string) bool {
+		return !strings.HasPrefix(stmt, "INSERT INTO")
+	})
+	var want []string
+	for _, table := range []string{"t1", "t2", "t3"} {
+		want = append(want, "INSERT INTO `"+table+"` (`id`,`v`) VALUES ('0','xxxxxxxxxxxxxxxxxxxx'), ('1','xxxxxxxxxxxxxxxxxxxx');")
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("executed inserts = %q, want %q", got, want)
+	}
+}
+
+func Test_isTransactionControl(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want bool
+	}{
+		{stmt: "COMMIT", want: true},
+		{stmt: "start transaction", want: true},
+		{stmt: "SET autocommit=0", want: true},
+		{stmt: "LOCK TABLES `t` WRITE", want: true},
+		{stmt: "UNLOCK TABLES", want: true},
+		{stmt: "BEGIN", want: true},
+		{stmt: "INSERT INTO `t` VALUES (1)"},
+		{stmt: "SET FOREIGN_KEY_CHECKS=0"},
+		{stmt: "COMMITTED_ROWS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			if got := isTransactionControl(tt.stmt); got != tt.want {
+				t.Errorf("isTransactionControl(%q) = %v, want %v", tt.stmt, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sourceGzip(t *testing.T) {
+	dump := "SET NAMES utf8mb4;\n\nINSERT INTO `t` VALUES (1);\n"
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte(dump))
+	_ = gz.Close()
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "plain", input: []byte(dump)},
+		{name: "gzip", input: gzipped.Bytes()},
+	}
+	want := []string{"USE `test`", "SET autocommit=0;", "SET NAMES utf8mb4", "INSERT INTO `t` VALUES (1)", "COMMIT;", "SET autocommit=1;"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := &fakeConnector{}
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			err := Source(db, "test", bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Source() error = %v", err)
+			}
+			if !reflect.DeepEqual(connector.committed, want) {
+				t.Errorf("executed = %q, want %q", connector.committed, want)
+			}
+		})
+	}
+}
+
+func Test_classifyStatement(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want int
+	}{
+		{stmt: "CREATE TABLE `t` (`id` int)", want: statementDDL},
+		{stmt: "drop table if exists `t`", want: statementDDL},
+		{stmt: "ALTER TABLE `t`\n  ADD KEY `a` (`a`)", want: statementDDL},
+		{stmt: "INSERT INTO `t` VALUES (1)", want: statementDML},
+		{stmt: "REPLACE INTO `t` VALUES (1)", want: statementDML},
+		{stmt: "SET NAMES utf8mb4", want: statementOther},
+		{stmt: "/*!40000 ALTER TABLE `t` DISABLE KEYS */", want: statementOther},
+		{stmt: "INSERTED", want: statementOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			if got := classifyStatement(tt.stmt); got != tt.want {
+				t.Errorf("classifyStatement(%q) = %v, want %v", tt.stmt, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sourceResultCounts(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	dump := "SET NAMES utf8mb4;\nDROP TABLE IF EXISTS `t`;\nCREATE TABLE `t` (`id` int);\nINSERT INTO `t` VALUES (1),(2);\nINSERT INTO `t` VALUES (3);\n"
+	result, err := SourceWithResult(db, "test", strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("SourceWithResult() error = %v", err)
+	}
+	// fakeConn 每条语句影响 1 行
+	want := SourceResult{Succeeded: 5, DDL: 2, DML: 2, Other: 1, RowsAffected: 5}
+	result.Duration = 0
+	if *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+}
+
+func Test_sourceLongStatement(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "larger than bufio.Scanner default", size: 64<<10 + 1},
+		{name: "multi-megabyte", size: 8 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 值中包含分隔符和换行的转义, 整条语句在一行
+			value := strings.Repeat("abc;\\n", tt.size/6+1)
+			insert := "INSERT INTO `t` VALUES (1,'" + value + "'),(2,'x')"
+			input := "-- header\n" + insert + ";\nINSERT INTO `t` VALUES (3,'y');\n"
+
+			connector := &fakeConnector{}
+			db := sql.OpenDB(connector)
+			defer db.Close()
+			result, err := SourceWithResult(db, "test", strings.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Succeeded != 2 {
+				t.Errorf("Succeeded = %d, want 2", result.Succeeded)
+			}
+			if !slices.Contains(connector.committed, insert) {
+				t.Errorf("long INSERT of %d bytes was not executed intact", len(insert))
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package mysqldump
+
+import (
+	"strings"
+)
+
+// splitInsert 将超过 maxBytes 的 INSERT / REPLACE ... VALUES 按行拆成多条语句, 每条都不超过 maxBytes,
+// 单行本身超过 maxBytes 时单独成一条; ON DUPLICATE KEY UPDATE 等 VALUES 之后的部分写入每一条.
+// 不是多行 VALUES 的语句 (如 INSERT ... SELECT) 返回 nil
+func splitInsert(stmt string, maxBytes int) []string {
+	upper := strings.ToUpper(stmt)
+	if !strings.HasPrefix(upper, "INSERT") && !strings.HasPrefix(upper, "REPLACE") {
+		return nil
+	}
+	valuesEnd := findValuesKeyword(stmt)
+	if valuesEnd < 0 {
+		return nil
+	}
+	head := strings.TrimRight(stmt[:valuesEnd], " \t\r\n") + " "
+
+	// 每一行的 (...) 在 stmt 中的位置
+	var tuples [][2]int
+	i := valuesEnd
+	for {
+		i = skipSpaces(stmt, i)
+		if i >= len(stmt) || stmt[i] != '(' {
+			return nil
+		}
+		end := tupleEnd(stmt, i)
+		if end < 0 {
+			return nil
+		}
+		tuples = append(tuples, [2]int{i, end})
+		i = skipSpaces(stmt, end)
+		if i >= len(stmt) || stmt[i] != ',' {
+			break
+		}
+		i++
+	}
+	suffix := stmt[tuples[len(tuples)-1][1]:]
+	if len(tuples) < 2 {
+		return nil
+	}
+
+	var stmts []string
+	var b strings.Builder
+	rows := 0
+	flush := func() {
+		b.WriteString(suffix)
+		stmts = append(stmts, b.String())
+		b.Reset()
+		rows = 0
+	}
+	for _, t := range tuples {
+		tuple := stmt[t[0]:t[1]]
+		if rows > 0 && b.Len()+1+len(tuple)+len(suffix) > maxBytes {
+			flush()
+		}
+		if rows == 0 {
+			b.Grow(min(maxBytes, len(stmt)))
+			b.WriteString(head)
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tuple)
+		rows++
+	}
+	flush()
+	return stmts
+}
+
+// findValuesKeyword 返回引号和括号之外的 VALUES (或 VALUE) 关键字之后的位置, 没有时返回 -1
+func findValuesKeyword(stmt string) int {
+	depth := 0
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(stmt, i) - 1
+			if i < 0 {
+				return -1
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (c == 'V' || c == 'v') && (i == 0 || !isIdentifierByte(stmt[i-1])):
+			for _, keyword := range []string{"VALUES", "VALUE"} {
+				end := i + len(keyword)
+				if end <= len(stmt) && strings.EqualFold(stmt[i:end], keyword) && (end == len(stmt) || !isIdentifierByte(stmt[end])) {
+					return end
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// tupleEnd 返回从 stmt[start] 的 '(' 开始到匹配的 ')' 之后的位置, 括号不完整时返回 -1
+func tupleEnd(stmt string, start int) int {
+	depth := 0
+	for i := start; i < len(stmt); i++ {
+		switch stmt[i] {
+		case '\'', '"', '`':
+			i = quotedEnd(stmt, i) - 1
+			if i < 0 {
+				return -1
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// quotedEnd 返回从 stmt[start] 的引号开始到结束引号之后的位置, 处理反斜杠转义和连写的引号; 没有结束引号时返回 0
+func quotedEnd(stmt string, start int) int {
+	quote := stmt[start]
+	for i := start + 1; i < len(stmt); i++ {
+		c := stmt[i]
+		if c == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if c == quote {
+			// '' 表示一个引号
+			if i+1 < len(stmt) && stmt[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && isSpaceByte(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isIdentifierByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
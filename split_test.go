@@ -0,0 +1,104 @@
+package mysqldump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_splitInsert(t *testing.T) {
+	tests := []struct {
+		name     string
+		stmt     string
+		maxBytes int
+		want     []string
+	}{
+		{
+			name:     "two rows per statement",
+			stmt:     "INSERT INTO `t` VALUES (1,'a'),(2,'b'),(3,'c')",
+			maxBytes: 38,
+			want:     []string{"INSERT INTO `t` VALUES (1,'a'),(2,'b')", "INSERT INTO `t` VALUES (3,'c')"},
+		},
+		{
+			name:     "quotes, parentheses and escapes in values",
+			stmt:     "INSERT INTO `t` (`a`,`VALUES`) VALUES ('x),(y','it\\'s'),(POINT(1,2),'a''b'),(\"q\",NULL)",
+			maxBytes: 10,
+			want: []string{
+				"INSERT INTO `t` (`a`,`VALUES`) VALUES ('x),(y','it\\'s')",
+				"INSERT INTO `t` (`a`,`VALUES`) VALUES (POINT(1,2),'a''b')",
+				"INSERT INTO `t` (`a`,`VALUES`) VALUES (\"q\",NULL)",
+			},
+		},
+		{
+			name:     "upsert suffix repeated",
+			stmt:     "insert into `t` (`id`,`a`) values (1,'x'), (2,'y') ON DUPLICATE KEY UPDATE `a`=VALUES(`a`);",
+			maxBytes: 10,
+			want: []string{
+				"insert into `t` (`id`,`a`) values (1,'x') ON DUPLICATE KEY UPDATE `a`=VALUES(`a`);",
+				"insert into `t` (`id`,`a`) values (2,'y') ON DUPLICATE KEY UPDATE `a`=VALUES(`a`);",
+			},
+		},
+		{
+			name:     "insert select",
+			stmt:     "INSERT INTO `t` SELECT * FROM `s`",
+			maxBytes: 10,
+		},
+		{
+			name:     "single row",
+			stmt:     "INSERT INTO `t` VALUES (1)",
+			maxBytes: 10,
+		},
+		{
+			name:     "not insert",
+			stmt:     "UPDATE `t` SET `a` = 1",
+			maxBytes: 10,
+		},
+		{
+			name:     "unterminated quote",
+			stmt:     "INSERT INTO `t` VALUES ('a),('b)",
+			maxBytes: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitInsert(tt.stmt, tt.maxBytes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitInsert() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitInsertLarge(t *testing.T) {
+	// 64MB 的多行 INSERT, 按 1MB 拆分
+	const size = 64 << 20
+	const maxBytes = 1 << 20
+	row := "(12345,'" + strings.Repeat("x", 1000) + "')"
+	var b strings.Builder
+	b.WriteString("INSERT INTO `t` VALUES ")
+	rows := 0
+	for b.Len() < size {
+		if rows > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(row)
+		rows++
+	}
+
+	stmts := splitInsert(b.String(), maxBytes)
+	if len(stmts) < size/maxBytes {
+		t.Fatalf("split into %d statements, want at least %d", len(stmts), size/maxBytes)
+	}
+	total := 0
+	for _, stmt := range stmts {
+		if len(stmt) > maxBytes {
+			t.Fatalf("statement of %d bytes exceeds %d", len(stmt), maxBytes)
+		}
+		if !strings.HasPrefix(stmt, "INSERT INTO `t` VALUES (") || !strings.HasSuffix(stmt, "')") {
+			t.Fatalf("malformed statement %q...", stmt[:40])
+		}
+		total += strings.Count(stmt, row)
+	}
+	if total != rows {
+		t.Errorf("split statements contain %d rows, want %d", total, rows)
+	}
+}
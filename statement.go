@@ -0,0 +1,215 @@
+package mysqldump
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+// 语句扫描状态
+const (
+	scanNormal = iota
+	// 单引号, 双引号或反引号中
+	scanQuoted
+	scanLineComment
+	scanBlockComment
+)
+
+// statementReader 从 SQL 文件中逐条读取语句, 与 mysql 客户端一样处理
+// DELIMITER 指令, 引号和反引号中的分隔符, 以及 -- # /* */ 注释.
+// 逐字节扫描到可增长的缓冲区, 语句和行的长度没有限制 (不像 bufio.Scanner 默认限制 64KB)
+type statementReader struct {
+	r         *bufio.Reader
+	delimiter string
+	// 被 unread 退回的语句
+	pushback []string
+	// 已读取的字节数
+	offset int64
+}
+
+func newStatementReader(reader io.Reader) *statementReader {
+	return &statementReader{
+		r:         bufio.NewReader(reader),
+		delimiter: ";",
+	}
+}
+
+// unread 退回一条语句, 下次 next 时返回
+func (sr *statementReader) unread(stmt string) {
+	sr.pushback = append(sr.pushback, stmt)
+}
+
+// next 返回下一条语句, 不含分隔符, 语句前的注释被丢弃;
+// 没有更多语句时返回 io.EOF, 文件末尾缺少分隔符的语句也会返回
+// 禁止 golangci-lint 检查
+// nolint: gocyclo
+func (sr *statementReader) next() (string, error) {
+	if n := len(sr.pushback); n > 0 {
+		stmt := sr.pushback[n-1]
+		sr.pushback = sr.pushback[:n-1]
+		return stmt, nil
+	}
+
+	var stmt []byte
+	state := scanNormal
+	// 当前引号或反引号
+	var quote byte
+	// 块注释中的上一个字节
+	var prev byte
+	// 语句是否已经开始, 开始前的空白和注释不写入 stmt
+	started := false
+	for {
+		c, err := sr.readByte()
+		if err == io.EOF {
+			if started {
+				return trim(string(stmt)), nil
+			}
+			return "", io.EOF
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch state {
+		case scanQuoted:
+			stmt = append(stmt, c)
+			if c == '\\' && quote != '`' {
+				// 转义字符, 下一个字节原样保留
+				if escaped, err := sr.readByte(); err == nil {
+					stmt = append(stmt, escaped)
+				}
+			} else if c == quote {
+				state = scanNormal
+			}
+			continue
+		case scanLineComment:
+			if started {
+				stmt = append(stmt, c)
+			}
+			if c == '\n' {
+				state = scanNormal
+			}
+			continue
+		case scanBlockComment:
+			if started {
+				stmt = append(stmt, c)
+			}
+			if c == '/' && prev == '*' {
+				state = scanNormal
+			}
+			prev = c
+			continue
+		}
+
+		if !started {
+			if isSpaceByte(c) {
+				continue
+			}
+			if (c == 'D' || c == 'd') && sr.isDelimiterCommand() {
+				err = sr.readDelimiterCommand()
+				if err != nil {
+					return "", err
+				}
+				continue
+			}
+		}
+
+		switch {
+		case c == '#' || c == '-' && sr.isLineCommentStart():
+			state = scanLineComment
+			if started {
+				stmt = append(stmt, c)
+			}
+			continue
+		case c == '/' && sr.peekByte() == '*':
+			_, _ = sr.readByte()
+			state = scanBlockComment
+			prev = 0
+			// /*! ... */ 是会被执行的条件注释, 属于语句的一部分
+			if sr.peekByte() == '!' {
+				started = true
+			}
+			if started {
+				stmt = append(stmt, '/', '*')
+			}
+			continue
+		}
+
+		started = true
+		stmt = append(stmt, c)
+		if c == '\'' || c == '"' || c == '`' {
+			state = scanQuoted
+			quote = c
+			continue
+		}
+		if bytes.HasSuffix(stmt, []byte(sr.delimiter)) {
+			s := trim(string(stmt[:len(stmt)-len(sr.delimiter)]))
+			if s == "" {
+				// 只有分隔符的空语句
+				stmt = stmt[:0]
+				started = false
+				continue
+			}
+			return s, nil
+		}
+	}
+}
+
+func (sr *statementReader) readByte() (byte, error) {
+	c, err := sr.r.ReadByte()
+	if err == nil {
+		sr.offset++
+	}
+	return c, err
+}
+
+func (sr *statementReader) peekByte() byte {
+	b, err := sr.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+// isLineCommentStart 当前字节为 '-' 时, 判断是否为 "-- " 注释, MySQL 要求 -- 后跟空白或控制字符
+func (sr *statementReader) isLineCommentStart() bool {
+	b, err := sr.r.Peek(2)
+	if len(b) == 0 || b[0] != '-' {
+		return false
+	}
+	if len(b) == 1 {
+		return err != nil
+	}
+	return b[1] <= ' '
+}
+
+// isDelimiterCommand 当前字节为 'D' 时, 判断是否为 DELIMITER 指令
+func (sr *statementReader) isDelimiterCommand() bool {
+	const rest = "ELIMITER"
+	b, _ := sr.r.Peek(len(rest) + 1)
+	if len(b) < len(rest)+1 {
+		return false
+	}
+	return strings.EqualFold(string(b[:len(rest)]), rest) && isSpaceByte(b[len(rest)])
+}
+
+// readDelimiterCommand 读取 DELIMITER 指令所在的行并设置新的分隔符
+func (sr *statementReader) readDelimiterCommand() error {
+	line, err := sr.r.ReadString('\n')
+	sr.offset += int64(len(line))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	fields := strings.Fields(line[len("ELIMITER"):])
+	if len(fields) == 0 {
+		return errors.New("DELIMITER must be followed by a delimiter")
+	}
+	sr.delimiter = fields[0]
+	return nil
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,88 @@
+package mysqldump
+
+import (
+	"fmt"
+	"time"
+)
+
+// temporalValue 接收 DATE, DATETIME 和 TIMESTAMP 列的值. DSN 中使用 parseTime=true 时驱动返回 time.Time,
+// database/sql 会把它格式化为 RFC 3339, 丢失精度且不能导入 DATETIME 列; 这里按列的小数秒位数
+// 格式化为 MySQL 的文本形式, 与 parseTime=false 时服务器返回的文本相同
+type temporalValue struct {
+	// DATE 列只有日期
+	date bool
+	// 小数秒位数, 0~6
+	fsp int
+	// 在各行之间复用, 非 nil
+	buf []byte
+	// 当前值, NULL 为 nil
+	value []byte
+	// 零日期替换为 zeroReplacement, nil 表示 NULL
+	replaceZero     bool
+	zeroReplacement []byte
+}
+
+func newTemporalValue(typeName string, fsp int) *temporalValue {
+	if fsp < 0 || fsp > 6 {
+		fsp = 0
+	}
+	return &temporalValue{date: typeName == "DATE", fsp: fsp, buf: []byte{}}
+}
+
+func (v *temporalValue) Scan(src any) error {
+	switch s := src.(type) {
+	case nil:
+		v.value = nil
+		return nil
+	case []byte:
+		v.value = append(v.buf[:0], s...)
+	case string:
+		v.value = append(v.buf[:0], s...)
+	case time.Time:
+		v.value = appendTemporal(v.buf[:0], s, v.date, v.fsp)
+	default:
+		return fmt.Errorf("unsupported %T value for temporal column", src)
+	}
+	v.buf = v.value
+	if v.replaceZero && isZeroDate(v.value) {
+		v.value = v.zeroReplacement
+	}
+	return nil
+}
+
+// isZeroDate 判断 value 是否为全零的日期或时间, 如 0000-00-00 和 0000-00-00 00:00:00.000
+func isZeroDate(value []byte) bool {
+	if len(value) < len("0000-00-00") {
+		return false
+	}
+	for _, c := range value {
+		switch c {
+		case '0', '-', ':', ' ', '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+const dateTimeLayout = "2006-01-02 15:04:05.000000"
+
+// appendTemporal 以 MySQL 的文本形式写入 t; 驱动把 0000-00-00 解析为 time.Time 零值, 还原为零日期
+func appendTemporal(dst []byte, t time.Time, date bool, fsp int) []byte {
+	layout := dateTimeLayout[:19]
+	if date {
+		layout = dateTimeLayout[:10]
+	} else if fsp > 0 {
+		layout = dateTimeLayout[:20+fsp]
+	}
+	if t.IsZero() {
+		zero := []byte(layout)
+		for i, c := range zero {
+			if c >= '0' && c <= '9' {
+				zero[i] = '0'
+			}
+		}
+		return append(dst, zero...)
+	}
+	return t.AppendFormat(dst, layout)
+}
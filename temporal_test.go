@@ -0,0 +1,109 @@
+package mysqldump
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_temporalValue(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	tests := []struct {
+		name     string
+		typeName string
+		fsp      int
+		src      any
+		// WithZeroDateReplacement, zeroReplacement 为 nil 时替换为 NULL
+		replaceZero     bool
+		zeroReplacement []byte
+		want            []byte
+	}{
+		{
+			name:     "datetime(6) microseconds",
+			typeName: "DATETIME",
+			fsp:      6,
+			src:      time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC),
+			want:     []byte("2024-01-02 03:04:05.123456"),
+		},
+		{
+			name:     "trailing zeros kept",
+			typeName: "DATETIME",
+			fsp:      6,
+			src:      time.Date(2024, 1, 2, 3, 4, 5, 120000000, time.UTC),
+			want:     []byte("2024-01-02 03:04:05.120000"),
+		},
+		{
+			name:     "timestamp(3) in connection location",
+			typeName: "TIMESTAMP",
+			fsp:      3,
+			src:      time.Date(2024, 12, 31, 23, 59, 59, 999000000, loc),
+			want:     []byte("2024-12-31 23:59:59.999"),
+		},
+		{
+			name:     "datetime without fraction",
+			typeName: "DATETIME",
+			src:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			want:     []byte("2024-01-02 03:04:05"),
+		},
+		{
+			name:     "date",
+			typeName: "DATE",
+			src:      time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			want:     []byte("2024-02-29"),
+		},
+		{
+			name:     "zero datetime",
+			typeName: "DATETIME",
+			fsp:      2,
+			src:      time.Time{},
+			want:     []byte("0000-00-00 00:00:00.00"),
+		},
+		{
+			name:     "text from server unchanged",
+			typeName: "DATETIME",
+			fsp:      6,
+			src:      []byte("2024-01-02 03:04:05.000001"),
+			want:     []byte("2024-01-02 03:04:05.000001"),
+		},
+		{
+			name:     "null",
+			typeName: "DATETIME",
+			src:      nil,
+			want:     nil,
+		},
+		{
+			name:        "zero date becomes null",
+			typeName:    "DATE",
+			src:         []byte("0000-00-00"),
+			replaceZero: true,
+			want:        nil,
+		},
+		{
+			name:            "zero datetime from parseTime replaced",
+			typeName:        "DATETIME",
+			fsp:             3,
+			src:             time.Time{},
+			replaceZero:     true,
+			zeroReplacement: []byte("1970-01-01 00:00:00"),
+			want:            []byte("1970-01-01 00:00:00"),
+		},
+		{
+			name:        "non-zero date not replaced",
+			typeName:    "DATE",
+			src:         []byte("2000-01-01"),
+			replaceZero: true,
+			want:        []byte("2000-01-01"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTemporalValue(tt.typeName, tt.fsp)
+			v.replaceZero, v.zeroReplacement = tt.replaceZero, tt.zeroReplacement
+			if err := v.Scan(tt.src); err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if (v.value == nil) != (tt.want == nil) || string(v.value) != string(tt.want) {
+				t.Errorf("Scan() value = %q, want %q", v.value, tt.want)
+			}
+		})
+	}
+}